@@ -0,0 +1,83 @@
+// main.go
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/ryantrue/EaistSync/pkg/eaistmock"
+	"github.com/ryantrue/EaistSync/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка выполнения имитации EAIST: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	addr := flag.String("addr", ":8090", "адрес, на котором слушает имитация EAIST")
+	fixturesDir := flag.String("fixtures", "", "каталог с contracts.json и states.json (по умолчанию встроенные фикстуры)")
+	username := flag.String("username", "", "ожидаемое имя пользователя (пусто – любое)")
+	password := flag.String("password", "", "ожидаемый пароль")
+	latency := flag.Duration("latency", 0, "задержка перед каждым ответом")
+	errorRate := flag.Float64("error-rate", 0, "вероятность ответа 500 на запрос данных (0..1)")
+	sessionTTL := flag.Int("session-ttl", 0, "количество запросов, после которого сессия истекает (0 – не истекает)")
+	flag.Parse()
+
+	log, err := logger.NewLogger()
+	if err != nil {
+		return fmt.Errorf("не удалось инициализировать логгер: %w", err)
+	}
+	defer log.Sync()
+
+	var fixtures *eaistmock.Fixtures
+	if *fixturesDir != "" {
+		fixtures, err = eaistmock.LoadFixtures(*fixturesDir)
+	} else {
+		fixtures, err = eaistmock.DefaultFixtures()
+	}
+	if err != nil {
+		return err
+	}
+
+	mock := eaistmock.NewServer(fixtures, *username, *password)
+	mock.SetFaults(eaistmock.Faults{
+		Latency:    *latency,
+		ErrorRate:  *errorRate,
+		SessionTTL: *sessionTTL,
+	})
+
+	srv := &http.Server{Addr: *addr, Handler: mock}
+	errCh := make(chan error, 1)
+	go func() {
+		log.Info("Запуск имитации EAIST",
+			zap.String("addr", *addr),
+			zap.Int("contracts", len(fixtures.Contracts)),
+			zap.Int("states", len(fixtures.States)))
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			errCh <- err
+		}
+	}()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	select {
+	case <-sigCh:
+		log.Info("Получен сигнал завершения работы")
+	case err := <-errCh:
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+
+	"github.com/ryantrue/EaistSync/pkg/api/rest"
+	"github.com/ryantrue/EaistSync/pkg/commands"
+	"github.com/ryantrue/EaistSync/pkg/config"
+	"github.com/ryantrue/EaistSync/pkg/messaging"
+)
+
+// commandActions выполняет команды внешних систем теми же средствами, что и плановая синхронизация.
+type commandActions struct {
+	client *rest.EAISTClient
+	dbConn *sqlx.DB
+	log    *zap.Logger
+	cfg    *config.Config
+}
+
+// ResyncCustomer заново загружает и сохраняет контракты заказчика.
+func (a *commandActions) ResyncCustomer(ctx context.Context, customerID int64) error {
+	_, err := a.refetch(ctx, map[string]interface{}{"customerId": customerID})
+	return err
+}
+
+// RefetchContract заново загружает и сохраняет контракт; отсутствующий в EAIST контракт отклоняет команду.
+func (a *commandActions) RefetchContract(ctx context.Context, contractID int64) error {
+	n, err := a.refetch(ctx, map[string]interface{}{"id": contractID})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: контракт %d не найден в EAIST", commands.ErrInvalid, contractID)
+	}
+	return nil
+}
+
+// ResendNotifications возвращает в outbox события, записанные начиная с since; их опубликует Relay.
+func (a *commandActions) ResendNotifications(ctx context.Context, since time.Time) error {
+	n, err := messaging.Requeue(ctx, a.dbConn, since)
+	if err != nil {
+		return err
+	}
+	a.log.Info("События возвращены в outbox", zap.Time("since", since), zap.Int64("count", n))
+	return nil
+}
+
+// refetch загружает контракты по фильтру, сохраняет их вместе с версиями и событиями и возвращает число загруженных.
+func (a *commandActions) refetch(ctx context.Context, filter map[string]interface{}) (int, error) {
+	if err := rest.Login(ctx, a.client); err != nil {
+		return 0, fmt.Errorf("ошибка авторизации: %w", err)
+	}
+	contracts, err := rest.FetchContracts(ctx, a.client, a.cfg, filter)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка получения контрактов: %w", err)
+	}
+	stats, err := newUpserter(a.dbConn, a.log, a.cfg, []string{"contracts"}).UpsertMany(ctx, "contracts", contracts)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка сохранения контрактов: %w", err)
+	}
+	if len(stats.Rejected) > 0 {
+		a.log.Warn("Часть контрактов не сохранена", zap.Any("rejected", stats.Rejected))
+	}
+	a.log.Info("Контракты загружены по команде", zap.Any("filter", filter), zap.Int("count", len(contracts)),
+		zap.Int("inserted", stats.Inserted), zap.Int("updated", stats.Updated), zap.Int("unchanged", stats.Unchanged))
+	return len(contracts), nil
+}
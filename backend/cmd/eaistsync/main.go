@@ -3,22 +3,30 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"time"
 
 	"github.com/ryantrue/EaistSync/pkg/api/rest"
+	"github.com/ryantrue/EaistSync/pkg/archive"
+	"github.com/ryantrue/EaistSync/pkg/commands"
 	"github.com/ryantrue/EaistSync/pkg/config"
 	"github.com/ryantrue/EaistSync/pkg/cron"
 	"github.com/ryantrue/EaistSync/pkg/db"
+	"github.com/ryantrue/EaistSync/pkg/documents"
+	"github.com/ryantrue/EaistSync/pkg/events"
 	"github.com/ryantrue/EaistSync/pkg/logger"
 	"github.com/ryantrue/EaistSync/pkg/messaging"
 	"github.com/ryantrue/EaistSync/pkg/migrate"
 	"github.com/ryantrue/EaistSync/pkg/server"
+	"github.com/ryantrue/EaistSync/pkg/storage"
 	"github.com/ryantrue/EaistSync/pkg/telegrambot"
 	"github.com/ryantrue/EaistSync/pkg/utils"
+	"github.com/ryantrue/EaistSync/pkg/webhooks"
 
 	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
@@ -32,13 +40,15 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	if err := run(ctx); err != nil {
+	if err := run(ctx, os.Args[1:]); err != nil {
 		fmt.Fprintf(os.Stderr, "Ошибка выполнения приложения: %v\n", err)
 		os.Exit(1)
 	}
 }
 
-func run(ctx context.Context) error {
+// run запускает сервис; команда "replay <run-id> [--notify]" вместо этого воспроизводит синхронизацию
+// из архива в пробном режиме.
+func run(ctx context.Context, args []string) error {
 	// Инициализация логгера.
 	log, err := logger.NewLogger()
 	if err != nil {
@@ -70,52 +80,116 @@ func run(ctx context.Context) error {
 	if err != nil {
 		log.Fatal("Ошибка создания HTTP клиента", zap.Error(err))
 	}
+	eaistClient := rest.NewEAISTClient(httpClient, cfg, log)
+	log.Info("Эндпоинты EAIST", zap.Any("endpoints", cfg.EAIST.URLs()))
 
-	// Инициализируем Kafka продюсера с повторными попытками.
-	producer, err := initKafkaProducer(ctx, []string{cfg.KafkaBrokers}, "eaist_updates", log)
-	if err != nil {
-		log.Fatal("Ошибка создания Kafka продюсера", zap.Error(err))
+	// Подключаемся к MinIO. Без хранилища синхронизация работает, но файлы документов не загружаются.
+	var fileStore storage.ObjectStore
+	var files *documents.Syncer
+	if minioStore, err := storage.NewMinioStore(ctx, cfg, cfg.MinioBucket); err != nil {
+		log.Error("Хранилище файлов MinIO недоступно", zap.Error(err))
+	} else {
+		fileStore = minioStore
+		files = documents.NewSyncer(eaistClient, fileStore, dbConn, log)
 	}
-	defer producer.Close()
+
+	// Архив сырых ответов EAIST.
+	archiver := newArchiveBackend(ctx, cfg, log)
+
+	// События синхронизации пишутся в outbox и публикуются в получатели отдельным процессом.
+	sink := newEventSink(cfg, log)
+	defer sink.Close()
+	relay := messaging.NewRelay(dbConn, sink, log, cfg.OutboxRelayInterval).WithRetention(cfg.QueueRetention)
 
 	// Инициализируем Telegram-бота, если задан токен.
 	var telegramBot *telegrambot.TelegramBot
 	if cfg.TelegramBotToken != "" {
-		telegramBot, err = telegrambot.NewTelegramBot(cfg.TelegramBotToken, cfg.TelegramChatID, 3, 2*time.Second)
+		telegramBot, err = newTelegramBot(cfg, dbConn, log)
 		if err != nil {
 			log.Error("Ошибка создания Telegram-бота", zap.Error(err))
+		} else {
+			// Сообщения, не отправленные до остановки сервиса (в том числе при replay --notify), остаются в очереди
+			// и отправляются при следующем запуске.
+			go telegramBot.RunQueue(ctx)
 		}
 	}
+	// Уведомления привязанным пользователям по их подпискам.
+	var notifier *telegrambot.Notifier
+	if telegramBot != nil {
+		notifier = telegrambot.NewNotifier(telegramBot, dbConn, log)
+	}
 
-	// Первичное обновление данных.
-	log.Info("Первичный запуск обновления данных")
-	start := time.Now()
-	newContracts, err := updateData(ctx, httpClient, dbConn, log, producer, cfg)
-	if err != nil {
-		log.Error("Ошибка при первоначальном обновлении данных", zap.Error(err))
-		if telegramBot != nil {
-			telegramBot.Notify(ctx, fmt.Sprintf("Первичное обновление данных завершено с ошибкой.\nВремя выполнения: %v\nОшибка: %v", time.Since(start), err))
+	if len(args) > 0 && args[0] == "replay" {
+		if len(args) < 2 || len(args) > 3 || (len(args) == 3 && args[2] != "--notify") {
+			return fmt.Errorf("использование: eaistsync replay <run-id> [--notify]")
 		}
-	} else {
-		if len(newContracts) > 0 && telegramBot != nil {
-			if err := telegramBot.SendJSONDocument(ctx, newContracts); err != nil {
-				log.Error("Ошибка отправки новых контрактов через Telegram", zap.Error(err))
-			}
+		if len(args) == 2 {
+			telegramBot, notifier = nil, nil
 		}
-		log.Info("Первичное обновление данных прошло успешно")
+		return replayRun(ctx, args[1], eaistClient, dbConn, log, cfg, archiver, telegramBot, notifier)
+	}
+
+	// Первичное обновление данных.
+	log.Info("Первичный запуск обновления данных")
+	go relay.Run(ctx)
+	go webhooks.NewDispatcher(dbConn, log, cfg.WebhookDispatchInterval).
+		WithPrivateNetworks(cfg.WebhookAllowPrivateNetworks).
+		WithRetention(cfg.QueueRetention).
+		Run(ctx)
+	runner := &syncer{
+		client:      eaistClient,
+		dbConn:      dbConn,
+		log:         log,
+		cfg:         cfg,
+		files:       files,
+		archiver:    archiver,
+		telegramBot: telegramBot,
+		notifier:    notifier,
 	}
+	runner.Run(ctx, db.SyncTriggerStartup)
 
 	// Создаем новый Scheduler из пакета cron с передачей корневого контекста.
 	scheduler := cron.NewScheduler(ctx, log)
-	_, err = scheduler.AddTask("@daily", dataUpdater(ctx, httpClient, dbConn, log, producer, cfg, telegramBot))
+	_, err = scheduler.AddTask("@daily", func(ctx context.Context) { runner.Run(ctx, db.SyncTriggerSchedule) })
 	if err != nil {
 		log.Fatal("Ошибка добавления cron-задачи", zap.Error(err))
 	}
+	if notifier != nil {
+		_, err = scheduler.AddTask("@daily", func(ctx context.Context) {
+			if err := notifier.NotifyExpiring(ctx); err != nil {
+				log.Error("Ошибка отправки напоминаний о заканчивающихся контрактах", zap.Error(err))
+			}
+		})
+		if err != nil {
+			log.Fatal("Ошибка добавления cron-задачи", zap.Error(err))
+		}
+		// Команды бота; /sync запускает синхронизацию в фоне с корневым контекстом.
+		botCommands := telegrambot.NewCommands(telegramBot, dbConn, log, func(context.Context) error {
+			return runner.TryStart(ctx, db.SyncTriggerTelegram)
+		})
+		telegramBot.StartCommandListener(ctx, botCommands.HandleCommand, botCommands.HandleCallback)
+	}
 	go scheduler.Start()
 
+	// Команды внешних систем читаются из Kafka; без потребителя синхронизация работает как прежде.
+	consumer, err := messaging.NewKafkaConsumer(kafkaConfig(cfg), cfg.KafkaConsumerGroup, []string{cfg.KafkaCommandsTopic}, log)
+	if err != nil {
+		log.Error("Ошибка создания потребителя команд Kafka", zap.Error(err))
+	} else {
+		// Close дожидается завершения обработки текущей команды.
+		defer consumer.Close()
+		processor := commands.NewProcessor(dbConn, &commandActions{client: eaistClient, dbConn: dbConn, log: log, cfg: cfg}, log).
+			WithMaxAttempts(cfg.KafkaCommandsMaxAttempts)
+		go func() {
+			if err := consumer.Run(ctx, processor.Handle); err != nil {
+				log.Error("Ошибка потребителя команд Kafka", zap.Error(err))
+			}
+		}()
+	}
+
 	// Запуск HTTP-сервера.
 	serverAddr := fmt.Sprintf(":%s", cfg.Port)
-	appServer := server.NewServer(dbConn, log, cfg)
+	appServer := server.NewServer(dbConn, log, cfg, fileStore)
 	serverErrCh := make(chan error, 1)
 	go func() {
 		log.Info("Запуск сервера", zap.String("addr", serverAddr))
@@ -137,43 +211,132 @@ func run(ctx context.Context) error {
 	return nil
 }
 
-// initKafkaProducer пытается создать Kafka продюсера с несколькими попытками.
-func initKafkaProducer(ctx context.Context, brokers []string, topic string, log *zap.Logger) (messaging.KafkaProducerInterface, error) {
-	var producer messaging.KafkaProducerInterface
-	var err error
-	maxAttempts := 3
-	for i := 1; i <= maxAttempts; i++ {
-		producer, err = messaging.NewKafkaProducer(brokers, topic, log)
-		if err == nil {
-			log.Info("Kafka продюсер успешно создан", zap.Int("attempt", i))
-			return producer, nil
+// kafkaConfig возвращает параметры подключения к Kafka из конфигурации сервиса.
+func kafkaConfig(cfg *config.Config) messaging.KafkaConfig {
+	return messaging.KafkaConfig{
+		Brokers:               cfg.KafkaBrokers,
+		ClientID:              cfg.KafkaClientID,
+		SASLMechanism:         cfg.KafkaSASLMechanism,
+		SASLUsername:          cfg.KafkaSASLUsername,
+		SASLPassword:          cfg.KafkaSASLPassword,
+		TLS:                   cfg.KafkaTLS,
+		TLSCAFile:             cfg.KafkaTLSCAFile,
+		TLSInsecureSkipVerify: cfg.KafkaTLSInsecureSkipVerify,
+		Compression:           cfg.KafkaCompression,
+		Idempotent:            cfg.KafkaIdempotent,
+	}
+}
+
+// natsConfig возвращает параметры подключения к NATS из конфигурации сервиса.
+func natsConfig(cfg *config.Config) messaging.NATSConfig {
+	return messaging.NATSConfig{
+		URL:          cfg.NATSURL,
+		Subject:      cfg.NATSSubject,
+		Token:        cfg.NATSToken,
+		CredsFile:    cfg.NATSCredsFile,
+		NKeySeedFile: cfg.NATSNKeySeedFile,
+		TLSCAFile:    cfg.NATSTLSCAFile,
+		TLSCertFile:  cfg.NATSTLSCertFile,
+		TLSKeyFile:   cfg.NATSTLSKeyFile,
+	}
+}
+
+// newEventSink создаёт получателей событий согласно EVENT_SINKS. Получатель, который не удалось
+// создать, пропускается; Kafka и NATS подключаются при первой публикации, поэтому их недоступность
+// при запуске не мешает работе сервиса.
+func newEventSink(cfg *config.Config, log *zap.Logger) messaging.EventSink {
+	var sinks []messaging.EventSink
+	for _, name := range cfg.EventSinks {
+		switch name {
+		case "kafka":
+			sinks = append(sinks, messaging.NewKafkaSink(kafkaConfig(cfg), "eaist_updates", log))
+		case "webhook":
+			sinks = append(sinks, messaging.NewWebhookSink(cfg.EventWebhookURL, cfg.EventWebhookTimeout))
+		case "nats":
+			sink, err := messaging.NewNATSSink(natsConfig(cfg))
+			if err != nil {
+				log.Error("Получатель событий NATS не создан", zap.Error(err))
+				continue
+			}
+			sinks = append(sinks, sink)
+		case "file":
+			sink, err := messaging.NewFileSink(cfg.EventFilePath)
+			if err != nil {
+				log.Error("Файл событий недоступен", zap.String("path", cfg.EventFilePath), zap.Error(err))
+				continue
+			}
+			sinks = append(sinks, sink)
 		}
-		log.Warn("Не удалось создать Kafka продюсера", zap.Int("attempt", i), zap.Error(err))
-		time.Sleep(5 * time.Second)
 	}
-	return nil, fmt.Errorf("не удалось создать Kafka продюсера после %d попыток: %w", maxAttempts, err)
+	if len(sinks) == 0 {
+		log.Info("Получатели событий не настроены, события сохраняются только в outbox")
+	} else {
+		log.Info("Получатели событий", zap.Strings("sinks", cfg.EventSinks))
+	}
+	return messaging.NewFanOut(sinks...)
+}
+
+// newTelegramBot создаёт Telegram-бота с шаблонами сообщений и настройками дайджеста из cfg;
+// сообщения отправляются через постоянную очередь в dbConn.
+func newTelegramBot(cfg *config.Config, dbConn *sqlx.DB, log *zap.Logger) (*telegrambot.TelegramBot, error) {
+	renderer, err := telegrambot.NewRenderer(cfg.TelegramParseMode, cfg.TelegramTemplatesDir)
+	if err != nil {
+		return nil, err
+	}
+	bot, err := telegrambot.NewTelegramBot(cfg.TelegramBotToken, cfg.TelegramChatID, 3, 2*time.Second, log)
+	if err != nil {
+		return nil, err
+	}
+	return bot.WithRenderer(renderer).
+		WithDigest(cfg.TelegramDigestThreshold, cfg.TelegramDigestFormat).
+		WithQueue(dbConn, cfg.TelegramQueueInterval, cfg.QueueRetention), nil
+}
+
+// syncResult – итог синхронизации, о котором сообщается в Telegram.
+type syncResult struct {
+	Contracts    int                      // число контрактов в выборке EAIST
+	NewContracts []map[string]interface{} // контракты, чьи ID ранее не были обработаны
+	Removed      []int64                  // контракты, пропавшие из полной выборки EAIST
+	Rejected     []db.RejectedRecord      // контракты, которые не удалось сохранить
+	StateChanges []events.ContractStateChanged
+	Updated      []telegrambot.ContractMessage // изменённые контракты с изменившимися полями
 }
 
-// updateData обновляет данные из EAIST REST API, сохраняет их в БД, публикует событие в Kafka
-// и возвращает список новых контрактов (тех, чьи ID ранее не были обработаны).
-func updateData(ctx context.Context, client *http.Client, dbConn *sqlx.DB, log *zap.Logger, producer messaging.KafkaProducerInterface, cfg *config.Config) ([]map[string]interface{}, error) {
+// updateData обновляет данные из EAIST REST API, сохраняет их в БД, записывает события для Kafka
+// в outbox и возвращает новые и удалённые контракты.
+// Если files задан, после синхронизации списка документов загружаются их файлы;
+// если задан archiver, сырые ответы EAIST сохраняются в архив запуска.
+// При dryRun данные сравниваются с БД как обычно, но все транзакции откатываются: ни рабочие таблицы,
+// ни история, ни outbox и очередь webhook не меняются, мягкое удаление не выполняется – результат
+// лишь показывает, что изменил бы запуск.
+func updateData(ctx context.Context, client *rest.EAISTClient, dbConn *sqlx.DB, log *zap.Logger, cfg *config.Config, files *documents.Syncer, archiver archive.Backend, dryRun bool) (*syncResult, error) {
+	// Сохраняем сырые ответы, чтобы запуск можно было воспроизвести командой replay.
+	var runID string
+	if archiver != nil {
+		rec := archive.NewRecorder(archiver)
+		runID = rec.RunID()
+		ctx = rest.WithRecorder(ctx, rec)
+		defer func() {
+			if err := rec.Close(context.WithoutCancel(ctx)); err != nil {
+				log.Warn("Не удалось сохранить описание запуска в архив", zap.String("runId", runID), zap.Error(err))
+			}
+		}()
+	}
+
 	// Авторизация через REST API.
-	if err := rest.Login(ctx, client, cfg); err != nil {
+	if err := rest.Login(ctx, client); err != nil {
 		return nil, fmt.Errorf("ошибка авторизации: %w", err)
 	}
 
-	// Получение контрактов.
+	// Получение контрактов. Если часть страниц не загрузилась, сохраняем то, что удалось получить.
 	contracts, err := rest.FetchAllContracts(ctx, client, log, cfg)
-	if err != nil {
+	var partialErr *rest.PartialFetchError
+	if errors.As(err, &partialErr) {
+		log.Warn("Контракты загружены не полностью", zap.Ints("failedPages", partialErr.FailedPages), zap.Error(err))
+	} else if err != nil {
 		return nil, fmt.Errorf("ошибка получения контрактов: %w", err)
 	}
 
-	// Получение состояний.
-	states, err := rest.FetchStates(ctx, client)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка получения состояний: %w", err)
-	}
-
 	// Фильтруем новые контракты (те, чей ID ранее не встречался).
 	var newContracts []map[string]interface{}
 	for _, contract := range contracts {
@@ -194,49 +357,311 @@ func updateData(ctx context.Context, client *http.Client, dbConn *sqlx.DB, log *
 		}
 	}
 
+	// Состояния, справочники и дочерние сущности контрактов синхронизируются единообразно.
+	entities, err := rest.Entities(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	// Создаем JSONUpserter с динамическим списком разрешённых таблиц.
-	upserter := db.NewJSONUpserter(dbConn, log, []string{"contracts", "states"})
+	// Версии новых и изменившихся контрактов (для запросов на дату as_of) и события пишутся
+	// в транзакции их сохранения; изменения и смены состояний запоминаются для уведомлений в Telegram.
+	syncedAt := time.Now()
+	history := db.NewHistoryWriter(log)
+	var versions int
+	var stateChanges []events.ContractStateChanged
+	var updated []telegrambot.ContractMessage
+	upserter := newUpserter(dbConn, log, cfg, append([]string{"contracts"}, rest.EntityTables(entities)...)).
+		WithChangeHandler(func(ctx context.Context, tx *sqlx.Tx, table string, changes []db.Change) error {
+			evs := contractEvents(table, changes)
+			if !dryRun {
+				n, err := recordContractChanges(ctx, tx, history, table, changes, syncedAt)
+				if err != nil {
+					return err
+				}
+				versions += n
+			}
+			current := make(map[int64]map[string]interface{}, len(changes))
+			for _, c := range changes {
+				current[c.ID] = c.Current
+			}
+			for _, e := range evs {
+				switch data := e.Data.(type) {
+				case events.ContractStateChanged:
+					stateChanges = append(stateChanges, data)
+				case events.ContractUpdated:
+					updated = append(updated, telegrambot.ContractMessage{
+						ID:       data.ContractID,
+						Contract: current[data.ContractID],
+						Changes:  data.Changes,
+					})
+				}
+			}
+			return nil
+		})
+	if dryRun {
+		upserter.WithDryRun()
+	}
 
 	// Сохраняем данные в БД через новый интерфейс.
-	if err := upserter.UpsertMany(ctx, "contracts", contracts); err != nil {
+	// Отклонённые записи не мешают сохранить остальные контракты и опубликовать событие.
+	contractStats, err := upserter.UpsertMany(ctx, "contracts", contracts)
+	if err != nil {
 		return nil, fmt.Errorf("ошибка сохранения контрактов: %w", err)
 	}
-	if err := upserter.UpsertMany(ctx, "states", states); err != nil {
-		return nil, fmt.Errorf("ошибка сохранения состояний: %w", err)
+	if len(contractStats.Rejected) > 0 {
+		log.Warn("Часть контрактов не сохранена", zap.Any("rejected", contractStats.Rejected))
+	}
+	if !dryRun {
+		log.Info("История контрактов обновлена", zap.Int("versions", versions))
+	}
+
+	contractIDs := make([]int64, 0, len(contracts))
+	for _, contract := range contracts {
+		if id, err := utils.ExtractID(contract); err == nil {
+			contractIDs = append(contractIDs, id)
+		}
+	}
+
+	counts, err := rest.SyncEntities(ctx, client, upserter, log, cfg, entities, contractIDs)
+	if err != nil {
+		// Состояния синхронизировались и раньше, поэтому их ошибка прерывает обновление;
+		// ошибки дополнительных сущностей не мешают публикации события.
+		if _, ok := counts[config.EndpointStates]; !ok {
+			return nil, fmt.Errorf("ошибка синхронизации состояний: %w", err)
+		}
+		log.Warn("Часть сущностей EAIST не синхронизирована", zap.Error(err))
+	}
+
+	// Загружаем файлы документов, которых ещё нет в хранилище.
+	if _, ok := counts[config.EndpointContractDocuments]; ok && files != nil {
+		stats, err := files.Sync(ctx)
+		if err != nil {
+			log.Warn("Часть файлов документов не загружена", zap.Error(err))
+		}
+		log.Info("Файлы документов синхронизированы",
+			zap.Int("downloaded", stats.Downloaded),
+			zap.Int("deduplicated", stats.Deduplicated),
+			zap.Int("failed", stats.Failed))
+	}
+
+	// Мягкое удаление, закрытие истории удалённых контрактов и события для Kafka фиксируются одной
+	// транзакцией: события попадают в outbox и публикуются Relay, даже если Kafka сейчас недоступна.
+	// При dryRun пометки нужны лишь для отчёта об удалённых контрактах, и транзакция откатывается.
+	tx, err := dbConn.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %w", err)
 	}
+	defer tx.Rollback()
 
-	// Формируем сообщение для Kafka.
+	// Мягкое удаление выполняется только по полной выборке: иначе контракты с незагруженных
+	// страниц были бы ошибочно помечены удалёнными.
+	var missing db.MissingResult
+	if partialErr == nil {
+		missing, err = upserter.MarkMissingTx(ctx, tx, "contracts", contractIDs, syncedAt)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка пометки удалённых контрактов: %w", err)
+		}
+		if err := history.Close(ctx, tx, missing.Removed, syncedAt); err != nil {
+			return nil, fmt.Errorf("ошибка закрытия истории удалённых контрактов: %w", err)
+		}
+		if err := history.Reopen(ctx, tx, missing.Reactivated, syncedAt); err != nil {
+			return nil, fmt.Errorf("ошибка восстановления истории вернувшихся контрактов: %w", err)
+		}
+		if len(missing.Removed) > 0 || len(missing.Reactivated) > 0 {
+			log.Info("Обновлены признаки удаления контрактов",
+				zap.Int64s("removed", missing.Removed),
+				zap.Int64s("reactivated", missing.Reactivated))
+		}
+	}
+
+	result := &syncResult{
+		Contracts:    len(contracts),
+		NewContracts: newContracts,
+		Removed:      missing.Removed,
+		Rejected:     contractStats.Rejected,
+		StateChanges: stateChanges,
+		Updated:      updated,
+	}
+	if dryRun {
+		if err := tx.Rollback(); err != nil {
+			return nil, fmt.Errorf("ошибка отката транзакции: %w", err)
+		}
+		log.Info("Пробный запуск завершён, изменения не сохранены", zap.Int64s("removed", missing.Removed))
+		return result, nil
+	}
+
+	// Формируем сообщения для Kafka.
 	updateMessage := map[string]interface{}{
 		"timestamp": time.Now().Format(time.RFC1123),
 		"contracts": len(contracts),
-		"states":    len(states),
+		"changes":   contractStats,
+		"states":    counts[config.EndpointStates],
+		"entities":  counts,
+		"removed":   len(missing.Removed),
+		"restored":  len(missing.Reactivated),
 		"event":     "data_updated",
 	}
-	if err := producer.PublishMessage(ctx, updateMessage); err != nil {
-		return nil, fmt.Errorf("ошибка отправки сообщения в Kafka: %w", err)
+	if runID != "" {
+		updateMessage["run_id"] = runID
+	}
+	if err := messaging.Enqueue(ctx, tx, updateMessage); err != nil {
+		return nil, fmt.Errorf("ошибка записи событий в outbox: %w", err)
+	}
+	missingEvents := make([]events.Event, 0, len(missing.Removed)+len(missing.Reactivated))
+	for _, id := range missing.Removed {
+		missingEvents = append(missingEvents, events.ContractRemoved(id, syncedAt))
+	}
+	for _, id := range missing.Reactivated {
+		missingEvents = append(missingEvents, events.ContractRestored(id, syncedAt))
+	}
+	if err := enqueueEvents(ctx, tx, missingEvents); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка фиксации транзакции: %w", err)
+	}
+
+	log.Info("Синхронизация с EAIST завершена", zap.String("runId", runID), zap.Int64("relogins", client.Relogins()))
+	return result, nil
+}
+
+// newUpserter создаёт JSONUpserter для таблиц tables с пакетным сохранением по настройкам cfg
+// и записью событий о контрактах в outbox.
+func newUpserter(dbConn *sqlx.DB, log *zap.Logger, cfg *config.Config, tables []string) *db.JSONUpserter {
+	return db.NewJSONUpserter(dbConn, log, tables).
+		WithBulk(db.BulkConfig{
+			Threshold:        cfg.DBBulkThreshold,
+			ChunkSize:        cfg.DBBulkChunkSize,
+			BaseTimeout:      cfg.DBBulkTimeoutBase,
+			PerRecordTimeout: cfg.DBBulkTimeoutPerRecord,
+		}).
+		WithChangeHandler(func(ctx context.Context, tx *sqlx.Tx, table string, changes []db.Change) error {
+			_, err := recordContractChanges(ctx, tx, db.NewHistoryWriter(log), table, changes, time.Now())
+			return err
+		})
+}
+
+// recordContractChanges в транзакции сохранения записывает версии новых и изменённых контрактов
+// на момент at и события о них и возвращает количество созданных версий; изменения других таблиц
+// не записываются.
+func recordContractChanges(ctx context.Context, tx *sqlx.Tx, history *db.HistoryWriter, table string, changes []db.Change, at time.Time) (int, error) {
+	if table != "contracts" {
+		return 0, nil
+	}
+	versions, err := history.Record(ctx, tx, changes, at)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка сохранения истории контрактов: %w", err)
+	}
+	return versions, enqueueEvents(ctx, tx, contractEvents(table, changes))
+}
+
+// contractEvents возвращает события о новых и изменённых контрактах.
+func contractEvents(table string, changes []db.Change) []events.Event {
+	if table != "contracts" {
+		return nil
 	}
+	now := time.Now()
+	var evs []events.Event
+	for _, c := range changes {
+		evs = append(evs, events.ContractChanged(c.ID, c.Previous, c.Current, now)...)
+	}
+	return evs
+}
 
-	return newContracts, nil
+// enqueueEvents записывает события о контрактах в outbox и ставит их в очередь доставки
+// подходящим подпискам webhook.
+func enqueueEvents(ctx context.Context, tx *sqlx.Tx, evs []events.Event) error {
+	messages := make([]interface{}, len(evs))
+	for i, e := range evs {
+		messages[i] = e
+	}
+	if err := messaging.Enqueue(ctx, tx, messages...); err != nil {
+		return fmt.Errorf("ошибка записи событий в outbox: %w", err)
+	}
+	if err := webhooks.Enqueue(ctx, tx, evs...); err != nil {
+		return fmt.Errorf("ошибка записи доставок webhook: %w", err)
+	}
+	return nil
 }
 
-// dataUpdater возвращает функцию UpdaterFunc, которая замыкает все необходимые зависимости.
-func dataUpdater(ctx context.Context, client *http.Client, dbConn *sqlx.DB, log *zap.Logger, producer messaging.KafkaProducerInterface, cfg *config.Config, telegramBot *telegrambot.TelegramBot) cron.UpdaterFunc {
-	return func(ctx context.Context) {
-		log.Info("Запуск обновления данных из EAIST")
-		newContracts, err := updateData(ctx, client, dbConn, log, producer, cfg)
+// notifyResult отправляет в общий чат Telegram, если он задан, новые и изменённые контракты (при большом
+// числе – дайджестом с таблицей во вложении), список контрактов, пропавших из EAIST, и контракты,
+// которые не удалось сохранить; подписчикам – новые контракты и смены состояний.
+func notifyResult(ctx context.Context, telegramBot *telegrambot.TelegramBot, notifier *telegrambot.Notifier, log *zap.Logger, result *syncResult) {
+	if telegramBot == nil {
+		return
+	}
+	if notifier != nil {
+		notifier.NotifyNewContracts(ctx, result.NewContracts)
+		notifier.NotifyStateChanges(ctx, result.StateChanges)
+	}
+	if telegramBot.ChatID() == 0 {
+		return
+	}
+	if err := telegramBot.SendContracts(ctx, telegramBot.ChatID(), result.NewContracts, result.Updated); err != nil {
+		log.Error("Ошибка отправки новых и изменённых контрактов через Telegram", zap.Error(err))
+	}
+	if len(result.Removed) > 0 {
+		removed := telegrambot.RemovedMessage{IDs: result.Removed}
+		if err := telegramBot.SendTemplate(ctx, telegramBot.ChatID(), telegrambot.TemplateContractsRemoved, removed); err != nil {
+			log.Error("Ошибка отправки уведомления об удалённых контрактах", zap.Error(err))
+		}
+	}
+	if len(result.Rejected) > 0 {
+		var b strings.Builder
+		fmt.Fprintf(&b, "Не удалось сохранить контракты (%d):", len(result.Rejected))
+		for _, r := range result.Rejected {
+			fmt.Fprintf(&b, "\n%d: %s", r.ID, r.Reason)
+		}
+		if err := telegramBot.Notify(ctx, b.String()); err != nil {
+			log.Error("Ошибка отправки уведомления об отклонённых контрактах", zap.Error(err))
+		}
+	}
+}
+
+// newArchiveBackend создаёт хранилище архива сырых ответов EAIST согласно ARCHIVE_STORE.
+// Если архив отключён или MinIO недоступен, возвращается nil и синхронизация работает без архива.
+func newArchiveBackend(ctx context.Context, cfg *config.Config, log *zap.Logger) archive.Backend {
+	switch cfg.ArchiveStore {
+	case "fs":
+		return archive.NewFileBackend(cfg.ArchiveDir)
+	case "minio":
+		store, err := storage.NewMinioStore(ctx, cfg, cfg.ArchiveBucket)
 		if err != nil {
-			log.Error("Ошибка обновления данных", zap.Error(err))
-			if telegramBot != nil {
-				telegramBot.Notify(ctx, fmt.Sprintf("Ошибка обновления данных: %v", err))
-			}
-		} else if telegramBot != nil {
-			if len(newContracts) > 0 {
-				if err := telegramBot.SendJSONDocument(ctx, newContracts); err != nil {
-					log.Error("Ошибка отправки новых контрактов через Telegram", zap.Error(err))
-				}
-			} else {
-				log.Info("Обновление данных выполнено, новых контрактов не обнаружено")
-			}
+			log.Error("Архив ответов EAIST в MinIO недоступен", zap.Error(err))
+			return nil
 		}
+		return archive.NewObjectBackend(store)
+	}
+	return nil
+}
+
+// replayRun повторяет сохранение и сравнение по архиву запуска runID без обращения к EAIST в пробном
+// режиме: данные сравниваются с текущим состоянием БД, но ничего не сохраняется и события не публикуются.
+// Если telegramBot задан (replay --notify), уведомления о найденных изменениях отправляются как после
+// обычной синхронизации.
+func replayRun(ctx context.Context, runID string, client *rest.EAISTClient, dbConn *sqlx.DB, log *zap.Logger, cfg *config.Config, archiver archive.Backend, telegramBot *telegrambot.TelegramBot, notifier *telegrambot.Notifier) error {
+	if archiver == nil {
+		return fmt.Errorf("архив ответов EAIST не настроен (ARCHIVE_STORE=%s)", cfg.ArchiveStore)
+	}
+	src, err := archive.OpenRun(ctx, archiver, runID)
+	if err != nil {
+		return err
 	}
+
+	log.Info("Воспроизведение синхронизации из архива", zap.String("runId", runID))
+	result, err := updateData(rest.WithReplay(ctx, src), client, dbConn, log, cfg, nil, nil, true)
+	if err != nil {
+		return fmt.Errorf("воспроизведение запуска %s: %w", runID, err)
+	}
+	notifyResult(ctx, telegramBot, notifier, log, result)
+	log.Info("Воспроизведение завершено", zap.String("runId", runID),
+		zap.Int("contracts", result.Contracts),
+		zap.Int("newContracts", len(result.NewContracts)),
+		zap.Int("updated", len(result.Updated)),
+		zap.Int("stateChanges", len(result.StateChanges)),
+		zap.Int("removed", len(result.Removed)),
+		zap.Int("rejected", len(result.Rejected)))
+	return nil
 }
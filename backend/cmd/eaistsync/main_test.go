@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+
+	"github.com/ryantrue/EaistSync/pkg/api/rest"
+	"github.com/ryantrue/EaistSync/pkg/archive"
+	"github.com/ryantrue/EaistSync/pkg/config"
+	"github.com/ryantrue/EaistSync/pkg/eaistmock"
+	"github.com/ryantrue/EaistSync/pkg/events"
+	"github.com/ryantrue/EaistSync/pkg/utils"
+)
+
+// outboxCapture запоминает сообщения, записанные в outbox.
+type outboxCapture struct {
+	messages []map[string]interface{}
+}
+
+// Match реализует sqlmock.Argument для payload сообщения outbox.
+func (c *outboxCapture) Match(v driver.Value) bool {
+	data, ok := v.([]byte)
+	if !ok {
+		return false
+	}
+	var message map[string]interface{}
+	if err := json.Unmarshal(data, &message); err != nil {
+		return false
+	}
+	c.messages = append(c.messages, message)
+	return true
+}
+
+// expectUpsert ожидает транзакционную вставку n новых записей в таблицу; если outbox задан,
+// в той же транзакции ожидается запись версий контрактов и n событий contract.created в outbox
+// и в очередь webhook.
+func expectUpsert(mock sqlmock.Sqlmock, table string, n int, outbox *outboxCapture) {
+	mock.ExpectBegin()
+	prep := mock.ExpectPrepare("INSERT INTO " + table)
+	for i := 0; i < n; i++ {
+		mock.ExpectExec("SAVEPOINT upsert_record").WillReturnResult(sqlmock.NewResult(0, 0))
+		prep.ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"inserted", "previous"}).AddRow(true, nil))
+		mock.ExpectExec("RELEASE SAVEPOINT upsert_record").WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	if outbox != nil {
+		mock.ExpectExec("WITH src AS").WillReturnResult(sqlmock.NewResult(0, int64(n)))
+		for i := 0; i < n; i++ {
+			mock.ExpectExec("INSERT INTO outbox").WithArgs(sqlmock.AnyArg(), outbox).WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		expectWebhooks(mock, n)
+	}
+	mock.ExpectCommit()
+}
+
+// expectUnchanged ожидает сохранение n записей в таблицу, которые не изменились с прошлой синхронизации.
+func expectUnchanged(mock sqlmock.Sqlmock, table string, n int) {
+	mock.ExpectBegin()
+	prep := mock.ExpectPrepare("INSERT INTO " + table)
+	for i := 0; i < n; i++ {
+		mock.ExpectExec("SAVEPOINT upsert_record").WillReturnResult(sqlmock.NewResult(0, 0))
+		prep.ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"inserted", "previous"}))
+		mock.ExpectExec("RELEASE SAVEPOINT upsert_record").WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectCommit()
+}
+
+// expectDryRun ожидает пробное сохранение n новых записей в таблицу: без записи событий и с откатом транзакции.
+func expectDryRun(mock sqlmock.Sqlmock, table string, n int) {
+	mock.ExpectBegin()
+	prep := mock.ExpectPrepare("INSERT INTO " + table)
+	for i := 0; i < n; i++ {
+		mock.ExpectExec("SAVEPOINT upsert_record").WillReturnResult(sqlmock.NewResult(0, 0))
+		prep.ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"inserted", "previous"}).AddRow(true, nil))
+		mock.ExpectExec("RELEASE SAVEPOINT upsert_record").WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectRollback()
+}
+
+// findMessages возвращает сообщения outbox, у которых поле field равно value.
+func findMessages(outbox *outboxCapture, field, value string) []map[string]interface{} {
+	var found []map[string]interface{}
+	for _, m := range outbox.messages {
+		if m[field] == value {
+			found = append(found, m)
+		}
+	}
+	return found
+}
+
+// expectFinish ожидает завершающую транзакцию: возврат контрактов reactivated и мягкое удаление
+// контрактов removed, пропавших из выборки, с записью их версий в историю, и запись событий
+// data_updated, contract.removed и contract.restored в outbox.
+func expectFinish(mock sqlmock.Sqlmock, outbox *outboxCapture, reactivated []int64, removed ...int64) {
+	mock.ExpectBegin()
+	restored := sqlmock.NewRows([]string{"id"})
+	for _, id := range reactivated {
+		restored.AddRow(id)
+	}
+	mock.ExpectQuery("UPDATE contracts SET missing_since = NULL").WillReturnRows(restored)
+	rows := sqlmock.NewRows([]string{"id"})
+	for _, id := range removed {
+		rows.AddRow(id)
+	}
+	mock.ExpectQuery("UPDATE contracts SET missing_since = \\$2").WillReturnRows(rows)
+	if len(removed) > 0 {
+		mock.ExpectExec("UPDATE contracts_history SET valid_to").WillReturnResult(sqlmock.NewResult(0, int64(len(removed))))
+	}
+	if len(reactivated) > 0 {
+		mock.ExpectExec("INSERT INTO contracts_history").WithArgs(pq.Array(reactivated), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, int64(len(reactivated))))
+	}
+	n := len(removed) + len(reactivated)
+	for i := 0; i <= n; i++ {
+		mock.ExpectExec("INSERT INTO outbox").WithArgs(sqlmock.AnyArg(), outbox).WillReturnResult(sqlmock.NewResult(int64(i+1), 1))
+	}
+	expectWebhooks(mock, n)
+	mock.ExpectCommit()
+}
+
+// expectWebhooks ожидает постановку n событий в очередь доставки webhook (подписок нет).
+func expectWebhooks(mock sqlmock.Sqlmock, n int) {
+	for i := 0; i < n; i++ {
+		mock.ExpectExec("INSERT INTO webhook_deliveries").WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+}
+
+func TestUpdateDataAgainstEAISTMock(t *testing.T) {
+	fixtures, err := eaistmock.DefaultFixtures()
+	if err != nil {
+		t.Fatalf("Ошибка загрузки фикстур: %v", err)
+	}
+	mockEAIST := eaistmock.NewServer(fixtures, "user", "secret")
+	// Первый запрос данных завершится ошибкой 500, а сессия истекает каждые 2 запроса:
+	// клиент должен повторить запрос и повторно авторизоваться.
+	mockEAIST.SetFaults(eaistmock.Faults{FailNext: 1, SessionTTL: 2})
+	srv := httptest.NewServer(mockEAIST)
+	defer srv.Close()
+
+	cfg := &config.Config{
+		Username: "user",
+		Password: "secret",
+		// Имитация повторяет пути EAIST, поэтому достаточно заменить базовый адрес.
+		EAIST:                 config.EAISTEndpoints{BaseURL: srv.URL, Paths: config.DefaultEAISTPaths()},
+		PageSize:              2,
+		MaxConcurrency:        2,
+		EAISTMaxRetries:       3,
+		EAISTRetryBaseDelay:   time.Millisecond,
+		EAISTRetryMaxDelay:    5 * time.Millisecond,
+		EAISTBreakerThreshold: 10,
+		EAISTBreakerCooldown:  time.Second,
+	}
+	log, _ := zap.NewDevelopment()
+	httpClient, err := rest.NewHTTPClient(5 * time.Second)
+	if err != nil {
+		t.Fatalf("Ошибка создания HTTP клиента: %v", err)
+	}
+	client := rest.NewEAISTClient(httpClient, cfg, log)
+
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Ошибка создания sqlmock: %v", err)
+	}
+	defer sqlDB.Close()
+	outbox := &outboxCapture{}
+	expectUpsert(mock, "contracts", len(fixtures.Contracts), outbox)
+	expectUpsert(mock, "states", 5, nil) // только состояния категории contractstagesupplier
+	expectFinish(mock, outbox, nil, 99)  // контракт 99 пропал из выборки EAIST
+
+	processedContractIDs = make(map[int64]bool)
+	result, err := updateData(context.Background(), client, sqlx.NewDb(sqlDB, "sqlmock"), log, cfg, nil, nil, false)
+	if err != nil {
+		t.Fatalf("updateData завершился ошибкой: %v", err)
+	}
+
+	if len(result.NewContracts) != len(fixtures.Contracts) {
+		t.Errorf("Новых контрактов %d, ожидалось %d", len(result.NewContracts), len(fixtures.Contracts))
+	}
+	if len(result.Removed) != 1 || result.Removed[0] != 99 {
+		t.Errorf("Удалённые контракты %v, ожидался [99]", result.Removed)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Не выполнены ожидания БД: %v", err)
+	}
+	// События contract.created, data_updated и contract.removed.
+	if created := findMessages(outbox, "type", events.TypeContractCreated); len(created) != len(fixtures.Contracts) {
+		t.Errorf("Событий contract.created %d, ожидалось %d", len(created), len(fixtures.Contracts))
+	}
+	if removed := findMessages(outbox, "type", events.TypeContractRemoved); len(removed) != 1 || removed[0]["subject"] != "99" {
+		t.Errorf("Неожиданные события удаления: %v", removed)
+	}
+	if updated := findMessages(outbox, "event", "data_updated"); len(updated) != 1 {
+		t.Errorf("Событий data_updated %d, ожидалось 1", len(updated))
+	} else {
+		changes, _ := updated[0]["changes"].(map[string]interface{})
+		if changes["inserted"] != float64(len(fixtures.Contracts)) || changes["updated"] != float64(0) || changes["rejected"] != nil {
+			t.Errorf("Изменения контрактов %v, ожидалось %d новых", changes, len(fixtures.Contracts))
+		}
+	}
+	if client.Relogins() == 0 {
+		t.Error("Ожидалась повторная авторизация после истечения сессии")
+	}
+	if stats := mockEAIST.Stats(); stats.Failures != 1 {
+		t.Errorf("Имитировано %d сбоев, ожидался 1", stats.Failures)
+	}
+}
+
+// TestUpdateDataReopensRestoredContracts проверяет, что контракт, вернувшийся в выборку EAIST
+// без изменений после удаления, снова получает открытую версию в истории и событие contract.restored.
+func TestUpdateDataReopensRestoredContracts(t *testing.T) {
+	fixtures, err := eaistmock.DefaultFixtures()
+	if err != nil {
+		t.Fatalf("Ошибка загрузки фикстур: %v", err)
+	}
+	srv := httptest.NewServer(eaistmock.NewServer(fixtures, "", ""))
+	defer srv.Close()
+	restoredID, err := utils.ExtractIDField(fixtures.Contracts[0], "id")
+	if err != nil {
+		t.Fatalf("Ошибка получения ID контракта: %v", err)
+	}
+
+	cfg := &config.Config{
+		EAIST:          config.EAISTEndpoints{BaseURL: srv.URL, Paths: config.DefaultEAISTPaths()},
+		PageSize:       2,
+		MaxConcurrency: 2,
+	}
+	log := zap.NewNop()
+	httpClient, err := rest.NewHTTPClient(5 * time.Second)
+	if err != nil {
+		t.Fatalf("Ошибка создания HTTP клиента: %v", err)
+	}
+	client := rest.NewEAISTClient(httpClient, cfg, log)
+
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Ошибка создания sqlmock: %v", err)
+	}
+	defer sqlDB.Close()
+	outbox := &outboxCapture{}
+	// Данные контрактов не изменились, поэтому при сохранении версии в историю не пишутся.
+	expectUnchanged(mock, "contracts", len(fixtures.Contracts))
+	expectUnchanged(mock, "states", 5)
+	expectFinish(mock, outbox, []int64{restoredID})
+
+	processedContractIDs = make(map[int64]bool)
+	if _, err := updateData(context.Background(), client, sqlx.NewDb(sqlDB, "sqlmock"), log, cfg, nil, nil, false); err != nil {
+		t.Fatalf("updateData завершился ошибкой: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Не выполнены ожидания БД: %v", err)
+	}
+	restored := findMessages(outbox, "type", events.TypeContractRestored)
+	if len(restored) != 1 || restored[0]["subject"] != strconv.FormatInt(restoredID, 10) {
+		t.Errorf("Неожиданные события возврата: %v", restored)
+	}
+	if updated := findMessages(outbox, "event", "data_updated"); len(updated) != 1 || updated[0]["restored"] != float64(1) {
+		t.Errorf("Событие data_updated не учитывает вернувшийся контракт: %v", updated)
+	}
+}
+
+func TestReplayFromArchive(t *testing.T) {
+	fixtures, err := eaistmock.DefaultFixtures()
+	if err != nil {
+		t.Fatalf("Ошибка загрузки фикстур: %v", err)
+	}
+	srv := httptest.NewServer(eaistmock.NewServer(fixtures, "", ""))
+
+	cfg := &config.Config{
+		EAIST:          config.EAISTEndpoints{BaseURL: srv.URL, Paths: config.DefaultEAISTPaths()},
+		PageSize:       2,
+		MaxConcurrency: 2,
+	}
+	log := zap.NewNop()
+	httpClient, err := rest.NewHTTPClient(5 * time.Second)
+	if err != nil {
+		t.Fatalf("Ошибка создания HTTP клиента: %v", err)
+	}
+	client := rest.NewEAISTClient(httpClient, cfg, log)
+	archiver := archive.NewFileBackend(t.TempDir())
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Ошибка создания sqlmock: %v", err)
+	}
+	defer db.Close()
+	dbx := sqlx.NewDb(db, "sqlmock")
+
+	// Синхронизация с EAIST сохраняет ответы в архив.
+	outbox := &outboxCapture{}
+	expectUpsert(mock, "contracts", len(fixtures.Contracts), outbox)
+	expectUpsert(mock, "states", 5, nil)
+	expectFinish(mock, outbox, nil)
+	processedContractIDs = make(map[int64]bool)
+	if _, err := updateData(context.Background(), client, dbx, log, cfg, nil, archiver, false); err != nil {
+		t.Fatalf("updateData завершился ошибкой: %v", err)
+	}
+	var runID string
+	if updated := findMessages(outbox, "event", "data_updated"); len(updated) == 1 {
+		runID, _ = updated[0]["run_id"].(string)
+	}
+	if runID == "" {
+		t.Fatal("Событие синхронизации не содержит run_id")
+	}
+
+	// Воспроизведение работает без EAIST и ничего не сохраняет: транзакции откатываются,
+	// история, мягкое удаление и outbox не затрагиваются.
+	srv.Close()
+	expectDryRun(mock, "contracts", len(fixtures.Contracts))
+	expectDryRun(mock, "states", 5)
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE contracts SET missing_since = NULL").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("UPDATE contracts SET missing_since = \\$2").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(99))
+	mock.ExpectExec("UPDATE contracts_history SET valid_to").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+	processedContractIDs = make(map[int64]bool)
+	if err := replayRun(context.Background(), runID, client, dbx, log, cfg, archiver, nil, nil); err != nil {
+		t.Fatalf("replayRun завершился ошибкой: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Не выполнены ожидания БД: %v", err)
+	}
+	if len(outbox.messages) != len(fixtures.Contracts)+1 {
+		t.Errorf("Воспроизведение записало в outbox %d сообщений", len(outbox.messages)-len(fixtures.Contracts)-1)
+	}
+}
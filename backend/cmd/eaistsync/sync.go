@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+
+	"github.com/ryantrue/EaistSync/pkg/api/rest"
+	"github.com/ryantrue/EaistSync/pkg/archive"
+	"github.com/ryantrue/EaistSync/pkg/config"
+	"github.com/ryantrue/EaistSync/pkg/db"
+	"github.com/ryantrue/EaistSync/pkg/documents"
+	"github.com/ryantrue/EaistSync/pkg/telegrambot"
+)
+
+// syncer выполняет синхронизацию с EAIST – по расписанию, при запуске сервиса или по команде
+// бота – не более одной одновременно, записывает запуски в журнал sync_runs и сообщает о результате.
+type syncer struct {
+	client      *rest.EAISTClient
+	dbConn      *sqlx.DB
+	log         *zap.Logger
+	cfg         *config.Config
+	files       *documents.Syncer
+	archiver    archive.Backend
+	telegramBot *telegrambot.TelegramBot
+	notifier    *telegrambot.Notifier
+
+	mu sync.Mutex
+}
+
+// Run выполняет синхронизацию, дожидаясь завершения текущей, если она уже идёт.
+func (s *syncer) Run(ctx context.Context, trigger string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.run(ctx, trigger)
+}
+
+// TryStart запускает синхронизацию в фоне; если она уже выполняется, возвращает telegrambot.ErrSyncRunning.
+func (s *syncer) TryStart(ctx context.Context, trigger string) error {
+	if !s.mu.TryLock() {
+		return telegrambot.ErrSyncRunning
+	}
+	go func() {
+		defer s.mu.Unlock()
+		s.run(ctx, trigger)
+	}()
+	return nil
+}
+
+// run записывает запуск в журнал, выполняет updateData и рассылает уведомления о результате.
+// Вызывающий удерживает s.mu.
+func (s *syncer) run(ctx context.Context, trigger string) {
+	s.log.Info("Запуск обновления данных из EAIST", zap.String("trigger", trigger))
+	start := time.Now()
+
+	runID, err := db.StartSyncRun(ctx, s.dbConn, trigger)
+	if err != nil {
+		s.log.Warn("Не удалось записать запуск синхронизации в журнал", zap.Error(err))
+	}
+	result, err := updateData(ctx, s.client, s.dbConn, s.log, s.cfg, s.files, s.archiver, false)
+	if runID != 0 {
+		var stats db.SyncRunStats
+		if result != nil {
+			stats = db.SyncRunStats{
+				Contracts:    result.Contracts,
+				NewContracts: len(result.NewContracts),
+				Removed:      len(result.Removed),
+				Rejected:     len(result.Rejected),
+			}
+		}
+		if ferr := db.FinishSyncRun(context.WithoutCancel(ctx), s.dbConn, runID, stats, err); ferr != nil {
+			s.log.Warn("Не удалось записать итог синхронизации в журнал", zap.Int64("syncRun", runID), zap.Error(ferr))
+		}
+	}
+
+	if err != nil {
+		s.log.Error("Ошибка обновления данных", zap.String("trigger", trigger), zap.Error(err))
+		if s.telegramBot != nil {
+			failure := telegrambot.SyncFailedMessage{Error: err.Error(), Trigger: trigger, Duration: time.Since(start).Round(time.Second)}
+			if chatID := s.telegramBot.ChatID(); chatID != 0 {
+				if serr := s.telegramBot.SendTemplate(ctx, chatID, telegrambot.TemplateSyncFailed, failure); serr != nil {
+					s.log.Error("Ошибка отправки уведомления об ошибке синхронизации", zap.Error(serr))
+				}
+			}
+			s.notifier.NotifySyncFailure(ctx, failure)
+		}
+		return
+	}
+	if len(result.NewContracts) == 0 {
+		s.log.Info("Обновление данных выполнено, новых контрактов не обнаружено")
+	}
+	notifyResult(ctx, s.telegramBot, s.notifier, s.log, result)
+	s.log.Info("Обновление данных прошло успешно", zap.String("trigger", trigger), zap.Duration("duration", time.Since(start)))
+}
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS contract_documents;
+DROP TABLE IF EXISTS contract_payments;
+DROP TABLE IF EXISTS contract_stages;
+DROP TABLE IF EXISTS funding_sources;
+DROP TABLE IF EXISTS okpd2;
+DROP TABLE IF EXISTS suppliers;
+DROP TABLE IF EXISTS organizations;
@@ -0,0 +1,42 @@
+-- Справочники EAIST
+CREATE TABLE IF NOT EXISTS organizations (
+    id BIGINT PRIMARY KEY,
+    data JSONB
+);
+
+CREATE TABLE IF NOT EXISTS suppliers (
+    id BIGINT PRIMARY KEY,
+    data JSONB
+);
+
+CREATE TABLE IF NOT EXISTS okpd2 (
+    id BIGINT PRIMARY KEY,
+    data JSONB
+);
+
+CREATE TABLE IF NOT EXISTS funding_sources (
+    id BIGINT PRIMARY KEY,
+    data JSONB
+);
+
+-- Дочерние сущности контрактов; contract_id вычисляется из поля contractId записи
+CREATE TABLE IF NOT EXISTS contract_stages (
+    id BIGINT PRIMARY KEY,
+    data JSONB,
+    contract_id BIGINT GENERATED ALWAYS AS ((data->>'contractId')::BIGINT) STORED
+);
+CREATE INDEX IF NOT EXISTS idx_contract_stages_contract_id ON contract_stages (contract_id);
+
+CREATE TABLE IF NOT EXISTS contract_payments (
+    id BIGINT PRIMARY KEY,
+    data JSONB,
+    contract_id BIGINT GENERATED ALWAYS AS ((data->>'contractId')::BIGINT) STORED
+);
+CREATE INDEX IF NOT EXISTS idx_contract_payments_contract_id ON contract_payments (contract_id);
+
+CREATE TABLE IF NOT EXISTS contract_documents (
+    id BIGINT PRIMARY KEY,
+    data JSONB,
+    contract_id BIGINT GENERATED ALWAYS AS ((data->>'contractId')::BIGINT) STORED
+);
+CREATE INDEX IF NOT EXISTS idx_contract_documents_contract_id ON contract_documents (contract_id);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS contract_files (
+    id SERIAL PRIMARY KEY,
+    contract_id BIGINT NOT NULL,
+    document_id BIGINT NOT NULL UNIQUE,
+    file_name VARCHAR(512) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    sha256 VARCHAR(64) NOT NULL,
+    object_key VARCHAR(1024) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_contract_files_contract_sha256 ON contract_files (contract_id, sha256);
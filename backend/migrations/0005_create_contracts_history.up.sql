@@ -0,0 +1,16 @@
+-- История контрактов (SCD2): каждая версия действует в интервале [valid_from, valid_to)
+CREATE TABLE IF NOT EXISTS contracts_history (
+    id BIGSERIAL PRIMARY KEY,
+    contract_id BIGINT NOT NULL,
+    data JSONB NOT NULL,
+    valid_from TIMESTAMP WITH TIME ZONE NOT NULL,
+    valid_to TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_contracts_history_period ON contracts_history (valid_from, valid_to);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_contracts_history_current ON contracts_history (contract_id) WHERE valid_to IS NULL;
+
+-- Текущее состояние становится первой версией истории
+INSERT INTO contracts_history (contract_id, data, valid_from)
+SELECT id, data, CURRENT_TIMESTAMP FROM contracts WHERE data IS NOT NULL
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_contracts_missing_since;
+ALTER TABLE contracts DROP COLUMN IF EXISTS missing_since;
@@ -0,0 +1,4 @@
+-- Контракты, которых нет в последней полной выборке EAIST, помечаются временем исчезновения
+ALTER TABLE contracts ADD COLUMN IF NOT EXISTS missing_since TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_contracts_missing_since ON contracts (missing_since) WHERE missing_since IS NOT NULL;
@@ -0,0 +1,9 @@
+ALTER TABLE contracts DROP COLUMN IF EXISTS content_hash, DROP COLUMN IF EXISTS first_seen_at, DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE states DROP COLUMN IF EXISTS content_hash, DROP COLUMN IF EXISTS first_seen_at, DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE organizations DROP COLUMN IF EXISTS content_hash, DROP COLUMN IF EXISTS first_seen_at, DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE suppliers DROP COLUMN IF EXISTS content_hash, DROP COLUMN IF EXISTS first_seen_at, DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE okpd2 DROP COLUMN IF EXISTS content_hash, DROP COLUMN IF EXISTS first_seen_at, DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE funding_sources DROP COLUMN IF EXISTS content_hash, DROP COLUMN IF EXISTS first_seen_at, DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE contract_stages DROP COLUMN IF EXISTS content_hash, DROP COLUMN IF EXISTS first_seen_at, DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE contract_payments DROP COLUMN IF EXISTS content_hash, DROP COLUMN IF EXISTS first_seen_at, DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE contract_documents DROP COLUMN IF EXISTS content_hash, DROP COLUMN IF EXISTS first_seen_at, DROP COLUMN IF EXISTS updated_at;
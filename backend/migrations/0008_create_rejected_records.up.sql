@@ -0,0 +1,11 @@
+-- Записи, которые не удалось сохранить при синхронизации, с причиной отказа
+CREATE TABLE IF NOT EXISTS rejected_records (
+    id BIGSERIAL PRIMARY KEY,
+    table_name TEXT NOT NULL,
+    record_id BIGINT,
+    reason TEXT NOT NULL,
+    data JSONB,
+    rejected_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_rejected_records_table_rejected_at ON rejected_records (table_name, rejected_at);
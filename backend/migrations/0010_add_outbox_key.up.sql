@@ -0,0 +1,2 @@
+-- Ключ сообщения Kafka (ID контракта) для сохранения порядка событий одного контракта
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS key TEXT;
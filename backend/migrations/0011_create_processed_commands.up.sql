@@ -0,0 +1,8 @@
+-- Входящие команды, уже обработанные сервисом; используется для устранения дубликатов по ID команды
+CREATE TABLE IF NOT EXISTS processed_commands (
+    id TEXT PRIMARY KEY,
+    type TEXT NOT NULL,
+    status TEXT NOT NULL,
+    error TEXT,
+    processed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS telegram_expiry_notices;
+DROP TABLE IF EXISTS telegram_subscriptions;
+DROP TABLE IF EXISTS telegram_links;
+DROP TABLE IF EXISTS telegram_link_codes;
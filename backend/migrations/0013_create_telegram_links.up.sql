@@ -0,0 +1,36 @@
+-- Одноразовые коды привязки Telegram-аккаунта: пользователь отправляет боту /start <code>
+CREATE TABLE IF NOT EXISTS telegram_link_codes (
+    code TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_telegram_link_codes_user_id ON telegram_link_codes (user_id);
+
+-- Привязка пользователя к чату Telegram
+CREATE TABLE IF NOT EXISTS telegram_links (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    chat_id BIGINT NOT NULL UNIQUE,
+    linked_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+-- Подписки пользователей на уведомления в Telegram
+CREATE TABLE IF NOT EXISTS telegram_subscriptions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    contract_id BIGINT,
+    days INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_telegram_subscriptions_unique
+    ON telegram_subscriptions (user_id, kind, COALESCE(contract_id, 0), COALESCE(days, 0));
+
+-- Уже отправленные напоминания об окончании контрактов, чтобы не повторять их ежедневно
+CREATE TABLE IF NOT EXISTS telegram_expiry_notices (
+    subscription_id INTEGER NOT NULL REFERENCES telegram_subscriptions(id) ON DELETE CASCADE,
+    contract_id BIGINT NOT NULL,
+    notified_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    PRIMARY KEY (subscription_id, contract_id)
+);
@@ -0,0 +1,16 @@
+-- Очередь исходящих сообщений Telegram: уведомления переживают перезапуск сервиса
+CREATE TABLE IF NOT EXISTS telegram_queue (
+    id BIGSERIAL PRIMARY KEY,
+    chat_id BIGINT NOT NULL,
+    text TEXT NOT NULL DEFAULT '',
+    parse_mode TEXT NOT NULL DEFAULT '',
+    file_name TEXT,
+    content BYTEA,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    last_error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_telegram_queue_pending ON telegram_queue (chat_id, id) WHERE status = 'pending';
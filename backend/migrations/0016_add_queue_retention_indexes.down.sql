@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_webhook_deliveries_created_at;
+DROP INDEX IF EXISTS idx_outbox_sent_at;
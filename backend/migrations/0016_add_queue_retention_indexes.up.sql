@@ -0,0 +1,3 @@
+-- Индексы для удаления старых отправленных сообщений outbox и завершённых доставок webhook
+CREATE INDEX IF NOT EXISTS idx_outbox_sent_at ON outbox (sent_at) WHERE sent_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_created_at ON webhook_deliveries (created_at) WHERE status <> 'pending';
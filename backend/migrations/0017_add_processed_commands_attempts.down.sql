@@ -0,0 +1,2 @@
+DELETE FROM processed_commands WHERE status = 'retrying';
+ALTER TABLE processed_commands DROP COLUMN IF EXISTS attempts;
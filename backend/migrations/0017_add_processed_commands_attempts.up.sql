@@ -0,0 +1,3 @@
+-- Счётчик неудачных попыток выполнить команду: команда в статусе retrying ещё повторяется,
+-- а исчерпавшая попытки отклоняется и больше не блокирует партицию топика команд
+ALTER TABLE processed_commands ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+DROP FUNCTION IF EXISTS eaist_date(TEXT);
@@ -0,0 +1,25 @@
+-- eaist_date разбирает дату из начала строки EAIST (YYYY-MM-DD...) и возвращает NULL для
+-- некорректных значений вроде 2024-13-45 вместо ошибки приведения, прерывающей весь запрос.
+-- Проверки идут отдельными IF, чтобы make_date не вызывался с недопустимым месяцем.
+CREATE OR REPLACE FUNCTION eaist_date(value TEXT) RETURNS DATE
+LANGUAGE plpgsql IMMUTABLE STRICT AS $$
+DECLARE
+    y INTEGER;
+    m INTEGER;
+    d INTEGER;
+BEGIN
+    IF value !~ '^\d{4}-\d{2}-\d{2}' THEN
+        RETURN NULL;
+    END IF;
+    y := substr(value, 1, 4)::INTEGER;
+    m := substr(value, 6, 2)::INTEGER;
+    d := substr(value, 9, 2)::INTEGER;
+    IF y < 1 OR m < 1 OR m > 12 THEN
+        RETURN NULL;
+    END IF;
+    IF d < 1 OR d > extract(DAY FROM make_date(y, m, 1) + INTERVAL '1 month - 1 day') THEN
+        RETURN NULL;
+    END IF;
+    RETURN make_date(y, m, d);
+END;
+$$;
@@ -0,0 +1,337 @@
+package rest
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// Области действия API-ключей.
+const (
+	// ScopeRead разрешает только чтение данных (GET/HEAD-запросы).
+	ScopeRead = "read"
+	// ScopeSync дополнительно разрешает запуск синхронизации.
+	ScopeSync = "sync"
+	// ScopeWebhooks разрешает управлять подписками webhook; без него это доступно только администраторам.
+	ScopeWebhooks = "webhooks"
+)
+
+// apiKeyPrefix – префикс, по которому API-ключ отличается от JWT токена.
+const apiKeyPrefix = "eaist"
+
+// Параметры генерации API-ключа.
+const (
+	apiKeyLookupLen = 8  // длина публичной части ключа (hex), используемой для поиска
+	apiKeySecretLen = 32 // длина секретной части ключа в байтах
+)
+
+// APIKeyMaxExpiry ограничивает максимальный срок действия API-ключа.
+const APIKeyMaxExpiry = 365 * 24 * time.Hour
+
+// APIKey представляет модель API-ключа в БД.
+type APIKey struct {
+	ID         int64          `db:"id" json:"id"`
+	UserID     int64          `db:"user_id" json:"user_id"`
+	Name       string         `db:"name" json:"name"`
+	Prefix     string         `db:"prefix" json:"prefix"`
+	KeyHash    string         `db:"key_hash" json:"-"`
+	Scopes     pq.StringArray `db:"scopes" json:"scopes"`
+	ExpiresAt  *time.Time     `db:"expires_at" json:"expires_at"`
+	LastUsedAt *time.Time     `db:"last_used_at" json:"last_used_at"`
+	RevokedAt  *time.Time     `db:"revoked_at" json:"revoked_at,omitempty"`
+	CreatedAt  time.Time      `db:"created_at" json:"created_at"`
+}
+
+// CreateAPIKeyInput описывает входные данные для создания API-ключа.
+type CreateAPIKeyInput struct {
+	Name          string   `json:"name" validate:"required"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+// CreateAPIKeyResponse возвращается один раз при создании ключа: полный ключ больше нигде не хранится.
+type CreateAPIKeyResponse struct {
+	Key    string `json:"key"`
+	APIKey APIKey `json:"api_key"`
+}
+
+// generateAPIKey создаёт новый ключ вида "eaist_<prefix>_<secret>" и возвращает его вместе с префиксом.
+func generateAPIKey() (key string, prefix string, err error) {
+	lookup := make([]byte, apiKeyLookupLen/2)
+	if _, err := rand.Read(lookup); err != nil {
+		return "", "", fmt.Errorf("генерация префикса ключа: %w", err)
+	}
+	secret := make([]byte, apiKeySecretLen)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", fmt.Errorf("генерация секрета ключа: %w", err)
+	}
+	prefix = hex.EncodeToString(lookup)
+	key = fmt.Sprintf("%s_%s_%s", apiKeyPrefix, prefix, hex.EncodeToString(secret))
+	return key, prefix, nil
+}
+
+// parseAPIKey извлекает префикс из ключа. Возвращает false, если строка не похожа на API-ключ.
+func parseAPIKey(key string) (prefix string, ok bool) {
+	parts := strings.Split(key, "_")
+	if len(parts) != 3 || parts[0] != apiKeyPrefix {
+		return "", false
+	}
+	if len(parts[1]) != apiKeyLookupLen || len(parts[2]) != apiKeySecretLen*2 {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// isAPIKey сообщает, имеет ли строка формат API-ключа.
+func isAPIKey(key string) bool {
+	_, ok := parseAPIKey(key)
+	return ok
+}
+
+// hashAPIKey возвращает SHA-256 хеш ключа в hex-представлении.
+// Ключи содержат 256 бит энтропии, поэтому медленный хеш (bcrypt) здесь не нужен.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeScopes проверяет список областей действия и подставляет значение по умолчанию.
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return []string{ScopeRead}, nil
+	}
+	seen := make(map[string]struct{}, len(scopes))
+	var result []string
+	for _, s := range scopes {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s != ScopeRead && s != ScopeSync && s != ScopeWebhooks {
+			return nil, fmt.Errorf("неизвестная область действия %q", s)
+		}
+		if _, ok := seen[s]; ok {
+			continue
+		}
+		seen[s] = struct{}{}
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+// HasScope сообщает, содержит ли ключ указанную область действия.
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupAPIKey ищет ключ по префиксу, сверяет хеш и проверяет, что ключ не отозван и не истёк.
+func lookupAPIKey(db *sqlx.DB, key string) (*APIKey, error) {
+	prefix, ok := parseAPIKey(key)
+	if !ok {
+		return nil, fmt.Errorf("неверный формат API-ключа")
+	}
+
+	var apiKey APIKey
+	err := db.Get(&apiKey, "SELECT * FROM api_keys WHERE prefix=$1", prefix)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("API-ключ не найден")
+		}
+		return nil, fmt.Errorf("поиск API-ключа: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(hashAPIKey(key))) != 1 {
+		return nil, fmt.Errorf("API-ключ не совпадает")
+	}
+	if apiKey.RevokedAt != nil {
+		return nil, fmt.Errorf("API-ключ отозван")
+	}
+	if apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt) {
+		return nil, fmt.Errorf("срок действия API-ключа истёк")
+	}
+	return &apiKey, nil
+}
+
+// authenticateAPIKey проверяет ключ (см. lookupAPIKey) и отмечает его использование.
+// Для пользователя-владельца возвращается его роль и имя.
+func authenticateAPIKey(db *sqlx.DB, key string) (*APIKey, *User, error) {
+	apiKey, err := lookupAPIKey(db, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var user User
+	if err := db.Get(&user, "SELECT * FROM users WHERE id=$1", apiKey.UserID); err != nil {
+		return nil, nil, fmt.Errorf("поиск владельца API-ключа: %w", err)
+	}
+
+	// Отметку об использовании обновляем без ожидания: её отсутствие не мешает авторизации.
+	_, _ = db.Exec("UPDATE api_keys SET last_used_at = NOW() WHERE id=$1", apiKey.ID)
+
+	return apiKey, &user, nil
+}
+
+// apiKeyClaims формирует claims, аналогичные JWT, для запросов, авторизованных API-ключом.
+func apiKeyClaims(apiKey *APIKey, user *User) jwt.MapClaims {
+	scopes := make([]interface{}, 0, len(apiKey.Scopes))
+	for _, s := range apiKey.Scopes {
+		scopes = append(scopes, s)
+	}
+	return jwt.MapClaims{
+		"user_id":    user.ID,
+		"username":   user.Username,
+		"role":       user.Role,
+		"api_key_id": apiKey.ID,
+		"scopes":     scopes,
+	}
+}
+
+// userIDFromContext извлекает идентификатор пользователя из claims, сохранённых middleware.
+func userIDFromContext(c echo.Context) (int64, bool) {
+	claims, ok := c.Get("user").(jwt.MapClaims)
+	if !ok {
+		return 0, false
+	}
+	switch v := claims["user_id"].(type) {
+	case float64:
+		return int64(v), true
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// UserIDFromContext возвращает идентификатор пользователя запроса, авторизованного JWTMiddleware.
+func UserIDFromContext(c echo.Context) (int64, bool) {
+	return userIDFromContext(c)
+}
+
+// isAPIKeyRequest сообщает, был ли запрос авторизован API-ключом.
+func isAPIKeyRequest(c echo.Context) bool {
+	claims, ok := c.Get("user").(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+	_, ok = claims["api_key_id"]
+	return ok
+}
+
+// CreateAPIKeyHandler создаёт новый API-ключ для текущего пользователя.
+func CreateAPIKeyHandler(db *sqlx.DB, log *zap.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := userIDFromContext(c)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Неавторизованный доступ"})
+		}
+		// Ключи управляются только из профиля пользователя, но не другими ключами.
+		if isAPIKeyRequest(c) {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "Создание ключей через API-ключ запрещено"})
+		}
+
+		var input CreateAPIKeyInput
+		if err := c.Bind(&input); err != nil {
+			log.Error("Ошибка парсинга данных API-ключа", zap.Error(err))
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Неверные входные данные"})
+		}
+		input.Name = strings.TrimSpace(input.Name)
+		if input.Name == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Имя ключа обязательно"})
+		}
+		scopes, err := normalizeScopes(input.Scopes)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+
+		expiry := time.Duration(input.ExpiresInDays) * 24 * time.Hour
+		if input.ExpiresInDays <= 0 || expiry > APIKeyMaxExpiry {
+			expiry = APIKeyMaxExpiry
+		}
+		expiresAt := time.Now().Add(expiry)
+
+		key, prefix, err := generateAPIKey()
+		if err != nil {
+			log.Error("Ошибка генерации API-ключа", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Ошибка создания ключа"})
+		}
+
+		query := `
+			INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id, created_at
+		`
+		apiKey := APIKey{
+			UserID:    userID,
+			Name:      input.Name,
+			Prefix:    prefix,
+			Scopes:    scopes,
+			ExpiresAt: &expiresAt,
+		}
+		err = db.QueryRowx(query, userID, input.Name, prefix, hashAPIKey(key), pq.StringArray(scopes), expiresAt).
+			Scan(&apiKey.ID, &apiKey.CreatedAt)
+		if err != nil {
+			log.Error("Ошибка сохранения API-ключа", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Ошибка БД"})
+		}
+
+		return c.JSON(http.StatusCreated, CreateAPIKeyResponse{Key: key, APIKey: apiKey})
+	}
+}
+
+// ListAPIKeysHandler возвращает API-ключи текущего пользователя (без секретов).
+func ListAPIKeysHandler(db *sqlx.DB, log *zap.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := userIDFromContext(c)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Неавторизованный доступ"})
+		}
+		keys := []APIKey{}
+		if err := db.Select(&keys, "SELECT * FROM api_keys WHERE user_id=$1 ORDER BY id", userID); err != nil {
+			log.Error("Ошибка получения API-ключей", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Ошибка БД"})
+		}
+		return c.JSON(http.StatusOK, keys)
+	}
+}
+
+// RevokeAPIKeyHandler отзывает API-ключ текущего пользователя.
+func RevokeAPIKeyHandler(db *sqlx.DB, log *zap.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := userIDFromContext(c)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Неавторизованный доступ"})
+		}
+		if isAPIKeyRequest(c) {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "Отзыв ключей через API-ключ запрещён"})
+		}
+		keyID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Неверный идентификатор ключа"})
+		}
+
+		res, err := db.Exec("UPDATE api_keys SET revoked_at = NOW() WHERE id=$1 AND user_id=$2 AND revoked_at IS NULL", keyID, userID)
+		if err != nil {
+			log.Error("Ошибка отзыва API-ключа", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Ошибка БД"})
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Ключ не найден"})
+		}
+		return c.JSON(http.StatusOK, map[string]string{"message": "Ключ отозван"})
+	}
+}
@@ -0,0 +1,217 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ryantrue/EaistSync/pkg/config"
+	"github.com/ryantrue/EaistSync/pkg/middleware"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+func TestGenerateAndParseAPIKey(t *testing.T) {
+	key, prefix, err := generateAPIKey()
+	if err != nil {
+		t.Fatalf("Ошибка генерации ключа: %v", err)
+	}
+	got, ok := parseAPIKey(key)
+	if !ok {
+		t.Fatalf("Сгенерированный ключ %q не распознан", key)
+	}
+	if got != prefix {
+		t.Errorf("Префикс = %q, ожидался %q", got, prefix)
+	}
+	if isAPIKey("eyJhbGciOiJIUzI1NiJ9.e30.sig") {
+		t.Error("JWT токен распознан как API-ключ")
+	}
+}
+
+func TestNormalizeScopes(t *testing.T) {
+	scopes, err := normalizeScopes(nil)
+	if err != nil || len(scopes) != 1 || scopes[0] != ScopeRead {
+		t.Errorf("По умолчанию ожидалась область read, получено %v (%v)", scopes, err)
+	}
+	scopes, err = normalizeScopes([]string{"Sync", "read", "sync"})
+	if err != nil || len(scopes) != 2 {
+		t.Errorf("Ожидались две уникальные области, получено %v (%v)", scopes, err)
+	}
+	if _, err := normalizeScopes([]string{"admin"}); err == nil {
+		t.Error("Ожидалась ошибка для неизвестной области")
+	}
+}
+
+func TestJWTMiddlewareAPIKey(t *testing.T) {
+	key, prefix, err := generateAPIKey()
+	if err != nil {
+		t.Fatalf("Ошибка генерации ключа: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		header   string
+		scopes   string
+		wantCode int
+	}{
+		{name: "чтение через X-API-Key", method: http.MethodGet, header: "X-API-Key", scopes: "{read}", wantCode: http.StatusOK},
+		{name: "чтение через Bearer", method: http.MethodGet, header: "Authorization", scopes: "{read}", wantCode: http.StatusOK},
+		{name: "запись ключом read", method: http.MethodPost, header: "X-API-Key", scopes: "{read}", wantCode: http.StatusForbidden},
+		{name: "запись ключом sync", method: http.MethodPost, header: "X-API-Key", scopes: "{read,sync}", wantCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Ошибка создания sqlmock: %v", err)
+			}
+			defer db.Close()
+			sqlxDB := sqlx.NewDb(db, "sqlmock")
+			logger, _ := zap.NewDevelopment()
+
+			keyRows := sqlmock.NewRows([]string{"id", "user_id", "name", "prefix", "key_hash", "scopes", "expires_at", "last_used_at", "revoked_at", "created_at"}).
+				AddRow(1, 7, "script", prefix, hashAPIKey(key), tt.scopes, time.Now().Add(time.Hour), nil, nil, time.Now())
+			mock.ExpectQuery("SELECT \\* FROM api_keys WHERE prefix=\\$1").WithArgs(prefix).WillReturnRows(keyRows)
+			userRows := sqlmock.NewRows([]string{"id", "username", "hashed_password", "role", "created_at", "updated_at"}).
+				AddRow(7, "robot", "x", "user", time.Now(), time.Now())
+			mock.ExpectQuery("SELECT \\* FROM users WHERE id=\\$1").WithArgs(int64(7)).WillReturnRows(userRows)
+			mock.ExpectExec("UPDATE api_keys SET last_used_at").WillReturnResult(sqlmock.NewResult(0, 1))
+
+			e := echo.New()
+			req := httptest.NewRequest(tt.method, "/api/contracts", nil)
+			if tt.header == "Authorization" {
+				req.Header.Set("Authorization", "Bearer "+key)
+			} else {
+				req.Header.Set("X-API-Key", key)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			mw := JWTMiddleware(&config.Config{JWTSecret: "test-secret"}, sqlxDB, logger)
+			handler := mw(func(c echo.Context) error {
+				if uid, ok := userIDFromContext(c); !ok || uid != 7 {
+					t.Errorf("user_id в контексте = %v, ожидался 7", uid)
+				}
+				return c.NoContent(http.StatusOK)
+			})
+			if err := handler(c); err != nil {
+				t.Fatalf("Обработчик вернул ошибку: %v", err)
+			}
+			if rec.Code != tt.wantCode {
+				t.Errorf("Статус = %d, ожидался %d", rec.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestAdminOrScopeMiddleware(t *testing.T) {
+	cfg := &config.Config{JWTSecret: "test-secret"}
+	key, prefix, err := generateAPIKey()
+	if err != nil {
+		t.Fatalf("Ошибка генерации ключа: %v", err)
+	}
+	signed := func(role string) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": 7, "role": role}).SignedString([]byte(cfg.JWTSecret))
+		if err != nil {
+			t.Fatalf("Ошибка подписи токена: %v", err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		scopes   string // области API-ключа; пусто – запрос с JWT
+		only     bool   // проверяется AdminMiddleware
+		wantCode int
+	}{
+		{name: "JWT пользователя", token: signed("user"), wantCode: http.StatusForbidden},
+		{name: "JWT администратора", token: signed(RoleAdmin), wantCode: http.StatusOK},
+		{name: "ключ без области webhooks", token: key, scopes: "{read,sync}", wantCode: http.StatusForbidden},
+		{name: "ключ с областью webhooks", token: key, scopes: "{webhooks}", wantCode: http.StatusOK},
+		{name: "ключ администратора без области", token: key, scopes: "{read,sync}", only: true, wantCode: http.StatusForbidden},
+		{name: "JWT администратора без области", token: signed(RoleAdmin), only: true, wantCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Ошибка создания sqlmock: %v", err)
+			}
+			defer db.Close()
+			if tt.scopes != "" {
+				mock.ExpectQuery("SELECT \\* FROM api_keys WHERE prefix=\\$1").WithArgs(prefix).WillReturnRows(
+					sqlmock.NewRows([]string{"id", "user_id", "name", "prefix", "key_hash", "scopes", "expires_at", "last_used_at", "revoked_at", "created_at"}).
+						AddRow(1, 7, "script", prefix, hashAPIKey(key), tt.scopes, time.Now().Add(time.Hour), nil, nil, time.Now()))
+				mock.ExpectQuery("SELECT \\* FROM users WHERE id=\\$1").WithArgs(int64(7)).WillReturnRows(
+					sqlmock.NewRows([]string{"id", "username", "hashed_password", "role", "created_at", "updated_at"}).
+						AddRow(7, "robot", "x", RoleAdmin, time.Now(), time.Now()))
+				mock.ExpectExec("UPDATE api_keys SET last_used_at").WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/api/webhooks", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+
+			mw := AdminOrScopeMiddleware(cfg, sqlx.NewDb(db, "sqlmock"), zap.NewNop(), ScopeWebhooks)
+			if tt.only {
+				mw = AdminMiddleware(cfg, sqlx.NewDb(db, "sqlmock"), zap.NewNop())
+			}
+			handler := mw(func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+			if err := handler(e.NewContext(req, rec)); err != nil {
+				t.Fatalf("Обработчик вернул ошибку: %v", err)
+			}
+			if rec.Code != tt.wantCode {
+				t.Errorf("Статус = %d, ожидался %d", rec.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRateLimitPrincipal(t *testing.T) {
+	key, prefix, err := generateAPIKey()
+	if err != nil {
+		t.Fatalf("Ошибка генерации ключа: %v", err)
+	}
+	forged, _, _ := generateAPIKey()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Ошибка создания sqlmock: %v", err)
+	}
+	defer db.Close()
+	principal := RateLimitPrincipal(&config.Config{JWTSecret: "test-secret"}, sqlx.NewDb(db, "sqlmock"))
+	columns := []string{"id", "user_id", "name", "prefix", "key_hash", "scopes", "expires_at", "last_used_at", "revoked_at", "created_at"}
+
+	do := func(token string) middleware.Principal {
+		req := httptest.NewRequest(http.MethodGet, "/api/contracts", nil)
+		req.Header.Set("X-API-Key", token)
+		req.RemoteAddr = "192.0.2.1:1234"
+		return principal(echo.New().NewContext(req, httptest.NewRecorder()))
+	}
+
+	mock.ExpectQuery("SELECT \\* FROM api_keys WHERE prefix=\\$1").WithArgs(prefix).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(1, 7, "script", prefix, hashAPIKey(key), "{read}", nil, nil, nil, time.Now()))
+	if p := do(key); p.Kind != middleware.PrincipalAPIKey || p.ID != prefix {
+		t.Errorf("Действующий ключ: клиент %+v", p)
+	}
+
+	// Ключ, которого нет в БД, лимитируется по IP.
+	forgedPrefix, _ := parseAPIKey(forged)
+	mock.ExpectQuery("SELECT \\* FROM api_keys WHERE prefix=\\$1").WithArgs(forgedPrefix).
+		WillReturnRows(sqlmock.NewRows(columns))
+	if p := do(forged); p.Kind != middleware.PrincipalAnonymous || p.ID != "192.0.2.1" {
+		t.Errorf("Поддельный ключ: клиент %+v", p)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
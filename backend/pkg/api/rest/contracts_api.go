@@ -1,15 +1,13 @@
 package rest
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/ryantrue/EaistSync/pkg/config"
-	"io"
-	"net/http"
 	"sort"
 	"sync"
+	"time"
 
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
@@ -21,10 +19,27 @@ type apiResponse struct {
 	Count int                      `json:"count"`
 }
 
+// PartialFetchError возвращается вместе с загруженными контрактами, если часть страниц
+// не удалось получить даже после повторных проходов.
+type PartialFetchError struct {
+	FailedPages []int
+	Err         error
+}
+
+func (e *PartialFetchError) Error() string {
+	return fmt.Sprintf("не загружены страницы %v: %v", e.FailedPages, e.Err)
+}
+
+func (e *PartialFetchError) Unwrap() error {
+	return e.Err
+}
+
 // FetchAllContracts загружает все контракты параллельно и устраняет дубликаты по полю id.
-func FetchAllContracts(ctx context.Context, client *http.Client, log *zap.Logger, cfg *config.Config) ([]map[string]interface{}, error) {
+// Страницы, не загруженные с первого раза, повторно запрашиваются по отдельности; если часть из них
+// так и не удалось получить, возвращаются загруженные контракты и ошибка *PartialFetchError.
+func FetchAllContracts(ctx context.Context, client *EAISTClient, log *zap.Logger, cfg *config.Config) ([]map[string]interface{}, error) {
 	// Первый запрос для получения первой страницы и общего количества контрактов
-	firstPage, totalCount, err := fetchContractsPage(ctx, client, 0, cfg.PageSize, true, cfg.ContractsURL)
+	firstPage, totalCount, err := fetchContractsPage(ctx, client, 0, cfg.PageSize, true)
 	if err != nil {
 		return nil, err
 	}
@@ -33,11 +48,7 @@ func FetchAllContracts(ctx context.Context, client *http.Client, log *zap.Logger
 	var contracts sync.Map
 
 	// Сохраняем результаты первой страницы
-	for _, item := range firstPage {
-		if id, ok := extractID(item); ok {
-			contracts.Store(id, item)
-		}
-	}
+	storePage(&contracts, firstPage)
 
 	// Если страниц всего одна, возвращаем результат
 	pages := (totalCount + cfg.PageSize - 1) / cfg.PageSize
@@ -47,47 +58,104 @@ func FetchAllContracts(ctx context.Context, client *http.Client, log *zap.Logger
 
 	log.Info("Всего контрактов согласно API", zap.Int("totalCount", totalCount), zap.Int("pages", pages))
 
-	eg, ctx := errgroup.WithContext(ctx)
+	pending := make([]int, 0, pages-1)
+	for i := 1; i < pages; i++ {
+		pending = append(pending, i)
+	}
+
+	var lastErr error
+	for round := 0; round <= cfg.PageRetryRounds && len(pending) > 0; round++ {
+		if round > 0 {
+			log.Warn("Повторная загрузка страниц", zap.Int("round", round), zap.Ints("pages", pending))
+			select {
+			case <-ctx.Done():
+				return syncMapToSlice(&contracts), &PartialFetchError{FailedPages: pending, Err: ctx.Err()}
+			case <-time.After(cfg.EAISTRetryBaseDelay * time.Duration(round)):
+			}
+		}
+		pending, lastErr = fetchPages(ctx, client, log, cfg, pending, &contracts)
+	}
+
+	if len(pending) > 0 {
+		return syncMapToSlice(&contracts), &PartialFetchError{FailedPages: pending, Err: lastErr}
+	}
+	return syncMapToSlice(&contracts), nil
+}
+
+// fetchPages параллельно загружает указанные страницы и возвращает номера страниц,
+// которые загрузить не удалось, вместе с последней ошибкой.
+func fetchPages(ctx context.Context, client *EAISTClient, log *zap.Logger, cfg *config.Config, pages []int, contracts *sync.Map) ([]int, error) {
+	var (
+		mu      sync.Mutex
+		failed  []int
+		lastErr error
+	)
+
+	eg, egCtx := errgroup.WithContext(ctx)
 	sem := semaphore.NewWeighted(int64(cfg.MaxConcurrency))
 
-	// Запускаем параллельную загрузку остальных страниц
-	for i := 1; i < pages; i++ {
-		pageIndex := i // создаём копию переменной для замыкания
-		if err := sem.Acquire(ctx, 1); err != nil {
-			return nil, err
+	// Запускаем параллельную загрузку страниц
+	for _, pageIndex := range pages {
+		pageIndex := pageIndex // создаём копию переменной для замыкания
+		if err := sem.Acquire(egCtx, 1); err != nil {
+			mu.Lock()
+			failed = append(failed, pageIndex)
+			lastErr = err
+			mu.Unlock()
+			continue
 		}
 		eg.Go(func() error {
 			defer sem.Release(1)
 			skip := pageIndex * cfg.PageSize
-			pageItems, _, err := fetchContractsPage(ctx, client, skip, cfg.PageSize, false, cfg.ContractsURL)
+			pageItems, _, err := fetchContractsPage(egCtx, client, skip, cfg.PageSize, false)
 			if err != nil {
-				return fmt.Errorf("страница %d: %v", pageIndex, err)
-			}
-			for _, item := range pageItems {
-				if id, ok := extractID(item); ok {
-					contracts.Store(id, item)
-				}
+				log.Warn("Не удалось загрузить страницу", zap.Int("page", pageIndex), zap.Error(err))
+				mu.Lock()
+				failed = append(failed, pageIndex)
+				lastErr = fmt.Errorf("страница %d: %w", pageIndex, err)
+				mu.Unlock()
+				return nil
 			}
+			storePage(contracts, pageItems)
 			return nil
 		})
 	}
 
-	// Ожидаем завершения всех горутин
-	if err := eg.Wait(); err != nil {
-		return nil, err
+	// Ожидаем завершения всех горутин; ошибки страниц не прерывают остальные загрузки
+	_ = eg.Wait()
+	sort.Ints(failed)
+	return failed, lastErr
+}
+
+// storePage сохраняет элементы страницы в sync.Map по их id.
+func storePage(contracts *sync.Map, items []map[string]interface{}) {
+	for _, item := range items {
+		if id, ok := extractID(item); ok {
+			contracts.Store(id, item)
+		}
 	}
-	return syncMapToSlice(&contracts), nil
 }
 
 // fetchContractsPage выполняет запрос для получения страницы контрактов.
-func fetchContractsPage(ctx context.Context, client *http.Client, skip, take int, withCount bool, contractsURL string) ([]map[string]interface{}, int, error) {
+func fetchContractsPage(ctx context.Context, client *EAISTClient, skip, take int, withCount bool) ([]map[string]interface{}, int, error) {
 	body := buildRequestBody(skip, take, withCount)
-	return postItems(ctx, client, contractsURL, body)
+	return postItems(ctx, client, config.EndpointContracts, body)
 }
 
-// buildRequestBody формирует тело запроса.
-func buildRequestBody(skip, take int, withCount bool) map[string]interface{} {
-	filter := map[string]interface{}{
+// FetchContracts загружает контракты по фильтру по умолчанию, дополненному overrides
+// (например, другим customerId или id конкретного контракта).
+func FetchContracts(ctx context.Context, client *EAISTClient, cfg *config.Config, overrides map[string]interface{}) ([]map[string]interface{}, error) {
+	filter := contractsFilter()
+	for k, v := range overrides {
+		filter[k] = v
+	}
+	e := Entity{Name: "contracts", Endpoint: config.EndpointContracts, Paged: true}
+	return fetchFiltered(ctx, client, e, filter, cfg.PageSize)
+}
+
+// contractsFilter возвращает фильтр контрактов по умолчанию.
+func contractsFilter() map[string]interface{} {
+	return map[string]interface{}{
 		"customerId":   7884,
 		"is44F3":       true,
 		"is94F3":       false,
@@ -96,8 +164,12 @@ func buildRequestBody(skip, take int, withCount bool) map[string]interface{} {
 		"isOkpdChilds": false,
 		"states":       []int{7, 1, 9, 5, 15, 4, 10, 3, 2, 1001, 1002, 12, 11, 5010},
 	}
+}
+
+// buildRequestBody формирует тело запроса.
+func buildRequestBody(skip, take int, withCount bool) map[string]interface{} {
 	return map[string]interface{}{
-		"filter":    filter,
+		"filter":    contractsFilter(),
 		"order":     []map[string]interface{}{{"field": "id", "desc": true}},
 		"skip":      skip,
 		"take":      take,
@@ -105,32 +177,16 @@ func buildRequestBody(skip, take int, withCount bool) map[string]interface{} {
 	}
 }
 
-// postItems — универсальная функция для POST-запросов с JSON телом.
-func postItems(ctx context.Context, client *http.Client, url string, reqBody map[string]interface{}) ([]map[string]interface{}, int, error) {
+// postItems — универсальная функция для POST-запросов с JSON телом к эндпоинту EAIST.
+func postItems(ctx context.Context, client *EAISTClient, endpoint string, reqBody map[string]interface{}) ([]map[string]interface{}, int, error) {
 	data, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, 0, fmt.Errorf("marshal request body: %v", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(data))
-	if err != nil {
-		return nil, 0, fmt.Errorf("newRequest %s: %v", url, err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Requested-With", "XMLHttpRequest")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, 0, fmt.Errorf("post %s: %v", url, err)
-	}
-	defer resp.Body.Close()
-
-	respBytes, err := io.ReadAll(resp.Body)
+	respBytes, err := client.PostJSON(ctx, endpoint, data)
 	if err != nil {
-		return nil, 0, fmt.Errorf("reading response: %v", err)
-	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, 0, fmt.Errorf("код=%d, тело=%s", resp.StatusCode, string(respBytes))
+		return nil, 0, err
 	}
 
 	var result apiResponse
@@ -0,0 +1,40 @@
+package rest
+
+import "context"
+
+// ResponseRecorder сохраняет сырые ответы EAIST (реализуется archive.Recorder).
+type ResponseRecorder interface {
+	Record(ctx context.Context, endpoint string, request, response []byte) error
+}
+
+// ResponseSource подменяет обращения к EAIST сохранёнными ответами (реализуется archive.Replayer).
+type ResponseSource interface {
+	Response(ctx context.Context, endpoint string, request []byte) ([]byte, error)
+}
+
+type recorderKey struct{}
+
+type replayKey struct{}
+
+// WithRecorder возвращает контекст, в котором успешные ответы PostJSON сохраняются в rec.
+func WithRecorder(ctx context.Context, rec ResponseRecorder) context.Context {
+	return context.WithValue(ctx, recorderKey{}, rec)
+}
+
+// WithReplay возвращает контекст, в котором PostJSON отдаёт ответы из src без обращения к EAIST,
+// а авторизация не выполняется.
+func WithReplay(ctx context.Context, src ResponseSource) context.Context {
+	return context.WithValue(ctx, replayKey{}, src)
+}
+
+// recorderFromContext возвращает ResponseRecorder из контекста, если он задан.
+func recorderFromContext(ctx context.Context) ResponseRecorder {
+	rec, _ := ctx.Value(recorderKey{}).(ResponseRecorder)
+	return rec
+}
+
+// replayFromContext возвращает ResponseSource из контекста, если он задан.
+func replayFromContext(ctx context.Context) ResponseSource {
+	src, _ := ctx.Value(replayKey{}).(ResponseSource)
+	return src
+}
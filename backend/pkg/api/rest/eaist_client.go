@@ -0,0 +1,417 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ryantrue/EaistSync/pkg/config"
+)
+
+// ErrCircuitOpen возвращается, пока circuit breaker разомкнут и запросы к EAIST не выполняются.
+var ErrCircuitOpen = errors.New("circuit breaker разомкнут: EAIST временно недоступен")
+
+// ErrSessionExpired возвращается, если EAIST отклонил запрос из-за истёкшей сессии
+// (401/403 или перенаправление на страницу входа).
+var ErrSessionExpired = errors.New("сессия EAIST истекла")
+
+// reloginsTotal – количество повторных авторизаций в EAIST, доступное через /debug/vars.
+var reloginsTotal = expvar.NewInt("eaist_relogins_total")
+
+// HTTPStatusError описывает ответ EAIST с кодом, отличным от 200.
+type HTTPStatusError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("код=%d, тело=%s", e.StatusCode, e.Body)
+}
+
+// retryable сообщает, имеет ли смысл повторять запрос с таким кодом ответа.
+func (e *HTTPStatusError) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// RetryPolicy задаёт параметры повторных попыток.
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// backoff возвращает задержку перед повтором номер attempt (с нуля) по схеме "full jitter".
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay << uint(attempt)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// EAISTClient – общий HTTP-клиент для запросов к EAIST с повторами и circuit breaker.
+// При истечении сессии клиент один раз повторно авторизуется и повторяет запрос.
+type EAISTClient struct {
+	http     *http.Client
+	cfg      *config.Config
+	log      *zap.Logger
+	retry    RetryPolicy
+	breaker  *circuitBreaker
+	throttle *throttler
+
+	loginMu    sync.Mutex
+	sessionGen uint64 // увеличивается при каждой успешной авторизации; защищено loginMu
+	relogins   atomic.Int64
+}
+
+// NewEAISTClient оборачивает http.Client (с CookieJar для сессии EAIST) политиками устойчивости из конфигурации.
+func NewEAISTClient(httpClient *http.Client, cfg *config.Config, log *zap.Logger) *EAISTClient {
+	return &EAISTClient{
+		http: httpClient,
+		cfg:  cfg,
+		log:  log,
+		retry: RetryPolicy{
+			MaxRetries: cfg.EAISTMaxRetries,
+			BaseDelay:  cfg.EAISTRetryBaseDelay,
+			MaxDelay:   cfg.EAISTRetryMaxDelay,
+		},
+		breaker:  newCircuitBreaker(cfg.EAISTBreakerThreshold, cfg.EAISTBreakerCooldown),
+		throttle: newThrottler(cfg, log),
+	}
+}
+
+// Login авторизуется в EAIST; cookie сессии сохраняются в CookieJar клиента.
+func (c *EAISTClient) Login(ctx context.Context) error {
+	if replayFromContext(ctx) != nil {
+		return nil
+	}
+	c.loginMu.Lock()
+	defer c.loginMu.Unlock()
+	return c.loginLocked(ctx)
+}
+
+// loginLocked выполняет авторизацию; вызывающий должен удерживать loginMu.
+func (c *EAISTClient) loginLocked(ctx context.Context) error {
+	body := map[string]interface{}{
+		"username": c.cfg.Username,
+		"password": c.cfg.Password,
+		"remember": true,
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("marshal login body: %v", err)
+	}
+	url, err := c.cfg.EAIST.URL(config.EndpointLogin)
+	if err != nil {
+		return err
+	}
+	if _, err := c.doWithRetry(ctx, http.MethodPost, config.EndpointLogin, url, data); err != nil {
+		if errors.Is(err, ErrSessionExpired) {
+			return fmt.Errorf("EAIST отклонил учётные данные: %w", err)
+		}
+		return err
+	}
+	c.sessionGen++
+	return nil
+}
+
+// generation возвращает номер текущей сессии.
+func (c *EAISTClient) generation() uint64 {
+	c.loginMu.Lock()
+	defer c.loginMu.Unlock()
+	return c.sessionGen
+}
+
+// relogin повторно авторизуется, если с момента начала запроса (сессия gen) этого ещё никто не сделал.
+// Параллельные запросы, получившие отказ одновременно, выполняют только одну авторизацию.
+func (c *EAISTClient) relogin(ctx context.Context, gen uint64) error {
+	c.loginMu.Lock()
+	defer c.loginMu.Unlock()
+	if c.sessionGen != gen {
+		return nil
+	}
+	c.log.Warn("Сессия EAIST истекла, выполняется повторная авторизация")
+	if err := c.loginLocked(ctx); err != nil {
+		return fmt.Errorf("повторная авторизация: %w", err)
+	}
+	c.relogins.Add(1)
+	reloginsTotal.Add(1)
+	return nil
+}
+
+// Relogins возвращает количество повторных авторизаций, выполненных этим клиентом.
+func (c *EAISTClient) Relogins() int64 {
+	return c.relogins.Load()
+}
+
+// PostJSON выполняет POST-запрос с JSON телом к эндпоинту из реестра config.EAISTEndpoints
+// и возвращает тело успешного ответа. Имя эндпоинта также определяет его бюджет запросов.
+// Если сессия EAIST истекла, клиент однократно авторизуется заново и повторяет запрос.
+// Контекст может задавать архивирование ответов (WithRecorder) или воспроизведение из архива (WithReplay).
+func (c *EAISTClient) PostJSON(ctx context.Context, endpoint string, body []byte) ([]byte, error) {
+	if src := replayFromContext(ctx); src != nil {
+		return src.Response(ctx, endpoint, body)
+	}
+	url, err := c.cfg.EAIST.URL(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	respBytes, err := c.call(ctx, http.MethodPost, endpoint, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if rec := recorderFromContext(ctx); rec != nil {
+		// Ошибка архивирования не должна прерывать синхронизацию.
+		if err := rec.Record(ctx, endpoint, body, respBytes); err != nil {
+			c.log.Warn("Не удалось сохранить ответ EAIST в архив", zap.String("endpoint", endpoint), zap.Error(err))
+		}
+	}
+	return respBytes, nil
+}
+
+// Download загружает файл GET-запросом к эндпоинту из реестра; подстановка {id} в пути
+// эндпоинта заменяется идентификатором id. Повторы и повторная авторизация – как в PostJSON.
+func (c *EAISTClient) Download(ctx context.Context, endpoint, id string) ([]byte, error) {
+	if replayFromContext(ctx) != nil {
+		return nil, fmt.Errorf("загрузка файлов недоступна при воспроизведении из архива")
+	}
+	rawURL, err := c.cfg.EAIST.URL(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	rawURL = strings.ReplaceAll(rawURL, "{id}", neturl.PathEscape(id))
+	return c.call(ctx, http.MethodGet, endpoint, rawURL, nil)
+}
+
+// call выполняет запрос с повторами и однократной повторной авторизацией при истечении сессии.
+func (c *EAISTClient) call(ctx context.Context, method, endpoint, url string, body []byte) ([]byte, error) {
+	gen := c.generation()
+	respBytes, err := c.doWithRetry(ctx, method, endpoint, url, body)
+	if !errors.Is(err, ErrSessionExpired) {
+		return respBytes, err
+	}
+	if err := c.relogin(ctx, gen); err != nil {
+		return nil, err
+	}
+	return c.doWithRetry(ctx, method, endpoint, url, body)
+}
+
+// doWithRetry выполняет запрос с повторами, соблюдая лимиты частоты запросов.
+// Сетевые ошибки, 5xx и 429 повторяются с экспоненциальной задержкой; заголовок Retry-After учитывается.
+func (c *EAISTClient) doWithRetry(ctx context.Context, method, endpoint, url string, body []byte) ([]byte, error) {
+	var lastErr error
+	for attempt := 0; attempt <= c.retry.MaxRetries; attempt++ {
+		if err := c.breaker.allow(); err != nil {
+			return nil, err
+		}
+		if err := c.throttle.wait(ctx, endpoint); err != nil {
+			c.breaker.release()
+			return nil, err
+		}
+
+		start := time.Now()
+		respBytes, err := c.doOnce(ctx, method, url, body)
+		var statusErr *HTTPStatusError
+		isStatus := errors.As(err, &statusErr)
+		c.throttle.observe(time.Since(start),
+			err != nil && ctx.Err() == nil && (!isStatus || statusErr.retryable()),
+			isStatus && statusErr.StatusCode == http.StatusTooManyRequests)
+
+		if err == nil {
+			c.breaker.success()
+			return respBytes, nil
+		}
+		lastErr = err
+
+		if ctx.Err() != nil || errors.Is(err, ErrSessionExpired) || (isStatus && !statusErr.retryable()) {
+			// Ошибки клиента (4xx), истёкшая сессия и отмена контекста не говорят о недоступности EAIST.
+			c.breaker.release()
+			return nil, err
+		}
+		c.breaker.failure()
+
+		if attempt == c.retry.MaxRetries {
+			break
+		}
+		delay := c.retry.backoff(attempt)
+		if isStatus && statusErr.RetryAfter > 0 {
+			delay = min(statusErr.RetryAfter, c.retry.MaxDelay)
+		}
+		c.log.Warn("Повтор запроса к EAIST",
+			zap.String("url", url),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("delay", delay),
+			zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+	return nil, fmt.Errorf("запрос %s не выполнен после %d попыток: %w", url, c.retry.MaxRetries+1, lastErr)
+}
+
+// doOnce выполняет одну попытку запроса.
+func (c *EAISTClient) doOnce(ctx context.Context, method, url string, body []byte) ([]byte, error) {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("newRequest %s: %v", url, err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", strings.ToLower(method), url, err)
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+	if isSessionExpired(req, resp) {
+		return nil, fmt.Errorf("%w: код=%d, адрес=%s", ErrSessionExpired, resp.StatusCode, resp.Request.URL)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HTTPStatusError{
+			StatusCode: resp.StatusCode,
+			Body:       string(respBytes),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+	return respBytes, nil
+}
+
+// isSessionExpired определяет отказ из-за истёкшей сессии: 401/403 или перенаправление
+// (которое http.Client выполняет автоматически) на страницу входа.
+func isSessionExpired(req *http.Request, resp *http.Response) bool {
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return true
+	}
+	final := resp.Request.URL
+	return final.Path != req.URL.Path && strings.Contains(strings.ToLower(final.Path), "login")
+}
+
+// parseRetryAfter разбирает заголовок Retry-After в виде числа секунд или HTTP-даты.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// Состояния circuit breaker.
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker размыкается после threshold подряд неудачных запросов и
+// после cooldown пропускает один пробный запрос (half-open).
+type circuitBreaker struct {
+	mu        sync.Mutex
+	state     int
+	failures  int
+	threshold int
+	cooldown  time.Duration
+	openedAt  time.Time
+	probing   bool
+}
+
+// newCircuitBreaker создаёт circuit breaker; threshold <= 0 отключает его.
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow проверяет, можно ли выполнить запрос.
+func (b *circuitBreaker) allow() error {
+	if b.threshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return nil
+	case breakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// success фиксирует успешный запрос и замыкает breaker.
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = breakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// release завершает запрос, который не говорит ни о доступности, ни о недоступности EAIST
+// (отмена, ошибка клиента, истёкшая сессия): пробный запрос полуоткрытого breaker освобождается,
+// и следующий запрос снова становится пробным.
+func (b *circuitBreaker) release() {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// failure фиксирует неудачный запрос и при превышении порога размыкает breaker.
+func (b *circuitBreaker) failure() {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
@@ -0,0 +1,200 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ryantrue/EaistSync/pkg/config"
+)
+
+// newTestEAISTClient создаёт клиента с короткими задержками для тестов;
+// эндпоинты login и contracts направлены на тестовый сервер baseURL.
+func newTestEAISTClient(t *testing.T, baseURL string, threshold int) *EAISTClient {
+	t.Helper()
+	httpClient, err := NewHTTPClient(5 * time.Second)
+	if err != nil {
+		t.Fatalf("Ошибка создания HTTP клиента: %v", err)
+	}
+	cfg := &config.Config{
+		EAIST: config.EAISTEndpoints{
+			BaseURL: baseURL,
+			Paths:   map[string]string{config.EndpointLogin: "/login", config.EndpointContracts: "/list"},
+		},
+		EAISTMaxRetries:       3,
+		EAISTRetryBaseDelay:   time.Millisecond,
+		EAISTRetryMaxDelay:    5 * time.Millisecond,
+		EAISTBreakerThreshold: threshold,
+		EAISTBreakerCooldown:  time.Hour,
+	}
+	logger, _ := zap.NewDevelopment()
+	return NewEAISTClient(httpClient, cfg, logger)
+}
+
+func TestEAISTClientRetries(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte(`{"items":[],"count":0}`))
+		}
+	}))
+	defer srv.Close()
+
+	client := newTestEAISTClient(t, srv.URL, 0)
+	if _, err := client.PostJSON(context.Background(), config.EndpointContracts, []byte(`{}`)); err != nil {
+		t.Fatalf("Ожидался успех после повторов, получена ошибка: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Выполнено %d запросов, ожидалось 3", calls)
+	}
+}
+
+func TestEAISTClientNoRetryOnClientError(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	client := newTestEAISTClient(t, srv.URL, 0)
+	_, err := client.PostJSON(context.Background(), config.EndpointContracts, []byte(`{}`))
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Ожидалась ошибка с кодом 400, получено: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Выполнено %d запросов, ожидался 1", calls)
+	}
+}
+
+func TestEAISTClientCircuitBreaker(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	client := newTestEAISTClient(t, srv.URL, 2)
+	if _, err := client.PostJSON(context.Background(), config.EndpointContracts, []byte(`{}`)); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Ожидалась ошибка ErrCircuitOpen, получено: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Выполнено %d запросов до размыкания, ожидалось 2", calls)
+	}
+	if _, err := client.PostJSON(context.Background(), config.EndpointContracts, []byte(`{}`)); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Разомкнутый breaker должен отклонять запросы, получено: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Разомкнутый breaker пропустил запрос к серверу")
+	}
+}
+
+func TestEAISTClientHalfOpenProbeClientError(t *testing.T) {
+	var status int32 = http.StatusInternalServerError
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer srv.Close()
+
+	client := newTestEAISTClient(t, srv.URL, 1)
+	client.breaker.cooldown = 0
+	if _, err := client.PostJSON(context.Background(), config.EndpointContracts, []byte(`{}`)); err == nil {
+		t.Fatal("Ожидалась ошибка 500")
+	}
+
+	// Пробный запрос полуоткрытого breaker, завершившийся истёкшей сессией или ошибкой клиента,
+	// не должен оставлять breaker занятым.
+	atomic.StoreInt32(&status, http.StatusUnauthorized)
+	if _, err := client.PostJSON(context.Background(), config.EndpointContracts, []byte(`{}`)); !errors.Is(err, ErrSessionExpired) {
+		t.Fatalf("Ожидалась ошибка ErrSessionExpired, получено: %v", err)
+	}
+	atomic.StoreInt32(&status, http.StatusBadRequest)
+	for i := 0; i < 2; i++ {
+		_, err := client.PostJSON(context.Background(), config.EndpointContracts, []byte(`{}`))
+		var statusErr *HTTPStatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+			t.Fatalf("Запрос %d: ожидалась ошибка 400, получено: %v", i+1, err)
+		}
+	}
+}
+
+func TestEAISTClientRelogin(t *testing.T) {
+	var logins int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&logins, 1)
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: strconv.Itoa(int(n)), Path: "/"})
+	})
+	mux.HandleFunc("/list", func(w http.ResponseWriter, r *http.Request) {
+		// Сессия, выданная первой авторизацией, считается истёкшей.
+		if c, err := r.Cookie("session"); err != nil || c.Value == "1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"items":[],"count":0}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	client := newTestEAISTClient(t, srv.URL, 0)
+	if err := client.Login(context.Background()); err != nil {
+		t.Fatalf("Ошибка авторизации: %v", err)
+	}
+
+	// Несколько параллельных запросов должны вызвать только одну повторную авторизацию.
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.PostJSON(context.Background(), config.EndpointContracts, []byte(`{}`)); err != nil {
+				t.Errorf("Запрос после истечения сессии завершился ошибкой: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if logins != 2 {
+		t.Errorf("Выполнено %d авторизаций, ожидалось 2", logins)
+	}
+	if client.Relogins() != 1 {
+		t.Errorf("Relogins() = %d, ожидалось 1", client.Relogins())
+	}
+}
+
+func TestEAISTClientDownload(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/files/17" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("file"))
+	}))
+	defer srv.Close()
+
+	client := newTestEAISTClient(t, srv.URL, 0)
+	client.cfg.EAIST.Paths[config.EndpointDocumentDownload] = "/files/{id}"
+	data, err := client.Download(context.Background(), config.EndpointDocumentDownload, "17")
+	if err != nil {
+		t.Fatalf("Ошибка загрузки файла: %v", err)
+	}
+	if string(data) != "file" {
+		t.Errorf("Загружено %q, ожидалось %q", data, "file")
+	}
+}
@@ -0,0 +1,116 @@
+package rest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+
+	"github.com/ryantrue/EaistSync/pkg/config"
+)
+
+// Параметры адаптивного снижения частоты запросов (AIMD).
+const (
+	throttleEWMAWeight    = 0.2 // вес нового наблюдения в скользящих средних
+	throttleErrorRate     = 0.2 // доля ошибок, начиная с которой частота снижается
+	throttleDecrease      = 0.5 // множитель снижения частоты
+	throttleIncreaseShare = 0.1 // доля базового лимита, на которую частота восстанавливается
+	throttleMinShare      = 0.1 // минимальная частота относительно базового лимита
+)
+
+// throttler ограничивает частоту запросов к EAIST: общий token bucket, отдельные бюджеты эндпоинтов
+// и (опционально) адаптивное снижение общего лимита при росте задержек или доли ошибок.
+type throttler struct {
+	global    *rate.Limiter
+	endpoints map[string]*rate.Limiter
+	log       *zap.Logger
+
+	adaptive         bool
+	baseRate         rate.Limit
+	latencyThreshold time.Duration
+
+	mu         sync.Mutex
+	avgLatency float64 // скользящее среднее задержки, секунды
+	errorRate  float64 // скользящее среднее доли ошибок
+}
+
+// newThrottler создаёт ограничитель по параметрам конфигурации.
+func newThrottler(cfg *config.Config, log *zap.Logger) *throttler {
+	base := rate.Limit(cfg.EAISTRateLimit)
+	if cfg.EAISTRateLimit <= 0 {
+		base = rate.Inf
+	}
+	burst := cfg.EAISTRateBurst
+	if burst <= 0 {
+		burst = 1
+	}
+	t := &throttler{
+		global:           rate.NewLimiter(base, burst),
+		endpoints:        make(map[string]*rate.Limiter, len(cfg.EAISTEndpointLimits)),
+		log:              log,
+		adaptive:         cfg.EAISTAdaptiveThrottle && base != rate.Inf,
+		baseRate:         base,
+		latencyThreshold: cfg.EAISTLatencyThreshold,
+	}
+	for name, rps := range cfg.EAISTEndpointLimits {
+		t.endpoints[name] = rate.NewLimiter(rate.Limit(rps), 1)
+	}
+	return t
+}
+
+// wait блокируется, пока запрос к эндпоинту не уложится в общий лимит и бюджет эндпоинта.
+func (t *throttler) wait(ctx context.Context, endpoint string) error {
+	if l, ok := t.endpoints[endpoint]; ok {
+		if err := l.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	return t.global.Wait(ctx)
+}
+
+// observe учитывает результат запроса и при необходимости меняет общий лимит.
+// failed – признак ошибки, говорящей о перегрузке EAIST (5xx, 429, сетевая ошибка);
+// throttled – EAIST явно попросил снизить частоту (429).
+func (t *throttler) observe(latency time.Duration, failed, throttled bool) {
+	if !t.adaptive {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	errVal := 0.0
+	if failed {
+		errVal = 1
+	}
+	t.avgLatency = (1-throttleEWMAWeight)*t.avgLatency + throttleEWMAWeight*latency.Seconds()
+	t.errorRate = (1-throttleEWMAWeight)*t.errorRate + throttleEWMAWeight*errVal
+
+	current := t.global.Limit()
+	overloaded := throttled ||
+		t.errorRate > throttleErrorRate ||
+		(t.latencyThreshold > 0 && t.avgLatency > t.latencyThreshold.Seconds())
+
+	var next rate.Limit
+	if overloaded {
+		next = current * throttleDecrease
+		if floor := t.baseRate * throttleMinShare; next < floor {
+			next = floor
+		}
+	} else {
+		next = current + t.baseRate*throttleIncreaseShare
+		if next > t.baseRate {
+			next = t.baseRate
+		}
+	}
+	if next != current {
+		t.global.SetLimit(next)
+		if overloaded {
+			t.log.Warn("Снижение частоты запросов к EAIST",
+				zap.Float64("rps", float64(next)),
+				zap.Float64("avgLatency", t.avgLatency),
+				zap.Float64("errorRate", t.errorRate))
+		}
+	}
+}
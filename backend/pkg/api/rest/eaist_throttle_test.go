@@ -0,0 +1,48 @@
+package rest
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+
+	"github.com/ryantrue/EaistSync/pkg/config"
+)
+
+func TestThrottlerAdaptive(t *testing.T) {
+	logger, _ := zap.NewDevelopment()
+	th := newThrottler(&config.Config{
+		EAISTRateLimit:        10,
+		EAISTRateBurst:        1,
+		EAISTAdaptiveThrottle: true,
+		EAISTLatencyThreshold: time.Second,
+		EAISTEndpointLimits:   map[string]float64{config.EndpointLogin: 0.5},
+	}, logger)
+
+	if th.endpoints[config.EndpointLogin].Limit() != rate.Limit(0.5) {
+		t.Errorf("Лимит эндпоинта login = %v, ожидалось 0.5", th.endpoints[config.EndpointLogin].Limit())
+	}
+
+	// 429 сразу вдвое снижает частоту.
+	th.observe(10*time.Millisecond, true, true)
+	if got := th.global.Limit(); got != 5 {
+		t.Fatalf("После 429 лимит = %v, ожидалось 5", got)
+	}
+
+	// Лимит не опускается ниже минимальной доли базового.
+	for i := 0; i < 10; i++ {
+		th.observe(10*time.Millisecond, true, true)
+	}
+	if got := th.global.Limit(); got != 1 {
+		t.Fatalf("Минимальный лимит = %v, ожидалось 1", got)
+	}
+
+	// Успешные быстрые ответы постепенно восстанавливают частоту до базовой.
+	for i := 0; i < 50; i++ {
+		th.observe(10*time.Millisecond, false, false)
+	}
+	if got := th.global.Limit(); got != 10 {
+		t.Errorf("После восстановления лимит = %v, ожидалось 10", got)
+	}
+}
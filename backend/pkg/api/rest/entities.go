@@ -0,0 +1,217 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/ryantrue/EaistSync/pkg/config"
+	"github.com/ryantrue/EaistSync/pkg/db"
+)
+
+// contractIDField – поле, по которому дочерние сущности связываются с контрактом.
+const contractIDField = "contractId"
+
+// maxReportedErrors – сколько ошибок отдельных выборок включается в ошибку FetchEntity.
+const maxReportedErrors = 5
+
+// Entity описывает сущность EAIST, которая загружается списочным запросом и сохраняется в отдельную таблицу.
+type Entity struct {
+	Name        string                   // имя сущности (используется в логах и SYNC_ENTITIES)
+	Endpoint    string                   // имя эндпоинта в реестре config.EAISTEndpoints
+	Table       string                   // таблица, в которую сохраняются записи
+	IDField     string                   // поле с уникальным идентификатором записи
+	Filters     []map[string]interface{} // фильтры запросов; по каждому выполняется отдельная выборка
+	Paged       bool                     // загружать постранично (skip/take/withCount)
+	PerContract bool                     // дочерняя сущность: выборка выполняется для каждого контракта
+}
+
+// EntityStore сохраняет записи сущности; реализуется db.JSONUpserter.
+type EntityStore interface {
+	UpsertManyByField(ctx context.Context, table, idField string, records []map[string]interface{}) (db.UpsertStats, error)
+}
+
+// knownEntities – сущности, которые можно включить через SYNC_ENTITIES.
+var knownEntities = map[string]Entity{
+	config.EndpointOrganizations:  dictionary(config.EndpointOrganizations, "organizations"),
+	config.EndpointSuppliers:      dictionary(config.EndpointSuppliers, "suppliers"),
+	config.EndpointOKPD2:          dictionary(config.EndpointOKPD2, "okpd2"),
+	config.EndpointFundingSources: dictionary(config.EndpointFundingSources, "funding_sources"),
+
+	config.EndpointContractStages:    contractChild(config.EndpointContractStages, "contract_stages"),
+	config.EndpointContractPayments:  contractChild(config.EndpointContractPayments, "contract_payments"),
+	config.EndpointContractDocuments: contractChild(config.EndpointContractDocuments, "contract_documents"),
+}
+
+// dictionary описывает справочник, загружаемый постранично целиком.
+func dictionary(name, table string) Entity {
+	return Entity{Name: name, Endpoint: name, Table: table, IDField: "id", Paged: true}
+}
+
+// contractChild описывает дочернюю сущность контракта.
+func contractChild(name, table string) Entity {
+	return Entity{Name: name, Endpoint: name, Table: table, IDField: "id", Paged: true, PerContract: true}
+}
+
+// Entities возвращает сущности для синхронизации: состояния выбранных категорий
+// и дополнительные сущности из cfg.SyncEntities. Неизвестное имя сущности – ошибка конфигурации.
+func Entities(cfg *config.Config) ([]Entity, error) {
+	entities := []Entity{StatesEntity(cfg.StateCategories)}
+	for _, name := range cfg.SyncEntities {
+		e, ok := knownEntities[name]
+		if !ok {
+			return nil, fmt.Errorf("неизвестная сущность EAIST %q", name)
+		}
+		entities = append(entities, e)
+	}
+	return entities, nil
+}
+
+// EntityTables возвращает таблицы, в которые сохраняются сущности.
+func EntityTables(entities []Entity) []string {
+	tables := make([]string, 0, len(entities))
+	for _, e := range entities {
+		tables = append(tables, e.Table)
+	}
+	return tables
+}
+
+// SyncEntities загружает и сохраняет сущности по очереди. Ошибка одной сущности не прерывает
+// синхронизацию остальных, а записи, загруженные до ошибки (например, по остальным контрактам),
+// сохраняются; возвращаются количества сохранённых записей и объединённая ошибка.
+// contractIDs используются для дочерних сущностей контрактов.
+func SyncEntities(ctx context.Context, client *EAISTClient, store EntityStore, log *zap.Logger, cfg *config.Config, entities []Entity, contractIDs []int64) (map[string]int, error) {
+	counts := make(map[string]int, len(entities))
+	var errs []error
+	for _, e := range entities {
+		items, err := FetchEntity(ctx, client, cfg, e, contractIDs)
+		if err != nil {
+			log.Warn("Не удалось загрузить сущность EAIST", zap.String("entity", e.Name),
+				zap.Int("loaded", len(items)), zap.Error(err))
+			errs = append(errs, fmt.Errorf("%s: %w", e.Name, err))
+			if len(items) == 0 {
+				continue
+			}
+		}
+		stats, err := store.UpsertManyByField(ctx, e.Table, e.IDField, items)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: сохранение: %w", e.Name, err))
+			continue
+		}
+		if len(stats.Rejected) > 0 {
+			log.Warn("Часть записей сущности EAIST отклонена", zap.String("entity", e.Name), zap.Any("rejected", stats.Rejected))
+		}
+		counts[e.Name] = len(items)
+		log.Info("Сущность EAIST синхронизирована", zap.String("entity", e.Name), zap.Int("count", len(items)),
+			zap.Int("inserted", stats.Inserted), zap.Int("updated", stats.Updated), zap.Int("unchanged", stats.Unchanged))
+	}
+	return counts, errors.Join(errs...)
+}
+
+// FetchEntity загружает все записи сущности. Выборки по фильтрам (и по контрактам для дочерних
+// сущностей) выполняются параллельно с ограничением cfg.MaxConcurrency. Ошибка одной выборки
+// не отменяет остальные: возвращаются записи успешных выборок и ошибка с числом неудачных
+// (и первыми из них). При отмене ctx записи не возвращаются.
+func FetchEntity(ctx context.Context, client *EAISTClient, cfg *config.Config, e Entity, contractIDs []int64) ([]map[string]interface{}, error) {
+	filters := e.Filters
+	if len(filters) == 0 {
+		filters = []map[string]interface{}{{}}
+	}
+	if e.PerContract {
+		perContract := make([]map[string]interface{}, 0, len(filters)*len(contractIDs))
+		for _, id := range contractIDs {
+			for _, f := range filters {
+				merged := map[string]interface{}{contractIDField: id}
+				for k, v := range f {
+					merged[k] = v
+				}
+				perContract = append(perContract, merged)
+			}
+		}
+		filters = perContract
+	}
+
+	var (
+		mu    sync.Mutex
+		items []map[string]interface{}
+		errs  []error
+	)
+	var wg sync.WaitGroup
+	sem := semaphore.NewWeighted(int64(max(cfg.MaxConcurrency, 1)))
+	for _, filter := range filters {
+		filter := filter
+		if err := sem.Acquire(ctx, 1); err != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer sem.Release(1)
+			found, err := fetchFiltered(ctx, client, e, filter, cfg.PageSize)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if e.PerContract {
+					err = fmt.Errorf("контракт %v: %w", filter[contractIDField], err)
+				}
+				errs = append(errs, err)
+				return
+			}
+			if e.PerContract {
+				// Проставляем ссылку на контракт, если EAIST не вернул её в записи.
+				for _, item := range found {
+					if _, ok := item[contractIDField]; !ok {
+						item[contractIDField] = filter[contractIDField]
+					}
+				}
+			}
+			items = append(items, found...)
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return items, fmt.Errorf("не выполнено выборок: %d из %d: %w",
+			len(errs), len(filters), errors.Join(errs[:min(len(errs), maxReportedErrors)]...))
+	}
+	return items, nil
+}
+
+// fetchFiltered выполняет выборку сущности по одному фильтру, при необходимости постранично.
+func fetchFiltered(ctx context.Context, client *EAISTClient, e Entity, filter map[string]interface{}, pageSize int) ([]map[string]interface{}, error) {
+	if !e.Paged || pageSize <= 0 {
+		items, _, err := postItems(ctx, client, e.Endpoint, map[string]interface{}{"filter": filter})
+		return items, err
+	}
+
+	var (
+		all   []map[string]interface{}
+		total int
+	)
+	for skip := 0; ; skip += pageSize {
+		body := map[string]interface{}{
+			"filter":    filter,
+			"skip":      skip,
+			"take":      pageSize,
+			"withCount": skip == 0,
+		}
+		items, count, err := postItems(ctx, client, e.Endpoint, body)
+		if err != nil {
+			return nil, fmt.Errorf("skip %d: %w", skip, err)
+		}
+		if skip == 0 {
+			total = count
+		}
+		all = append(all, items...)
+		if len(items) < pageSize || (total > 0 && len(all) >= total) {
+			break
+		}
+	}
+	return all, nil
+}
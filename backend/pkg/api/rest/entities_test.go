@@ -0,0 +1,97 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ryantrue/EaistSync/pkg/config"
+)
+
+func TestFetchEntity(t *testing.T) {
+	// Сервер отдаёт по 3 этапа на каждый контракт из фильтра contractId.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Filter map[string]interface{} `json:"filter"`
+			Skip   int                    `json:"skip"`
+			Take   int                    `json:"take"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		contractID := int(req.Filter["contractId"].(float64))
+		var items []map[string]interface{}
+		for i := req.Skip; i < 3 && len(items) < req.Take; i++ {
+			items = append(items, map[string]interface{}{"id": contractID*10 + i})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": items, "count": 3})
+	}))
+	defer srv.Close()
+
+	client := newTestEAISTClient(t, srv.URL, 0)
+	client.cfg.EAIST.Paths[config.EndpointContractStages] = "/stages"
+	cfg := &config.Config{PageSize: 2, MaxConcurrency: 2}
+
+	items, err := FetchEntity(context.Background(), client, cfg, knownEntities[config.EndpointContractStages], []int64{1, 2})
+	if err != nil {
+		t.Fatalf("FetchEntity завершился ошибкой: %v", err)
+	}
+	if len(items) != 6 {
+		t.Fatalf("Загружено %d записей, ожидалось 6", len(items))
+	}
+	for _, item := range items {
+		id := int64(item["id"].(float64))
+		if item[contractIDField] != id/10 {
+			t.Errorf("Запись %d связана с контрактом %v, ожидался %d", id, item[contractIDField], id/10)
+		}
+	}
+}
+
+func TestFetchEntityKeepsPartialResults(t *testing.T) {
+	// Выборка этапов контракта 2 отклоняется, контракты 1 и 3 загружаются.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Filter map[string]interface{} `json:"filter"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		contractID := int(req.Filter["contractId"].(float64))
+		if contractID == 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": []map[string]interface{}{{"id": contractID * 10}}, "count": 1})
+	}))
+	defer srv.Close()
+
+	client := newTestEAISTClient(t, srv.URL, 0)
+	client.cfg.EAIST.Paths[config.EndpointContractStages] = "/stages"
+	cfg := &config.Config{PageSize: 2, MaxConcurrency: 1}
+
+	items, err := FetchEntity(context.Background(), client, cfg, knownEntities[config.EndpointContractStages], []int64{1, 2, 3})
+	if err == nil || !strings.Contains(err.Error(), "1 из 3") || !strings.Contains(err.Error(), "контракт 2") {
+		t.Fatalf("Ожидалась ошибка выборки контракта 2, получено %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("Загружено %d записей, ожидалось 2", len(items))
+	}
+}
+
+func TestEntitiesUnknown(t *testing.T) {
+	if _, err := Entities(&config.Config{SyncEntities: []string{"unknown"}}); err == nil {
+		t.Error("Ожидалась ошибка для неизвестной сущности")
+	}
+	entities, err := Entities(&config.Config{StateCategories: []string{"a", "b"}})
+	if err != nil {
+		t.Fatalf("Entities завершился ошибкой: %v", err)
+	}
+	if len(entities) != 1 || len(entities[0].Filters) != 2 {
+		t.Errorf("Ожидалась одна сущность states с двумя фильтрами, получено %+v", entities)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
 
@@ -12,9 +13,59 @@ import (
 )
 
 // JWTMiddleware проверяет валидность JWT токена из заголовка Authorization.
-func JWTMiddleware(cfg *config.Config, log *zap.Logger) echo.MiddlewareFunc {
+// Вместо JWT также принимается API-ключ: в заголовке X-API-Key или как Bearer токен.
+func JWTMiddleware(cfg *config.Config, db *sqlx.DB, log *zap.Logger) echo.MiddlewareFunc {
+	return jwtMiddleware(cfg, db, log, ScopeSync)
+}
+
+// AdminOrScopeMiddleware проверяет токен так же, как JWTMiddleware, но пропускает только
+// администраторов, вошедших по JWT, и запросы с API-ключом, которому явно выдана область scope.
+// Такой ключ допускает и изменяющие запросы, даже без области "sync".
+func AdminOrScopeMiddleware(cfg *config.Config, db *sqlx.DB, log *zap.Logger, scope string) echo.MiddlewareFunc {
+	authenticate := jwtMiddleware(cfg, db, log, scope)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return authenticate(func(c echo.Context) error {
+			if !adminOrScope(c, scope) {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "Недостаточно прав"})
+			}
+			return next(c)
+		})
+	}
+}
+
+// AdminMiddleware проверяет токен так же, как JWTMiddleware, и пропускает только администраторов,
+// вошедших по JWT: API-ключи сюда не допускаются.
+func AdminMiddleware(cfg *config.Config, db *sqlx.DB, log *zap.Logger) echo.MiddlewareFunc {
+	return AdminOrScopeMiddleware(cfg, db, log, "")
+}
+
+// adminOrScope сообщает, что запрос выполнен администратором по JWT либо API-ключом с областью scope.
+func adminOrScope(c echo.Context, scope string) bool {
+	claims, ok := c.Get("user").(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+	if _, ok := claims["api_key_id"]; ok {
+		scopes, _ := claims["scopes"].([]interface{})
+		for _, s := range scopes {
+			if s == scope {
+				return true
+			}
+		}
+		return false
+	}
+	role, _ := claims["role"].(string)
+	return role == RoleAdmin
+}
+
+// jwtMiddleware проверяет JWT или API-ключ; изменяющие запросы по API-ключу требуют области writeScope.
+func jwtMiddleware(cfg *config.Config, db *sqlx.DB, log *zap.Logger, writeScope string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
+			if apiKey := c.Request().Header.Get("X-API-Key"); apiKey != "" {
+				return authenticateWithAPIKey(c, next, db, log, apiKey, writeScope)
+			}
+
 			authHeader := c.Request().Header.Get("Authorization")
 			if authHeader == "" {
 				log.Error("Отсутствует заголовок Authorization")
@@ -28,6 +79,9 @@ func JWTMiddleware(cfg *config.Config, log *zap.Logger) echo.MiddlewareFunc {
 				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Неверный формат токена"})
 			}
 			tokenString := parts[1]
+			if isAPIKey(tokenString) {
+				return authenticateWithAPIKey(c, next, db, log, tokenString, writeScope)
+			}
 
 			token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 				// Проверка, что метод подписи корректный
@@ -57,3 +111,24 @@ func JWTMiddleware(cfg *config.Config, log *zap.Logger) echo.MiddlewareFunc {
 		}
 	}
 }
+
+// authenticateWithAPIKey проверяет API-ключ и сохраняет claims его владельца в контекст.
+// Ключ без области действия writeScope допускает только запросы на чтение.
+func authenticateWithAPIKey(c echo.Context, next echo.HandlerFunc, db *sqlx.DB, log *zap.Logger, key, writeScope string) error {
+	apiKey, user, err := authenticateAPIKey(db, key)
+	if err != nil {
+		log.Error("Ошибка проверки API-ключа", zap.Error(err))
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Неверный API-ключ"})
+	}
+
+	switch c.Request().Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		if !apiKey.HasScope(writeScope) {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "API-ключ допускает только чтение"})
+		}
+	}
+
+	c.Set("user", apiKeyClaims(apiKey, user))
+	return next(c)
+}
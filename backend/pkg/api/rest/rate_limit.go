@@ -0,0 +1,59 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+
+	"github.com/ryantrue/EaistSync/pkg/config"
+	"github.com/ryantrue/EaistSync/pkg/middleware"
+)
+
+// RateLimitPrincipal возвращает функцию, определяющую клиента для лимитера: по префиксу
+// API-ключа, найденного в БД и действующего, по user_id из подписанного JWT или, иначе, по IP.
+// Непроверенный ключ или токен не даёт собственного лимита: иначе, подставляя в заголовок
+// случайные строки в формате ключа, клиент получал бы новый лимит на каждый запрос.
+func RateLimitPrincipal(cfg *config.Config, db *sqlx.DB) middleware.PrincipalFunc {
+	return func(c echo.Context) middleware.Principal {
+		anonymous := middleware.Principal{Kind: middleware.PrincipalAnonymous, ID: c.RealIP()}
+		req := c.Request()
+		if key := req.Header.Get("X-API-Key"); key != "" {
+			return apiKeyPrincipal(db, key, anonymous)
+		}
+
+		parts := strings.Split(req.Header.Get("Authorization"), " ")
+		if len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" {
+			if isAPIKey(parts[1]) {
+				return apiKeyPrincipal(db, parts[1], anonymous)
+			}
+			token, err := jwt.Parse(parts[1], func(token *jwt.Token) (interface{}, error) {
+				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+					return nil, echo.NewHTTPError(http.StatusUnauthorized, "Неверный метод подписи")
+				}
+				return []byte(cfg.JWTSecret), nil
+			})
+			if err == nil && token.Valid {
+				if claims, ok := token.Claims.(jwt.MapClaims); ok {
+					if uid, ok := claims["user_id"]; ok {
+						return middleware.Principal{Kind: middleware.PrincipalUser, ID: fmt.Sprint(uid)}
+					}
+				}
+			}
+		}
+
+		return anonymous
+	}
+}
+
+// apiKeyPrincipal возвращает клиента-ключ, если ключ действителен, и fallback в противном случае.
+func apiKeyPrincipal(db *sqlx.DB, key string, fallback middleware.Principal) middleware.Principal {
+	apiKey, err := lookupAPIKey(db, key)
+	if err != nil {
+		return fallback
+	}
+	return middleware.Principal{Kind: middleware.PrincipalAPIKey, ID: apiKey.Prefix}
+}
@@ -1,24 +1,24 @@
 package rest
 
 import (
-	"context"
-	"fmt"
-	"net/http"
+	"github.com/ryantrue/EaistSync/pkg/config"
 )
 
-// statesURL – URL для получения состояний REST API.
-const statesURL = "https://eaist.mos.ru/eaist2rc/api/core/states/state/list"
-
-// FetchStates выполняет запрос для получения состояний.
-func FetchStates(ctx context.Context, client *http.Client) ([]map[string]interface{}, error) {
-	body := map[string]interface{}{
-		"filter": map[string]interface{}{
-			"categoryCode": "contractstagesupplier",
-		},
+// StatesEntity описывает состояния EAIST: для каждой категории (categoryCode) выполняется
+// отдельный запрос, результаты сохраняются в таблицу states.
+func StatesEntity(categories []string) Entity {
+	if len(categories) == 0 {
+		categories = []string{config.DefaultStateCategory}
+	}
+	filters := make([]map[string]interface{}, 0, len(categories))
+	for _, category := range categories {
+		filters = append(filters, map[string]interface{}{"categoryCode": category})
 	}
-	items, _, err := postItems(ctx, client, statesURL, body)
-	if err != nil {
-		return nil, fmt.Errorf("fetch states: %v", err)
+	return Entity{
+		Name:     config.EndpointStates,
+		Endpoint: config.EndpointStates,
+		Table:    "states",
+		IDField:  "id",
+		Filters:  filters,
 	}
-	return items, nil
 }
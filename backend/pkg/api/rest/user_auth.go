@@ -14,6 +14,9 @@ import (
 	"github.com/ryantrue/EaistSync/pkg/config"
 )
 
+// RoleAdmin – роль администратора.
+const RoleAdmin = "admin"
+
 // User представляет модель пользователя в БД.
 type User struct {
 	ID             int64     `db:"id" json:"id"`
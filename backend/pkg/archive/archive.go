@@ -0,0 +1,263 @@
+// Package archive сохраняет сырые ответы EAIST каждой синхронизации (gzip) и позволяет
+// воспроизвести синхронизацию по архиву без обращения к EAIST.
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// manifestName – имя файла с описанием запуска внутри каталога запуска.
+const manifestName = "manifest.json"
+
+// Backend – хранилище архивных файлов (MinIO или локальная файловая система).
+type Backend interface {
+	Write(ctx context.Context, name string, data []byte) error
+	Read(ctx context.Context, name string) ([]byte, error)
+}
+
+// FileBackend хранит архив в каталоге локальной файловой системы.
+type FileBackend struct {
+	dir string
+}
+
+// NewFileBackend создаёт файловое хранилище архива в каталоге dir.
+func NewFileBackend(dir string) *FileBackend {
+	return &FileBackend{dir: dir}
+}
+
+// Write сохраняет файл, создавая промежуточные каталоги.
+func (b *FileBackend) Write(_ context.Context, name string, data []byte) error {
+	path := filepath.Join(b.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// Read читает файл архива.
+func (b *FileBackend) Read(_ context.Context, name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(b.dir, filepath.FromSlash(name)))
+}
+
+// ObjectStore – объектное хранилище с чтением и записью (storage.MinioStore).
+type ObjectStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// objectBackend хранит архив в объектном хранилище.
+type objectBackend struct {
+	store ObjectStore
+}
+
+// NewObjectBackend создаёт хранилище архива поверх объектного хранилища.
+func NewObjectBackend(store ObjectStore) Backend {
+	return &objectBackend{store: store}
+}
+
+func (b *objectBackend) Write(ctx context.Context, name string, data []byte) error {
+	return b.store.Put(ctx, name, data, "application/octet-stream")
+}
+
+func (b *objectBackend) Read(ctx context.Context, name string) ([]byte, error) {
+	return b.store.Get(ctx, name)
+}
+
+// Entry описывает один сохранённый ответ.
+type Entry struct {
+	File       string          `json:"file"`
+	Endpoint   string          `json:"endpoint"`
+	Page       int             `json:"page"`
+	Request    json.RawMessage `json:"request"`
+	ReceivedAt time.Time       `json:"received_at"`
+}
+
+// Manifest описывает запуск синхронизации и его сохранённые ответы.
+type Manifest struct {
+	RunID      string    `json:"run_id"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Entries    []Entry   `json:"entries"`
+}
+
+// Recorder сохраняет ответы одного запуска синхронизации в каталог <runID>/.
+// Реализует rest.ResponseRecorder.
+type Recorder struct {
+	backend Backend
+	mu      sync.Mutex
+	man     Manifest
+}
+
+// NewRecorder начинает новый запуск с уникальным идентификатором.
+func NewRecorder(backend Backend) *Recorder {
+	now := time.Now().UTC()
+	buf := make([]byte, 4)
+	_, _ = rand.Read(buf)
+	return &Recorder{
+		backend: backend,
+		man: Manifest{
+			RunID:     now.Format("20060102T150405Z") + "-" + hex.EncodeToString(buf),
+			StartedAt: now,
+		},
+	}
+}
+
+// RunID возвращает идентификатор запуска.
+func (r *Recorder) RunID() string {
+	return r.man.RunID
+}
+
+// Record сохраняет сырой ответ эндпоинта в файл <runID>/<endpoint>-<N>-p<page>-<время>.json.gz.
+func (r *Recorder) Record(ctx context.Context, endpoint string, request, response []byte) error {
+	now := time.Now().UTC()
+	page := pageNumber(request)
+
+	r.mu.Lock()
+	seq := len(r.man.Entries) + 1
+	name := fmt.Sprintf("%s/%s-%06d-p%04d-%s.json.gz", r.man.RunID, endpoint, seq, page, now.Format("20060102T150405.000Z"))
+	r.man.Entries = append(r.man.Entries, Entry{
+		File:       name,
+		Endpoint:   endpoint,
+		Page:       page,
+		Request:    append(json.RawMessage(nil), request...),
+		ReceivedAt: now,
+	})
+	r.mu.Unlock()
+
+	data, err := compress(response)
+	if err != nil {
+		return err
+	}
+	if err := r.backend.Write(ctx, name, data); err != nil {
+		return fmt.Errorf("архивирование ответа %s: %w", name, err)
+	}
+	return nil
+}
+
+// Close сохраняет описание запуска; без него запуск нельзя воспроизвести.
+func (r *Recorder) Close(ctx context.Context) error {
+	r.mu.Lock()
+	r.man.FinishedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(r.man, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return r.backend.Write(ctx, r.man.RunID+"/"+manifestName, data)
+}
+
+// Replayer отдаёт ответы из архива запуска вместо обращений к EAIST.
+// Реализует rest.ResponseSource.
+type Replayer struct {
+	backend Backend
+	runID   string
+
+	mu      sync.Mutex
+	entries map[string][]string // эндпоинт и запрос -> файлы ответов по порядку
+}
+
+// OpenRun читает описание запуска runID.
+func OpenRun(ctx context.Context, backend Backend, runID string) (*Replayer, error) {
+	data, err := backend.Read(ctx, runID+"/"+manifestName)
+	if err != nil {
+		return nil, fmt.Errorf("чтение описания запуска %s: %w", runID, err)
+	}
+	var man Manifest
+	if err := json.Unmarshal(data, &man); err != nil {
+		return nil, fmt.Errorf("разбор описания запуска %s: %w", runID, err)
+	}
+	r := &Replayer{backend: backend, runID: runID, entries: make(map[string][]string)}
+	for _, e := range man.Entries {
+		key, err := requestKey(e.Endpoint, e.Request)
+		if err != nil {
+			return nil, err
+		}
+		r.entries[key] = append(r.entries[key], e.File)
+	}
+	return r, nil
+}
+
+// Response возвращает сохранённый ответ на такой же запрос к эндпоинту. Если одинаковых
+// запросов было несколько, ответы отдаются в порядке сохранения (последний – повторно).
+func (r *Replayer) Response(ctx context.Context, endpoint string, request []byte) ([]byte, error) {
+	key, err := requestKey(endpoint, request)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	files := r.entries[key]
+	if len(files) == 0 {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("в архиве запуска %s нет ответа эндпоинта %s на запрос %s", r.runID, endpoint, request)
+	}
+	file := files[0]
+	if len(files) > 1 {
+		r.entries[key] = files[1:]
+	}
+	r.mu.Unlock()
+
+	data, err := r.backend.Read(ctx, file)
+	if err != nil {
+		return nil, fmt.Errorf("чтение архива %s: %w", file, err)
+	}
+	return decompress(data)
+}
+
+// requestKey приводит запрос к каноническому виду, чтобы порядок полей JSON не влиял на поиск.
+func requestKey(endpoint string, request []byte) (string, error) {
+	var v interface{}
+	if err := json.Unmarshal(request, &v); err != nil {
+		return "", fmt.Errorf("разбор запроса к %s: %w", endpoint, err)
+	}
+	canonical, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return endpoint + "\n" + string(canonical), nil
+}
+
+// pageNumber вычисляет номер страницы по полям skip и take запроса.
+func pageNumber(request []byte) int {
+	var body struct {
+		Skip int `json:"skip"`
+		Take int `json:"take"`
+	}
+	if err := json.Unmarshal(request, &body); err != nil || body.Take <= 0 {
+		return 0
+	}
+	return body.Skip / body.Take
+}
+
+// compress сжимает данные gzip.
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress распаковывает данные gzip.
+func decompress(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
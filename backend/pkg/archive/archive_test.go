@@ -0,0 +1,48 @@
+package archive
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+	backend := NewFileBackend(t.TempDir())
+
+	rec := NewRecorder(backend)
+	if err := rec.Record(ctx, "contracts", []byte(`{"skip":0,"take":2,"withCount":true}`), []byte(`{"items":[{"id":1}],"count":3}`)); err != nil {
+		t.Fatalf("Ошибка записи ответа: %v", err)
+	}
+	if err := rec.Record(ctx, "contracts", []byte(`{"skip":2,"take":2,"withCount":false}`), []byte(`{"items":[{"id":3}]}`)); err != nil {
+		t.Fatalf("Ошибка записи ответа: %v", err)
+	}
+	if err := rec.Close(ctx); err != nil {
+		t.Fatalf("Ошибка сохранения описания запуска: %v", err)
+	}
+
+	replay, err := OpenRun(ctx, backend, rec.RunID())
+	if err != nil {
+		t.Fatalf("Ошибка открытия запуска: %v", err)
+	}
+	// Порядок полей запроса не важен.
+	got, err := replay.Response(ctx, "contracts", []byte(`{"withCount":false,"take":2,"skip":2}`))
+	if err != nil {
+		t.Fatalf("Ошибка воспроизведения: %v", err)
+	}
+	if string(got) != `{"items":[{"id":3}]}` {
+		t.Errorf("Получен ответ %s", got)
+	}
+	if _, err := replay.Response(ctx, "states", []byte(`{}`)); err == nil || !strings.Contains(err.Error(), "нет ответа") {
+		t.Errorf("Ожидалась ошибка отсутствующего ответа, получено: %v", err)
+	}
+}
+
+func TestPageNumber(t *testing.T) {
+	if got := pageNumber([]byte(`{"skip":1000,"take":500}`)); got != 2 {
+		t.Errorf("pageNumber = %d, ожидалось 2", got)
+	}
+	if got := pageNumber([]byte(`{"filter":{}}`)); got != 0 {
+		t.Errorf("pageNumber = %d, ожидалось 0", got)
+	}
+}
@@ -0,0 +1,220 @@
+// Package commands обрабатывает команды внешних систем, поступающие из Kafka: проверяет их,
+// устраняет дубликаты по ID команды, выполняет действие и отвечает событием в outbox.
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+
+	"github.com/ryantrue/EaistSync/pkg/events"
+	"github.com/ryantrue/EaistSync/pkg/messaging"
+)
+
+// Типы команд.
+const (
+	TypeResyncCustomer      = "resync_customer"
+	TypeRefetchContract     = "refetch_contract"
+	TypeResendNotifications = "resend_notifications"
+)
+
+// Статусы обработанных команд.
+const (
+	statusCompleted = "completed"
+	statusRejected  = "rejected"
+	statusRetrying  = "retrying" // действие завершилось ошибкой, команда будет прочитана снова
+)
+
+// defaultMaxAttempts – число попыток выполнить команду по умолчанию.
+const defaultMaxAttempts = 5
+
+// ErrInvalid помечает ошибки, при которых команду нельзя выполнить и повторять её бесполезно.
+// Действие может обернуть им свою ошибку, чтобы команда была отклонена, а не повторена.
+var ErrInvalid = errors.New("invalid command")
+
+// Command – команда внешней системы.
+type Command struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	CustomerID int64     `json:"customerId,omitempty"`
+	ContractID int64     `json:"contractId,omitempty"`
+	Since      time.Time `json:"since,omitempty"`
+}
+
+// Validate проверяет наличие параметров, необходимых для типа команды.
+func (c Command) Validate() error {
+	if c.ID == "" {
+		return fmt.Errorf("%w: id is required", ErrInvalid)
+	}
+	switch c.Type {
+	case TypeResyncCustomer:
+		if c.CustomerID <= 0 {
+			return fmt.Errorf("%w: customerId is required", ErrInvalid)
+		}
+	case TypeRefetchContract:
+		if c.ContractID <= 0 {
+			return fmt.Errorf("%w: contractId is required", ErrInvalid)
+		}
+	case TypeResendNotifications:
+		if c.Since.IsZero() {
+			return fmt.Errorf("%w: since is required", ErrInvalid)
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalid, c.Type)
+	}
+	return nil
+}
+
+// Actions выполняет действия, запрошенные командами.
+type Actions interface {
+	// ResyncCustomer заново загружает и сохраняет контракты заказчика.
+	ResyncCustomer(ctx context.Context, customerID int64) error
+	// RefetchContract заново загружает и сохраняет один контракт.
+	RefetchContract(ctx context.Context, contractID int64) error
+	// ResendNotifications повторно отправляет события, записанные начиная с since.
+	ResendNotifications(ctx context.Context, since time.Time) error
+}
+
+// Processor обрабатывает сообщения топика команд.
+type Processor struct {
+	db          *sqlx.DB
+	actions     Actions
+	logger      *zap.Logger
+	maxAttempts int
+}
+
+// NewProcessor создаёт обработчик команд.
+func NewProcessor(db *sqlx.DB, actions Actions, logger *zap.Logger) *Processor {
+	return &Processor{db: db, actions: actions, logger: logger, maxAttempts: defaultMaxAttempts}
+}
+
+// WithMaxAttempts задаёт, после скольких неудачных попыток команда отклоняется (по умолчанию 5).
+func (p *Processor) WithMaxAttempts(n int) *Processor {
+	if n > 0 {
+		p.maxAttempts = n
+	}
+	return p
+}
+
+// Handle реализует messaging.MessageHandler. Некорректная команда отклоняется ответом command.rejected,
+// повторная доставка уже обработанной команды игнорируется. Если действие завершилось ошибкой,
+// она возвращается, и команда будет прочитана снова; после maxAttempts неудачных попыток команда
+// отклоняется, чтобы не блокировать следующие команды партиции.
+func (p *Processor) Handle(ctx context.Context, msg messaging.Message) error {
+	var cmd Command
+	if err := json.Unmarshal(msg.Value, &cmd); err != nil {
+		// Без ID ответить на команду нельзя.
+		p.logger.Warn("Некорректное сообщение в топике команд", zap.String("topic", msg.Topic),
+			zap.Int64("offset", msg.Offset), zap.Error(err))
+		return nil
+	}
+	if cmd.ID == "" {
+		p.logger.Warn("Команда без ID пропущена", zap.String("type", cmd.Type), zap.Int64("offset", msg.Offset))
+		return nil
+	}
+
+	var processed bool
+	if err := p.db.GetContext(ctx, &processed, `SELECT EXISTS (SELECT 1 FROM processed_commands WHERE id = $1 AND status <> $2)`, cmd.ID, statusRetrying); err != nil {
+		return fmt.Errorf("failed to check command %s: %w", cmd.ID, err)
+	}
+	if processed {
+		p.logger.Info("Повторная команда пропущена", zap.String("id", cmd.ID), zap.String("type", cmd.Type))
+		return nil
+	}
+
+	err := cmd.Validate()
+	if err == nil {
+		err = p.execute(ctx, cmd)
+	}
+	if err != nil && !errors.Is(err, ErrInvalid) {
+		attempts, recErr := p.recordAttempt(ctx, cmd, err)
+		if recErr != nil {
+			return errors.Join(fmt.Errorf("command %s (%s): %w", cmd.ID, cmd.Type, err), recErr)
+		}
+		if attempts < p.maxAttempts {
+			return fmt.Errorf("command %s (%s), attempt %d: %w", cmd.ID, cmd.Type, attempts, err)
+		}
+		err = fmt.Errorf("failed after %d attempts: %w", attempts, err)
+	}
+	return p.finish(ctx, cmd, err)
+}
+
+// recordAttempt увеличивает счётчик неудачных попыток команды и возвращает его новое значение.
+// Если команду тем временем завершил другой экземпляр сервиса, возвращается maxAttempts:
+// повторять её не нужно, а finish не запишет второй ответ.
+func (p *Processor) recordAttempt(ctx context.Context, cmd Command, cause error) (int, error) {
+	var attempts []int
+	err := p.db.SelectContext(ctx, &attempts, `
+		INSERT INTO processed_commands (id, type, status, error, attempts, processed_at) VALUES ($1, $2, $3, $4, 1, now())
+		ON CONFLICT (id) DO UPDATE SET attempts = processed_commands.attempts + 1, error = EXCLUDED.error, processed_at = EXCLUDED.processed_at
+		WHERE processed_commands.status = $3
+		RETURNING attempts`,
+		cmd.ID, cmd.Type, statusRetrying, cause.Error())
+	if err != nil {
+		return 0, fmt.Errorf("failed to record attempt of command %s: %w", cmd.ID, err)
+	}
+	if len(attempts) == 0 {
+		return p.maxAttempts, nil
+	}
+	return attempts[0], nil
+}
+
+func (p *Processor) execute(ctx context.Context, cmd Command) error {
+	p.logger.Info("Выполнение команды", zap.String("id", cmd.ID), zap.String("type", cmd.Type))
+	switch cmd.Type {
+	case TypeResyncCustomer:
+		return p.actions.ResyncCustomer(ctx, cmd.CustomerID)
+	case TypeRefetchContract:
+		return p.actions.RefetchContract(ctx, cmd.ContractID)
+	case TypeResendNotifications:
+		return p.actions.ResendNotifications(ctx, cmd.Since)
+	}
+	return fmt.Errorf("%w: unknown type %q", ErrInvalid, cmd.Type)
+}
+
+// finish в одной транзакции отмечает команду обработанной и записывает ответ в outbox.
+func (p *Processor) finish(ctx context.Context, cmd Command, rejectErr error) (err error) {
+	now := time.Now()
+	status, reply := statusCompleted, events.CommandCompleted(cmd.ID, cmd.Type, now)
+	var reason *string
+	if rejectErr != nil {
+		status, reply = statusRejected, events.CommandRejected(cmd.ID, cmd.Type, rejectErr, now)
+		msg := rejectErr.Error()
+		reason = &msg
+		p.logger.Warn("Команда отклонена", zap.String("id", cmd.ID), zap.String("type", cmd.Type), zap.Error(rejectErr))
+	}
+
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				err = errors.Join(err, rbErr)
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	// Запись о повторяемой команде заменяется итоговой, уже завершённая команда не затрагивается.
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO processed_commands (id, type, status, error, processed_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO UPDATE SET status = EXCLUDED.status, error = EXCLUDED.error, processed_at = EXCLUDED.processed_at
+		WHERE processed_commands.status = $6`,
+		cmd.ID, cmd.Type, status, reason, now, statusRetrying)
+	if err != nil {
+		return fmt.Errorf("failed to record command %s: %w", cmd.ID, err)
+	}
+	// Команду успел обработать другой экземпляр сервиса – ответ уже записан.
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return nil
+	}
+	return messaging.Enqueue(ctx, tx, reply)
+}
@@ -0,0 +1,178 @@
+package commands
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+
+	"github.com/ryantrue/EaistSync/pkg/messaging"
+)
+
+// fakeActions запоминает вызовы и возвращает err.
+type fakeActions struct {
+	calls []string
+	err   error
+}
+
+func (a *fakeActions) ResyncCustomer(_ context.Context, customerID int64) error {
+	a.calls = append(a.calls, "resync")
+	return a.err
+}
+
+func (a *fakeActions) RefetchContract(_ context.Context, contractID int64) error {
+	a.calls = append(a.calls, "refetch")
+	return a.err
+}
+
+func (a *fakeActions) ResendNotifications(_ context.Context, since time.Time) error {
+	a.calls = append(a.calls, "resend")
+	return a.err
+}
+
+// replyType проверяет тип ответа, записанного в outbox.
+type replyType string
+
+func (t replyType) Match(v driver.Value) bool {
+	data, ok := v.([]byte)
+	if !ok {
+		return false
+	}
+	var event struct {
+		Type string `json:"type"`
+	}
+	return json.Unmarshal(data, &event) == nil && event.Type == string(t)
+}
+
+func newProcessor(t *testing.T, actions Actions) (*Processor, sqlmock.Sqlmock) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	return NewProcessor(sqlx.NewDb(sqlDB, "sqlmock"), actions, zap.NewNop()), mock
+}
+
+func message(value string) messaging.Message {
+	return messaging.Message{Topic: "eaist_commands", Value: []byte(value)}
+}
+
+func expectProcessed(mock sqlmock.Sqlmock, id string, processed bool) {
+	mock.ExpectQuery("SELECT EXISTS").WithArgs(id, statusRetrying).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(processed))
+}
+
+func TestHandleCompletesCommand(t *testing.T) {
+	actions := &fakeActions{}
+	p, mock := newProcessor(t, actions)
+
+	expectProcessed(mock, "cmd-1", false)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO processed_commands").
+		WithArgs("cmd-1", TypeRefetchContract, statusCompleted, nil, sqlmock.AnyArg(), statusRetrying).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO outbox").WithArgs("cmd-1", replyType("command.completed")).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	if err := p.Handle(context.Background(), message(`{"id":"cmd-1","type":"refetch_contract","contractId":1048571}`)); err != nil {
+		t.Fatal(err)
+	}
+	if len(actions.calls) != 1 || actions.calls[0] != "refetch" {
+		t.Fatalf("calls = %v", actions.calls)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandleRejectsInvalidCommand(t *testing.T) {
+	actions := &fakeActions{}
+	p, mock := newProcessor(t, actions)
+
+	expectProcessed(mock, "cmd-2", false)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO processed_commands").
+		WithArgs("cmd-2", TypeResyncCustomer, statusRejected, sqlmock.AnyArg(), sqlmock.AnyArg(), statusRetrying).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO outbox").WithArgs("cmd-2", replyType("command.rejected")).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	if err := p.Handle(context.Background(), message(`{"id":"cmd-2","type":"resync_customer"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if len(actions.calls) != 0 {
+		t.Fatalf("calls = %v, want none", actions.calls)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandleSkipsDuplicate(t *testing.T) {
+	actions := &fakeActions{}
+	p, mock := newProcessor(t, actions)
+
+	expectProcessed(mock, "cmd-3", true)
+
+	if err := p.Handle(context.Background(), message(`{"id":"cmd-3","type":"resync_customer","customerId":7884}`)); err != nil {
+		t.Fatal(err)
+	}
+	if len(actions.calls) != 0 {
+		t.Fatalf("calls = %v, want none", actions.calls)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandleReturnsActionError(t *testing.T) {
+	actions := &fakeActions{err: errors.New("eaist unavailable")}
+	p, mock := newProcessor(t, actions)
+
+	// Команда не отмечается обработанной, чтобы её прочитали снова; учитывается лишь попытка.
+	expectProcessed(mock, "cmd-4", false)
+	mock.ExpectQuery("INSERT INTO processed_commands").
+		WithArgs("cmd-4", TypeResendNotifications, statusRetrying, "eaist unavailable").
+		WillReturnRows(sqlmock.NewRows([]string{"attempts"}).AddRow(1))
+
+	if err := p.Handle(context.Background(), message(`{"id":"cmd-4","type":"resend_notifications","since":"2024-01-01T00:00:00Z"}`)); err == nil {
+		t.Fatal("ожидалась ошибка действия")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandleRejectsAfterMaxAttempts(t *testing.T) {
+	actions := &fakeActions{err: errors.New("eaist unavailable")}
+	p, mock := newProcessor(t, actions)
+	p.WithMaxAttempts(3)
+
+	// Третья неудачная попытка: команда отклоняется и больше не блокирует партицию.
+	expectProcessed(mock, "cmd-5", false)
+	mock.ExpectQuery("INSERT INTO processed_commands").
+		WithArgs("cmd-5", TypeRefetchContract, statusRetrying, "eaist unavailable").
+		WillReturnRows(sqlmock.NewRows([]string{"attempts"}).AddRow(3))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO processed_commands").
+		WithArgs("cmd-5", TypeRefetchContract, statusRejected, "failed after 3 attempts: eaist unavailable", sqlmock.AnyArg(), statusRetrying).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO outbox").WithArgs("cmd-5", replyType("command.rejected")).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	if err := p.Handle(context.Background(), message(`{"id":"cmd-5","type":"refetch_contract","contractId":42}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -3,7 +3,9 @@ package config
 import (
 	"fmt"
 	"io/ioutil"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -15,23 +17,371 @@ type Config struct {
 	APIType        string // "rest"
 	DatabaseDSN    string
 	Port           string
-	KafkaBrokers   string
+	KafkaBrokers   []string
 	MinioEndpoint  string // Параметры для MinIO
 	MinioAccessKey string // Параметры для MinIO
 	MinioSecretKey string // Параметры для MinIO
 
+	MinioBucket         string        // бакет для файлов документов контрактов
+	MinioUseSSL         bool          // подключаться к MinIO по HTTPS
+	MinioPublicEndpoint string        // адрес MinIO для ссылок на скачивание (если отличается от MinioEndpoint)
+	MinioPresignExpiry  time.Duration // срок действия ссылок на скачивание
+
+	// Архив сырых ответов EAIST
+	ArchiveStore  string // "minio", "fs" или "none"
+	ArchiveDir    string // каталог архива для ArchiveStore=fs
+	ArchiveBucket string // бакет архива для ArchiveStore=minio
+
 	// Параметры для REST API
-	ContractsURL   string
+	EAIST          EAISTEndpoints
 	PageSize       int
 	MaxConcurrency int
-	LoginURL       string
+
+	// Параметры устойчивости HTTP-клиента EAIST
+	EAISTMaxRetries       int           // количество повторов запроса при 5xx, 429 и сетевых ошибках
+	EAISTRetryBaseDelay   time.Duration // базовая задержка экспоненциального backoff
+	EAISTRetryMaxDelay    time.Duration // максимальная задержка между повторами
+	EAISTBreakerThreshold int           // число подряд неудачных запросов до размыкания circuit breaker
+	EAISTBreakerCooldown  time.Duration // время, на которое размыкается circuit breaker
+	PageRetryRounds       int           // количество дополнительных проходов по страницам, не загруженным с первого раза
+
+	// Состав синхронизации
+	StateCategories []string // категории состояний (categoryCode), сохраняемые в таблицу states
+	SyncEntities    []string // дополнительные справочники и дочерние сущности контрактов (SYNC_ENTITIES, по умолчанию нет)
+
+	// Ограничение частоты запросов к EAIST
+	EAISTRateLimit        float64            // общий лимит запросов в секунду
+	EAISTRateBurst        int                // допустимый всплеск запросов
+	EAISTEndpointLimits   map[string]float64 // лимиты запросов в секунду для отдельных эндпоинтов (login, contracts, states)
+	EAISTAdaptiveThrottle bool               // снижать частоту запросов при росте задержек или ошибок
+	EAISTLatencyThreshold time.Duration      // задержка ответа, начиная с которой частота запросов снижается
+
+	// Пакетное сохранение в БД через COPY
+	DBBulkThreshold        int           // число записей, начиная с которого используется COPY (0 – отключено)
+	DBBulkChunkSize        int           // записей в одной транзакции COPY
+	DBBulkTimeoutBase      time.Duration // базовый таймаут транзакции пакета
+	DBBulkTimeoutPerRecord time.Duration // прибавка к таймауту на каждую запись пакета
+
+	OutboxRelayInterval time.Duration // период публикации событий из outbox в Kafka
+	QueueRetention      time.Duration // срок хранения отправленных сообщений outbox, завершённых доставок webhook и неотправленных сообщений Telegram; 0 – не удалять
+
+	// Подключение к Kafka
+	KafkaClientID              string
+	KafkaSASLMechanism         string // "PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512"; пустое значение – без SASL
+	KafkaSASLUsername          string
+	KafkaSASLPassword          string
+	KafkaTLS                   bool   // подключаться к брокерам по TLS
+	KafkaTLSCAFile             string // PEM-файл с сертификатом CA брокеров
+	KafkaTLSInsecureSkipVerify bool   // не проверять сертификат брокера (только для отладки)
+	KafkaCompression           string // "none", "gzip", "snappy", "lz4", "zstd"
+	KafkaIdempotent            bool   // идемпотентный продюсер
+
+	// Получатели событий из outbox
+	EventSinks          []string      // "kafka", "webhook", "nats", "file"; пустой список – события не публикуются
+	EventWebhookURL     string        // URL для EventSinks=webhook
+	EventWebhookTimeout time.Duration // таймаут запроса к webhook
+	NATSURL             string        // адреса серверов NATS через запятую (nats://[user:password@]host:port, tls://…)
+	NATSSubject         string        // subject, в который публикуются события
+	NATSToken           string        // токен аутентификации NATS
+	NATSCredsFile       string        // файл учётных данных NATS (JWT и seed NKey)
+	NATSNKeySeedFile    string        // файл seed NKey для аутентификации без JWT
+	NATSTLSCAFile       string        // PEM-файл с сертификатом CA серверов NATS; включает TLS
+	NATSTLSCertFile     string        // клиентский сертификат для mTLS
+	NATSTLSKeyFile      string        // ключ клиентского сертификата
+	EventFilePath       string        // файл JSONL для EventSinks=file
+
+	WebhookDispatchInterval     time.Duration // период отправки доставок webhook из очереди
+	WebhookAllowPrivateNetworks bool          // разрешить адреса webhook во внутренних сетях (только для разработки)
+
+	// Входящие команды
+	KafkaCommandsTopic       string // топик команд от внешних систем
+	KafkaConsumerGroup       string // consumer group, в которой читаются команды
+	KafkaCommandsMaxAttempts int    // после стольких неудачных попыток команда отклоняется
 
 	// Параметры для Telegram-бота
-	TelegramBotToken string
-	TelegramChatID   int64
+	TelegramBotToken        string
+	TelegramChatID          int64         // общий чат уведомлений; 0 – только подписчики
+	TelegramParseMode       string        // режим разметки сообщений: HTML или MarkdownV2
+	TelegramTemplatesDir    string        // каталог с шаблонами сообщений <вид>.tmpl, заменяющими встроенные
+	TelegramDigestThreshold int           // с какого числа контрактов вместо сообщений отправляется дайджест; 0 – никогда
+	TelegramDigestFormat    string        // формат вложения дайджеста: csv или xlsx
+	TelegramQueueInterval   time.Duration // период проверки отложенных сообщений в очереди Telegram
 
 	// JWT секрет для подписи токенов
 	JWTSecret string
+
+	// Параметры ограничения частоты запросов к HTTP API
+	RateLimit RateLimitConfig
+}
+
+// Имена эндпоинтов EAIST в реестре.
+const (
+	EndpointLogin     = "login"
+	EndpointContracts = "contracts"
+	EndpointStates    = "states"
+
+	// Справочники.
+	EndpointOrganizations  = "organizations"
+	EndpointSuppliers      = "suppliers"
+	EndpointOKPD2          = "okpd2"
+	EndpointFundingSources = "funding_sources"
+
+	// Дочерние сущности контракта.
+	EndpointContractStages    = "contract_stages"
+	EndpointContractPayments  = "contract_payments"
+	EndpointContractDocuments = "contract_documents"
+
+	// Загрузка файла документа; {id} в пути заменяется идентификатором документа.
+	EndpointDocumentDownload = "document_download"
+)
+
+// DefaultStateCategory – категория состояний, которая синхронизировалась изначально.
+const DefaultStateCategory = "contractstagesupplier"
+
+// DefaultEAISTBaseURL – адрес промышленного EAIST.
+const DefaultEAISTBaseURL = "https://eaist.mos.ru"
+
+// DefaultEAISTPaths возвращает пути эндпоинтов EAIST по умолчанию.
+func DefaultEAISTPaths() map[string]string {
+	return map[string]string{
+		EndpointLogin:     "/module/protected-admin/api/login",
+		EndpointContracts: "/eaist2rc/api/contracts/contract/list",
+		EndpointStates:    "/eaist2rc/api/core/states/state/list",
+
+		EndpointOrganizations:  "/eaist2rc/api/core/organizations/organization/list",
+		EndpointSuppliers:      "/eaist2rc/api/core/suppliers/supplier/list",
+		EndpointOKPD2:          "/eaist2rc/api/nsi/okpd2/okpd2/list",
+		EndpointFundingSources: "/eaist2rc/api/nsi/financing-sources/financing-source/list",
+
+		EndpointContractStages:    "/eaist2rc/api/contracts/stage/list",
+		EndpointContractPayments:  "/eaist2rc/api/contracts/payment/list",
+		EndpointContractDocuments: "/eaist2rc/api/contracts/document/list",
+
+		EndpointDocumentDownload: "/eaist2rc/api/contracts/document/download/{id}",
+	}
+}
+
+// EAISTEndpoints – реестр эндпоинтов EAIST: базовый адрес и пути по именам.
+// Путь может быть и абсолютным URL – тогда базовый адрес к нему не добавляется.
+type EAISTEndpoints struct {
+	BaseURL string
+	Paths   map[string]string
+}
+
+// URL возвращает полный адрес эндпоинта по имени.
+func (e EAISTEndpoints) URL(name string) (string, error) {
+	path, ok := e.Paths[name]
+	if !ok || path == "" {
+		return "", fmt.Errorf("эндпоинт EAIST %q не настроен", name)
+	}
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return path, nil
+	}
+	return strings.TrimRight(e.BaseURL, "/") + "/" + strings.TrimLeft(path, "/"), nil
+}
+
+// URLs возвращает полные адреса всех эндпоинтов реестра.
+func (e EAISTEndpoints) URLs() map[string]string {
+	urls := make(map[string]string, len(e.Paths))
+	for name := range e.Paths {
+		if u, err := e.URL(name); err == nil {
+			urls[name] = u
+		}
+	}
+	return urls
+}
+
+// loadEAISTEndpoints читает реестр эндпоинтов EAIST.
+// EAIST_BASE_URL задаёт базовый адрес (например, тестовый контур или прокси),
+// EAIST_ENDPOINTS переопределяет или добавляет пути в формате "имя=путь,имя=путь".
+// Для совместимости LOGIN_URL, CONTRACTS_URL и STATES_URL задают полные адреса отдельных эндпоинтов.
+func loadEAISTEndpoints() (EAISTEndpoints, error) {
+	endpoints := EAISTEndpoints{
+		BaseURL: viper.GetString("EAIST_BASE_URL"),
+		Paths:   DefaultEAISTPaths(),
+	}
+	if endpoints.BaseURL == "" {
+		endpoints.BaseURL = DefaultEAISTBaseURL
+	}
+
+	for _, item := range strings.Split(viper.GetString("EAIST_ENDPOINTS"), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+			return endpoints, fmt.Errorf("эндпоинт %q в EAIST_ENDPOINTS должен иметь формат имя=путь", item)
+		}
+		endpoints.Paths[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+
+	for key, name := range map[string]string{
+		"LOGIN_URL":     EndpointLogin,
+		"CONTRACTS_URL": EndpointContracts,
+		"STATES_URL":    EndpointStates,
+	} {
+		value, err := getValue(key)
+		if err != nil {
+			return endpoints, fmt.Errorf("ошибка при получении %s: %w", key, err)
+		}
+		if value != "" {
+			endpoints.Paths[name] = value
+		}
+	}
+	return endpoints, nil
+}
+
+// RateLimitRule задаёт лимит: не более Requests запросов за период Period.
+type RateLimitRule struct {
+	Requests int
+	Period   time.Duration
+}
+
+// RateLimitConfig описывает лимиты для разных типов клиентов и маршрутов.
+type RateLimitConfig struct {
+	Enabled       bool
+	Store         string // "memory" или "redis"
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+
+	Anonymous RateLimitRule            // лимит для анонимных клиентов (по IP)
+	User      RateLimitRule            // лимит для пользователей с JWT
+	APIKey    RateLimitRule            // лимит для запросов с API-ключом
+	Routes    map[string]RateLimitRule // дополнительные лимиты для отдельных маршрутов
+}
+
+// ParseRateLimitRule разбирает лимит в формате "N/период", где период – s, m, h
+// или длительность Go (например, "100/m", "5/10s").
+func ParseRateLimitRule(value string) (RateLimitRule, error) {
+	parts := strings.SplitN(strings.TrimSpace(value), "/", 2)
+	if len(parts) != 2 {
+		return RateLimitRule{}, fmt.Errorf("лимит %q должен иметь формат N/период", value)
+	}
+	requests, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || requests <= 0 {
+		return RateLimitRule{}, fmt.Errorf("неверное количество запросов в лимите %q", value)
+	}
+	period := strings.TrimSpace(parts[1])
+	switch period {
+	case "s":
+		period = "1s"
+	case "m":
+		period = "1m"
+	case "h":
+		period = "1h"
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return RateLimitRule{}, fmt.Errorf("неверный период в лимите %q", value)
+	}
+	return RateLimitRule{Requests: requests, Period: d}, nil
+}
+
+// parseRateLimitRoutes разбирает список лимитов маршрутов в формате "/api/login=5/m,/api/register=3/m".
+func parseRateLimitRoutes(value string) (map[string]RateLimitRule, error) {
+	routes := make(map[string]RateLimitRule)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("лимит маршрута %q должен иметь формат путь=N/период", item)
+		}
+		rule, err := ParseRateLimitRule(kv[1])
+		if err != nil {
+			return nil, err
+		}
+		routes[strings.TrimSpace(kv[0])] = rule
+	}
+	return routes, nil
+}
+
+// parseEndpointLimits разбирает лимиты эндпоинтов EAIST в формате "login=0.2,contracts=4,states=1".
+func parseEndpointLimits(value string) (map[string]float64, error) {
+	limits := make(map[string]float64)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("лимит %q должен иметь формат эндпоинт=запросов_в_секунду", item)
+		}
+		rps, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+		if err != nil || rps <= 0 {
+			return nil, fmt.Errorf("неверный лимит %q", item)
+		}
+		limits[strings.TrimSpace(kv[0])] = rps
+	}
+	return limits, nil
+}
+
+// loadRateLimitConfig читает параметры ограничения частоты запросов.
+func loadRateLimitConfig() (RateLimitConfig, error) {
+	rl := RateLimitConfig{
+		Enabled:   true,
+		Store:     strings.ToLower(viper.GetString("RATE_LIMIT_STORE")),
+		RedisAddr: viper.GetString("RATE_LIMIT_REDIS_ADDR"),
+		RedisDB:   viper.GetInt("RATE_LIMIT_REDIS_DB"),
+		Anonymous: RateLimitRule{Requests: 5, Period: 5 * time.Second},
+		User:      RateLimitRule{Requests: 20, Period: 10 * time.Second},
+		APIKey:    RateLimitRule{Requests: 50, Period: 10 * time.Second},
+	}
+	if viper.IsSet("RATE_LIMIT_ENABLED") {
+		rl.Enabled = viper.GetBool("RATE_LIMIT_ENABLED")
+	}
+	redisPassword, err := getValue("RATE_LIMIT_REDIS_PASSWORD")
+	if err != nil {
+		return rl, fmt.Errorf("ошибка при получении RATE_LIMIT_REDIS_PASSWORD: %w", err)
+	}
+	rl.RedisPassword = redisPassword
+
+	for key, rule := range map[string]*RateLimitRule{
+		"RATE_LIMIT_ANONYMOUS": &rl.Anonymous,
+		"RATE_LIMIT_USER":      &rl.User,
+		"RATE_LIMIT_API_KEY":   &rl.APIKey,
+	} {
+		if value := viper.GetString(key); value != "" {
+			parsed, err := ParseRateLimitRule(value)
+			if err != nil {
+				return rl, fmt.Errorf("ошибка в %s: %w", key, err)
+			}
+			*rule = parsed
+		}
+	}
+
+	routes, err := parseRateLimitRoutes(viper.GetString("RATE_LIMIT_ROUTES"))
+	if err != nil {
+		return rl, fmt.Errorf("ошибка в RATE_LIMIT_ROUTES: %w", err)
+	}
+	rl.Routes = routes
+
+	if rl.Store == "" {
+		rl.Store = "memory"
+	}
+	if rl.Store != "memory" && rl.Store != "redis" {
+		return rl, fmt.Errorf("неизвестное хранилище лимитов RATE_LIMIT_STORE=%q", rl.Store)
+	}
+	if rl.Store == "redis" && rl.RedisAddr == "" {
+		return rl, fmt.Errorf("RATE_LIMIT_REDIS_ADDR не задан для RATE_LIMIT_STORE=redis")
+	}
+	return rl, nil
+}
+
+// splitList разбирает список значений, разделённых запятыми, пропуская пустые элементы.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 // getValue пытается получить значение из переменной окружения.
@@ -85,10 +435,26 @@ func LoadConfig() (*Config, error) {
 	if err != nil {
 		return nil, fmt.Errorf("ошибка при получении PORT: %w", err)
 	}
-	kafkaBrokers, err := getValue("KAFKA_BROKERS")
+	kafkaBrokersStr, err := getValue("KAFKA_BROKERS")
 	if err != nil {
 		return nil, fmt.Errorf("ошибка при получении KAFKA_BROKERS: %w", err)
 	}
+	kafkaBrokers := splitList(kafkaBrokersStr)
+	kafkaClientID := viper.GetString("KAFKA_CLIENT_ID")
+	kafkaSASLMechanism := strings.ToUpper(viper.GetString("KAFKA_SASL_MECHANISM"))
+	kafkaSASLUsername, err := getValue("KAFKA_SASL_USERNAME")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении KAFKA_SASL_USERNAME: %w", err)
+	}
+	kafkaSASLPassword, err := getValue("KAFKA_SASL_PASSWORD")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении KAFKA_SASL_PASSWORD: %w", err)
+	}
+	kafkaTLS := viper.GetBool("KAFKA_TLS")
+	kafkaTLSCAFile := viper.GetString("KAFKA_TLS_CA_FILE")
+	kafkaTLSInsecureSkipVerify := viper.GetBool("KAFKA_TLS_INSECURE_SKIP_VERIFY")
+	kafkaCompression := strings.ToLower(viper.GetString("KAFKA_COMPRESSION"))
+	kafkaIdempotent := viper.GetBool("KAFKA_IDEMPOTENT")
 
 	// Чтение параметров для MinIO
 	minioEndpoint, err := getValue("MINIO_ENDPOINT")
@@ -104,18 +470,73 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("ошибка при получении MINIO_ROOT_PASSWORD: %w", err)
 	}
 
+	minioBucket := viper.GetString("MINIO_BUCKET")
+	minioUseSSL := viper.GetBool("MINIO_USE_SSL")
+	minioPublicEndpoint := viper.GetString("MINIO_PUBLIC_ENDPOINT")
+	minioPresignExpiry := viper.GetDuration("MINIO_PRESIGN_EXPIRY")
+
+	archiveStore := strings.ToLower(viper.GetString("ARCHIVE_STORE"))
+	archiveDir := viper.GetString("ARCHIVE_DIR")
+	archiveBucket := viper.GetString("ARCHIVE_BUCKET")
+
 	// Чтение параметров для REST API
-	contractsURL, err := getValue("CONTRACTS_URL")
+	eaistEndpoints, err := loadEAISTEndpoints()
 	if err != nil {
-		return nil, fmt.Errorf("ошибка при получении CONTRACTS_URL: %w", err)
+		return nil, err
 	}
 	// Для числовых значений используем viper напрямую (если они заданы в .env)
 	pageSize := viper.GetInt("PAGE_SIZE")
 	maxConcurrency := viper.GetInt("MAX_CONCURRENCY")
-	loginURL, err := getValue("LOGIN_URL")
+	eaistMaxRetries := viper.GetInt("EAIST_MAX_RETRIES")
+	eaistRetryBaseDelay := viper.GetDuration("EAIST_RETRY_BASE_DELAY")
+	eaistRetryMaxDelay := viper.GetDuration("EAIST_RETRY_MAX_DELAY")
+	eaistBreakerThreshold := viper.GetInt("EAIST_BREAKER_THRESHOLD")
+	eaistBreakerCooldown := viper.GetDuration("EAIST_BREAKER_COOLDOWN")
+	pageRetryRounds := viper.GetInt("PAGE_RETRY_ROUNDS")
+	eaistRateLimit := viper.GetFloat64("EAIST_RATE_LIMIT")
+	eaistRateBurst := viper.GetInt("EAIST_RATE_BURST")
+	eaistEndpointLimits, err := parseEndpointLimits(viper.GetString("EAIST_ENDPOINT_LIMITS"))
 	if err != nil {
-		return nil, fmt.Errorf("ошибка при получении LOGIN_URL: %w", err)
+		return nil, fmt.Errorf("ошибка в EAIST_ENDPOINT_LIMITS: %w", err)
 	}
+	eaistAdaptiveThrottle := true
+	if viper.IsSet("EAIST_ADAPTIVE_THROTTLE") {
+		eaistAdaptiveThrottle = viper.GetBool("EAIST_ADAPTIVE_THROTTLE")
+	}
+	eaistLatencyThreshold := viper.GetDuration("EAIST_LATENCY_THRESHOLD")
+	stateCategories := splitList(viper.GetString("STATE_CATEGORIES"))
+	// Дополнительные сущности включаются явно: по умолчанию синхронизируются только контракты и состояния.
+	syncEntities := splitList(viper.GetString("SYNC_ENTITIES"))
+
+	dbBulkThreshold := viper.GetInt("DB_BULK_THRESHOLD")
+	dbBulkChunkSize := viper.GetInt("DB_BULK_CHUNK_SIZE")
+	dbBulkTimeoutBase := viper.GetDuration("DB_BULK_TIMEOUT_BASE")
+	dbBulkTimeoutPerRecord := viper.GetDuration("DB_BULK_TIMEOUT_PER_RECORD")
+	outboxRelayInterval := viper.GetDuration("OUTBOX_RELAY_INTERVAL")
+	queueRetention := viper.GetDuration("QUEUE_RETENTION")
+	eventSinks := []string{"kafka"}
+	if viper.IsSet("EVENT_SINKS") {
+		eventSinks = splitList(strings.ToLower(viper.GetString("EVENT_SINKS")))
+	}
+	eventWebhookURL := viper.GetString("EVENT_WEBHOOK_URL")
+	eventWebhookTimeout := viper.GetDuration("EVENT_WEBHOOK_TIMEOUT")
+	natsURL := viper.GetString("NATS_URL")
+	natsSubject := viper.GetString("NATS_SUBJECT")
+	natsToken, err := getValue("NATS_TOKEN")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении NATS_TOKEN: %w", err)
+	}
+	natsCredsFile := viper.GetString("NATS_CREDS_FILE")
+	natsNKeySeedFile := viper.GetString("NATS_NKEY_SEED_FILE")
+	natsTLSCAFile := viper.GetString("NATS_TLS_CA_FILE")
+	natsTLSCertFile := viper.GetString("NATS_TLS_CERT_FILE")
+	natsTLSKeyFile := viper.GetString("NATS_TLS_KEY_FILE")
+	eventFilePath := viper.GetString("EVENT_FILE_PATH")
+	webhookDispatchInterval := viper.GetDuration("WEBHOOK_DISPATCH_INTERVAL")
+	webhookAllowPrivateNetworks := viper.GetBool("WEBHOOK_ALLOW_PRIVATE_NETWORKS")
+	kafkaCommandsTopic := viper.GetString("KAFKA_COMMANDS_TOPIC")
+	kafkaConsumerGroup := viper.GetString("KAFKA_CONSUMER_GROUP")
+	kafkaCommandsMaxAttempts := viper.GetInt("KAFKA_COMMANDS_MAX_ATTEMPTS")
 
 	// Чтение параметров для Telegram-бота с использованием getValue.
 	telegramBotToken, err := getValue("TELEGRAM_BOT_TOKEN")
@@ -128,14 +549,13 @@ func LoadConfig() (*Config, error) {
 	}
 	// Устанавливаем значение в viper и получаем его как int64
 	viper.Set("TELEGRAM_CHAT_ID", telegramChatIDStr)
+	// Общий чат необязателен: без него бот отвечает на команды и рассылает уведомления подписчикам.
 	telegramChatID := viper.GetInt64("TELEGRAM_CHAT_ID")
-
-	// Если задан Telegram Bot Token, но TELEGRAM_CHAT_ID не установлен,
-	// отключаем функциональность Telegram, чтобы не прерывать работу приложения.
-	if telegramBotToken != "" && telegramChatID == 0 {
-		telegramBotToken = ""
-		telegramChatID = 0
-	}
+	telegramParseMode := viper.GetString("TELEGRAM_PARSE_MODE")
+	telegramTemplatesDir := viper.GetString("TELEGRAM_TEMPLATES_DIR")
+	telegramDigestThreshold := viper.GetInt("TELEGRAM_DIGEST_THRESHOLD")
+	telegramDigestFormat := viper.GetString("TELEGRAM_DIGEST_FORMAT")
+	telegramQueueInterval := viper.GetDuration("TELEGRAM_QUEUE_INTERVAL")
 
 	// Чтение JWT секрета
 	jwtSecret, err := getValue("JWT_SECRET")
@@ -143,6 +563,12 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("ошибка при получении JWT_SECRET: %w", err)
 	}
 
+	// Чтение параметров ограничения частоты запросов
+	rateLimit, err := loadRateLimitConfig()
+	if err != nil {
+		return nil, err
+	}
+
 	// Проверка и установка значений по умолчанию
 	if username == "" || password == "" {
 		return nil, fmt.Errorf("USERNAME или PASSWORD не заданы")
@@ -156,8 +582,50 @@ func LoadConfig() (*Config, error) {
 	if port == "" {
 		port = "8080"
 	}
-	if kafkaBrokers == "" {
-		kafkaBrokers = "localhost:9092"
+	if len(kafkaBrokers) == 0 {
+		kafkaBrokers = []string{"localhost:9092"}
+	}
+	if kafkaClientID == "" {
+		kafkaClientID = "eaistsync"
+	}
+	switch kafkaSASLMechanism {
+	case "":
+	case "PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512":
+		if kafkaSASLUsername == "" {
+			return nil, fmt.Errorf("KAFKA_SASL_USERNAME не задан для KAFKA_SASL_MECHANISM=%s", kafkaSASLMechanism)
+		}
+	default:
+		return nil, fmt.Errorf("неизвестный механизм KAFKA_SASL_MECHANISM=%q", kafkaSASLMechanism)
+	}
+	// CA-файл имеет смысл только с TLS, поэтому его наличие включает TLS.
+	if kafkaTLSCAFile != "" {
+		kafkaTLS = true
+	}
+	if kafkaCompression == "" {
+		kafkaCompression = "none"
+	}
+	switch kafkaCompression {
+	case "none", "gzip", "snappy", "lz4", "zstd":
+	default:
+		return nil, fmt.Errorf("неизвестный алгоритм сжатия KAFKA_COMPRESSION=%q", kafkaCompression)
+	}
+	if !viper.IsSet("TELEGRAM_DIGEST_THRESHOLD") {
+		telegramDigestThreshold = 20
+	}
+	if telegramParseMode == "" {
+		telegramParseMode = "HTML"
+	}
+	if telegramParseMode != "HTML" && telegramParseMode != "MarkdownV2" {
+		return nil, fmt.Errorf("неизвестный режим разметки TELEGRAM_PARSE_MODE=%q", telegramParseMode)
+	}
+	if telegramDigestFormat == "" {
+		telegramDigestFormat = "xlsx"
+	}
+	if telegramDigestFormat != "csv" && telegramDigestFormat != "xlsx" {
+		return nil, fmt.Errorf("неизвестный формат дайджеста TELEGRAM_DIGEST_FORMAT=%q", telegramDigestFormat)
+	}
+	if telegramDigestThreshold < 0 {
+		return nil, fmt.Errorf("TELEGRAM_DIGEST_THRESHOLD не может быть отрицательным: %d", telegramDigestThreshold)
 	}
 	if minioEndpoint == "" {
 		minioEndpoint = "minio:9000"
@@ -168,8 +636,23 @@ func LoadConfig() (*Config, error) {
 	if minioSecretKey == "" {
 		minioSecretKey = "minioadmin"
 	}
-	if contractsURL == "" {
-		contractsURL = "https://eaist.mos.ru/eaist2rc/api/contracts/contract/list"
+	if minioBucket == "" {
+		minioBucket = "contract-documents"
+	}
+	if minioPresignExpiry == 0 {
+		minioPresignExpiry = 15 * time.Minute
+	}
+	if archiveStore == "" {
+		archiveStore = "minio"
+	}
+	if archiveStore != "minio" && archiveStore != "fs" && archiveStore != "none" {
+		return nil, fmt.Errorf("неизвестное хранилище архива ARCHIVE_STORE=%q", archiveStore)
+	}
+	if archiveDir == "" {
+		archiveDir = "archive"
+	}
+	if archiveBucket == "" {
+		archiveBucket = "eaist-archive"
 	}
 	if pageSize == 0 {
 		pageSize = 500
@@ -177,29 +660,188 @@ func LoadConfig() (*Config, error) {
 	if maxConcurrency == 0 {
 		maxConcurrency = 5
 	}
-	if loginURL == "" {
-		loginURL = "https://eaist.mos.ru/module/protected-admin/api/login"
+	if !viper.IsSet("EAIST_MAX_RETRIES") {
+		eaistMaxRetries = 3
+	}
+	if eaistRetryBaseDelay == 0 {
+		eaistRetryBaseDelay = 500 * time.Millisecond
+	}
+	if eaistRetryMaxDelay == 0 {
+		eaistRetryMaxDelay = 30 * time.Second
+	}
+	if !viper.IsSet("EAIST_BREAKER_THRESHOLD") {
+		eaistBreakerThreshold = 5
+	}
+	if eaistBreakerCooldown == 0 {
+		eaistBreakerCooldown = 30 * time.Second
+	}
+	if !viper.IsSet("PAGE_RETRY_ROUNDS") {
+		pageRetryRounds = 2
+	}
+	if eaistRateLimit == 0 {
+		eaistRateLimit = 5
+	}
+	if eaistRateBurst == 0 {
+		eaistRateBurst = maxConcurrency
+	}
+	if eaistLatencyThreshold == 0 {
+		eaistLatencyThreshold = 5 * time.Second
+	}
+	if len(stateCategories) == 0 {
+		stateCategories = []string{DefaultStateCategory}
+	}
+	if !viper.IsSet("DB_BULK_THRESHOLD") {
+		dbBulkThreshold = 500
+	}
+	if dbBulkChunkSize == 0 {
+		dbBulkChunkSize = 5000
+	}
+	if dbBulkTimeoutBase == 0 {
+		dbBulkTimeoutBase = 5 * time.Second
+	}
+	if !viper.IsSet("DB_BULK_TIMEOUT_PER_RECORD") {
+		dbBulkTimeoutPerRecord = 2 * time.Millisecond
+	}
+	if outboxRelayInterval == 0 {
+		outboxRelayInterval = 5 * time.Second
+	}
+	if !viper.IsSet("QUEUE_RETENTION") {
+		queueRetention = 7 * 24 * time.Hour
+	}
+	if queueRetention < 0 {
+		return nil, fmt.Errorf("QUEUE_RETENTION не может быть отрицательным")
+	}
+	for _, sink := range eventSinks {
+		switch sink {
+		case "kafka", "nats", "file":
+		case "webhook":
+			if eventWebhookURL == "" {
+				return nil, fmt.Errorf("EVENT_WEBHOOK_URL не задан для EVENT_SINKS=webhook")
+			}
+		default:
+			return nil, fmt.Errorf("неизвестный получатель событий EVENT_SINKS=%q", sink)
+		}
+	}
+	if eventWebhookTimeout == 0 {
+		eventWebhookTimeout = 10 * time.Second
+	}
+	if natsURL == "" {
+		natsURL = "nats://localhost:4222"
+	}
+	if natsSubject == "" {
+		natsSubject = "eaist.updates"
+	}
+	if (natsTLSCertFile == "") != (natsTLSKeyFile == "") {
+		return nil, fmt.Errorf("NATS_TLS_CERT_FILE и NATS_TLS_KEY_FILE задаются вместе")
+	}
+	if natsCredsFile != "" && natsNKeySeedFile != "" {
+		return nil, fmt.Errorf("NATS_CREDS_FILE и NATS_NKEY_SEED_FILE не могут быть заданы одновременно")
+	}
+	if eventFilePath == "" {
+		eventFilePath = "events/events.jsonl"
+	}
+	if webhookDispatchInterval == 0 {
+		webhookDispatchInterval = 5 * time.Second
+	}
+	if kafkaCommandsTopic == "" {
+		kafkaCommandsTopic = "eaist_commands"
+	}
+	if kafkaConsumerGroup == "" {
+		kafkaConsumerGroup = "eaistsync"
+	}
+	if kafkaCommandsMaxAttempts <= 0 {
+		kafkaCommandsMaxAttempts = 5
 	}
 	if jwtSecret == "" {
 		return nil, fmt.Errorf("JWT_SECRET не задан")
 	}
 
 	return &Config{
-		Username:         username,
-		Password:         password,
-		APIType:          apiType,
-		DatabaseDSN:      dbdsn,
-		Port:             port,
-		KafkaBrokers:     kafkaBrokers,
-		MinioEndpoint:    minioEndpoint,
-		MinioAccessKey:   minioAccessKey,
-		MinioSecretKey:   minioSecretKey,
-		ContractsURL:     contractsURL,
-		PageSize:         pageSize,
-		MaxConcurrency:   maxConcurrency,
-		LoginURL:         loginURL,
-		TelegramBotToken: telegramBotToken,
-		TelegramChatID:   telegramChatID,
-		JWTSecret:        jwtSecret,
+		Username:       username,
+		Password:       password,
+		APIType:        apiType,
+		DatabaseDSN:    dbdsn,
+		Port:           port,
+		KafkaBrokers:   kafkaBrokers,
+		MinioEndpoint:  minioEndpoint,
+		MinioAccessKey: minioAccessKey,
+		MinioSecretKey: minioSecretKey,
+
+		MinioBucket:         minioBucket,
+		MinioUseSSL:         minioUseSSL,
+		MinioPublicEndpoint: minioPublicEndpoint,
+		MinioPresignExpiry:  minioPresignExpiry,
+
+		ArchiveStore:  archiveStore,
+		ArchiveDir:    archiveDir,
+		ArchiveBucket: archiveBucket,
+
+		EAIST:          eaistEndpoints,
+		PageSize:       pageSize,
+		MaxConcurrency: maxConcurrency,
+
+		EAISTMaxRetries:       eaistMaxRetries,
+		EAISTRetryBaseDelay:   eaistRetryBaseDelay,
+		EAISTRetryMaxDelay:    eaistRetryMaxDelay,
+		EAISTBreakerThreshold: eaistBreakerThreshold,
+		EAISTBreakerCooldown:  eaistBreakerCooldown,
+		PageRetryRounds:       pageRetryRounds,
+		EAISTRateLimit:        eaistRateLimit,
+		EAISTRateBurst:        eaistRateBurst,
+		EAISTEndpointLimits:   eaistEndpointLimits,
+		EAISTAdaptiveThrottle: eaistAdaptiveThrottle,
+		EAISTLatencyThreshold: eaistLatencyThreshold,
+
+		StateCategories: stateCategories,
+		SyncEntities:    syncEntities,
+
+		DBBulkThreshold:        dbBulkThreshold,
+		DBBulkChunkSize:        dbBulkChunkSize,
+		DBBulkTimeoutBase:      dbBulkTimeoutBase,
+		DBBulkTimeoutPerRecord: dbBulkTimeoutPerRecord,
+
+		OutboxRelayInterval: outboxRelayInterval,
+		QueueRetention:      queueRetention,
+
+		KafkaClientID:              kafkaClientID,
+		KafkaSASLMechanism:         kafkaSASLMechanism,
+		KafkaSASLUsername:          kafkaSASLUsername,
+		KafkaSASLPassword:          kafkaSASLPassword,
+		KafkaTLS:                   kafkaTLS,
+		KafkaTLSCAFile:             kafkaTLSCAFile,
+		KafkaTLSInsecureSkipVerify: kafkaTLSInsecureSkipVerify,
+		KafkaCompression:           kafkaCompression,
+		KafkaIdempotent:            kafkaIdempotent,
+
+		EventSinks:          eventSinks,
+		EventWebhookURL:     eventWebhookURL,
+		EventWebhookTimeout: eventWebhookTimeout,
+		NATSURL:             natsURL,
+		NATSSubject:         natsSubject,
+		NATSToken:           natsToken,
+		NATSCredsFile:       natsCredsFile,
+		NATSNKeySeedFile:    natsNKeySeedFile,
+		NATSTLSCAFile:       natsTLSCAFile,
+		NATSTLSCertFile:     natsTLSCertFile,
+		NATSTLSKeyFile:      natsTLSKeyFile,
+		EventFilePath:       eventFilePath,
+
+		WebhookDispatchInterval:     webhookDispatchInterval,
+		WebhookAllowPrivateNetworks: webhookAllowPrivateNetworks,
+
+		KafkaCommandsTopic:       kafkaCommandsTopic,
+		KafkaConsumerGroup:       kafkaConsumerGroup,
+		KafkaCommandsMaxAttempts: kafkaCommandsMaxAttempts,
+
+		TelegramBotToken:        telegramBotToken,
+		TelegramChatID:          telegramChatID,
+		TelegramParseMode:       telegramParseMode,
+		TelegramTemplatesDir:    telegramTemplatesDir,
+		TelegramDigestThreshold: telegramDigestThreshold,
+		TelegramDigestFormat:    telegramDigestFormat,
+		TelegramQueueInterval:   telegramQueueInterval,
+
+		JWTSecret: jwtSecret,
+		RateLimit: rateLimit,
 	}, nil
 }
@@ -0,0 +1,58 @@
+package config
+
+import "testing"
+
+func TestEAISTEndpointsURL(t *testing.T) {
+	e := EAISTEndpoints{
+		BaseURL: "http://localhost:8090/",
+		Paths: map[string]string{
+			EndpointContracts: "/eaist2rc/api/contracts/contract/list",
+			EndpointStates:    "https://proxy.local/states",
+		},
+	}
+
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: EndpointContracts, want: "http://localhost:8090/eaist2rc/api/contracts/contract/list"},
+		{name: EndpointStates, want: "https://proxy.local/states"},
+		{name: "suppliers", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := e.URL(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("URL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("URL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLoadConfigTelegramWithoutChat проверяет, что бот без общего чата не отключается:
+// он нужен для команд и уведомлений подписчикам.
+func TestLoadConfigTelegramWithoutChat(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("USERNAME", "user")
+	t.Setenv("PASSWORD", "secret")
+	t.Setenv("DATABASE_DSN", "postgres://localhost/eaist")
+	t.Setenv("JWT_SECRET", "jwt")
+	t.Setenv("TELEGRAM_BOT_TOKEN", "123:token")
+	t.Setenv("TELEGRAM_CHAT_ID", "")
+	t.Setenv("TELEGRAM_CHAT_ID_FILE", "")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.TelegramBotToken != "123:token" {
+		t.Errorf("TelegramBotToken = %q, want %q", cfg.TelegramBotToken, "123:token")
+	}
+	if cfg.TelegramChatID != 0 {
+		t.Errorf("TelegramChatID = %d, want 0", cfg.TelegramChatID)
+	}
+}
@@ -0,0 +1,210 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+
+	"github.com/ryantrue/EaistSync/pkg/utils"
+)
+
+// bulkTempTable – временная таблица, в которую записи загружаются через COPY.
+const bulkTempTable = "bulk_upsert_tmp"
+
+// BulkConfig задаёт параметры пакетного сохранения через COPY.
+type BulkConfig struct {
+	Threshold        int           // минимальное число записей, начиная с которого UpsertMany использует COPY (0 – никогда)
+	ChunkSize        int           // записей в одной транзакции
+	BaseTimeout      time.Duration // таймаут транзакции без учёта записей
+	PerRecordTimeout time.Duration // прибавка к таймауту на каждую запись пакета
+}
+
+// DefaultBulkConfig возвращает параметры пакетного сохранения по умолчанию.
+func DefaultBulkConfig() BulkConfig {
+	return BulkConfig{
+		Threshold:        500,
+		ChunkSize:        5000,
+		BaseTimeout:      5 * time.Second,
+		PerRecordTimeout: 2 * time.Millisecond,
+	}
+}
+
+// timeout возвращает таймаут транзакции для пакета из n записей.
+func (c BulkConfig) timeout(n int) time.Duration {
+	return c.BaseTimeout + time.Duration(n)*c.PerRecordTimeout
+}
+
+// WithBulk включает пакетное сохранение через COPY для больших наборов записей.
+func (u *JSONUpserter) WithBulk(cfg BulkConfig) *JSONUpserter {
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = DefaultBulkConfig().ChunkSize
+	}
+	u.bulk = cfg
+	return u
+}
+
+// BulkUpsertByField сохраняет записи пакетами по ChunkSize: каждый пакет загружается через COPY
+// во временную таблицу и переносится в table одним INSERT ... SELECT ... ON CONFLICT.
+// Каждый пакет выполняется в своей транзакции с таймаутом, пропорциональным размеру пакета.
+// Записи без идентификатора отклоняются, как и в UpsertMany; если пакет не удалось сохранить
+// целиком, он сохраняется построчно, и в rejected_records попадают только ошибочные записи.
+func (u *JSONUpserter) BulkUpsertByField(ctx context.Context, table, idField string, records []map[string]interface{}) (UpsertStats, error) {
+	var stats UpsertStats
+	if _, ok := u.allowedTables[table]; !ok || !isSafeIdentifier(table) {
+		err := fmt.Errorf("table %q is not allowed", table)
+		u.logger.Error("BulkUpsert: table not allowed", zap.String("table", table), zap.Error(err))
+		return stats, err
+	}
+
+	chunkSize := u.bulk.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultBulkConfig().ChunkSize
+	}
+	for start := 0; start < len(records); start += chunkSize {
+		end := min(start+chunkSize, len(records))
+		chunk, err := u.bulkChunk(ctx, table, idField, records[start:end])
+		if err != nil && ctx.Err() == nil {
+			// Пакет целиком откатился: сохраняем его построчно, чтобы отделить ошибочные записи.
+			u.logger.Warn("Bulk chunk failed, falling back to row-by-row upsert",
+				zap.String("table", table), zap.Int("from", start), zap.Int("to", end), zap.Error(err))
+			chunk, err = u.upsertRows(ctx, table, idField, records[start:end])
+		}
+		if err != nil {
+			u.logger.Error("Bulk upsert failed", zap.String("table", table), zap.Int("saved", start), zap.Error(err))
+			return stats, fmt.Errorf("chunk %d-%d: %w", start, end, err)
+		}
+		stats.add(chunk)
+	}
+	u.logger.Info("Bulk upsert successful", zap.String("table", table), zap.Int("records", len(records)),
+		zap.Int("inserted", stats.Inserted), zap.Int("updated", stats.Updated),
+		zap.Int("unchanged", stats.Unchanged), zap.Int("rejected", len(stats.Rejected)))
+	return stats, nil
+}
+
+// bulkChunk сохраняет один пакет записей в отдельной транзакции.
+func (u *JSONUpserter) bulkChunk(ctx context.Context, table, idField string, records []map[string]interface{}) (stats UpsertStats, err error) {
+	cfg := u.bulk
+	if cfg.BaseTimeout <= 0 {
+		cfg = DefaultBulkConfig()
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.timeout(len(records)))
+	defer cancel()
+
+	tx, err := u.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return stats, err
+	}
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				err = errors.Join(err, rbErr)
+			}
+			return
+		}
+		if u.dryRun {
+			err = tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+		if err != nil {
+			stats = UpsertStats{}
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, fmt.Sprintf(
+		`CREATE TEMP TABLE %s (ord INTEGER, id BIGINT, hash TEXT, data JSONB) ON COMMIT DROP`, bulkTempTable)); err != nil {
+		return stats, fmt.Errorf("create temp table: %w", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(bulkTempTable, "ord", "id", "hash", "data"))
+	if err != nil {
+		return stats, fmt.Errorf("prepare copy: %w", err)
+	}
+	// Пока идёт COPY, другие запросы в транзакции невозможны, поэтому отклонённые записи
+	// сохраняются после его завершения.
+	type rejected struct {
+		id     int64
+		data   []byte
+		reason error
+	}
+	var rejects []rejected
+	current := make(map[int64]map[string]interface{}, len(records))
+	for i, rec := range records {
+		dataBytes, jErr := json.Marshal(rec)
+		if jErr != nil {
+			u.logger.Warn("Error marshaling record", zap.Error(jErr), zap.Any("record", rec))
+			rejects = append(rejects, rejected{reason: fmt.Errorf("json marshal: %w", jErr)})
+			continue
+		}
+		id, idErr := utils.ExtractIDField(rec, idField)
+		if idErr != nil {
+			u.logger.Warn("Error extracting ID", zap.Error(idErr), zap.Any("record", rec))
+			rejects = append(rejects, rejected{data: dataBytes, reason: idErr})
+			continue
+		}
+		if _, err = stmt.ExecContext(ctx, i, id, contentHash(dataBytes), string(dataBytes)); err != nil {
+			stmt.Close()
+			return stats, fmt.Errorf("copy id %d: %w", id, err)
+		}
+		current[id] = rec
+	}
+	if _, err = stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return stats, fmt.Errorf("flush copy: %w", err)
+	}
+	if err = stmt.Close(); err != nil {
+		return stats, fmt.Errorf("close copy: %w", err)
+	}
+	for _, r := range rejects {
+		if err = u.reject(ctx, tx, table, &stats, r.id, r.data, r.reason); err != nil {
+			return stats, err
+		}
+	}
+
+	// При повторе идентификатора в пакете сохраняется последняя запись, как при построчном UPSERT;
+	// строки с тем же хэшем содержимого не перезаписываются. CTE prev видит снимок до вставки.
+	var merged []struct {
+		ID       int64  `db:"id"`
+		Inserted bool   `db:"inserted"`
+		Previous []byte `db:"previous"`
+	}
+	err = tx.SelectContext(ctx, &merged, fmt.Sprintf(`
+		WITH src AS (SELECT DISTINCT ON (id) id, data, hash FROM %[2]s ORDER BY id, ord DESC),
+		     prev AS (SELECT p.id, p.data FROM %[1]s p JOIN src USING (id))
+		INSERT INTO %[1]s AS t (id, data, content_hash)
+		SELECT id, data, hash FROM src
+		ON CONFLICT (id) DO UPDATE SET data = EXCLUDED.data, content_hash = EXCLUDED.content_hash, updated_at = now()
+		WHERE t.content_hash IS DISTINCT FROM EXCLUDED.content_hash
+		RETURNING t.id, (xmax = 0) AS inserted, (SELECT prev.data FROM prev WHERE prev.id = t.id) AS previous;
+	`, table, bulkTempTable))
+	if err != nil {
+		return stats, fmt.Errorf("merge into %s: %w", table, err)
+	}
+	var changes []Change
+	for _, m := range merged {
+		if m.Inserted {
+			stats.Inserted++
+		} else {
+			stats.Updated++
+		}
+		if u.onChange != nil {
+			change, cErr := newChange(m.ID, m.Previous, current[m.ID])
+			if cErr != nil {
+				return stats, fmt.Errorf("id %d: previous data: %w", m.ID, cErr)
+			}
+			changes = append(changes, change)
+		}
+	}
+	if len(changes) > 0 {
+		if err = u.onChange(ctx, tx, table, changes); err != nil {
+			return stats, fmt.Errorf("change handler: %w", err)
+		}
+	}
+	stats.Unchanged = len(current) - len(merged)
+	return stats, nil
+}
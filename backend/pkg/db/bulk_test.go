@@ -0,0 +1,159 @@
+package db
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+func testRecords(n int) []map[string]interface{} {
+	records := make([]map[string]interface{}, n)
+	for i := range records {
+		records[i] = map[string]interface{}{"id": float64(i + 1), "number": "0373200000000000001", "price": 1000.5}
+	}
+	return records
+}
+
+func TestUpsertManyUsesBulkAboveThreshold(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	u := NewJSONUpserter(sqlx.NewDb(sqlDB, "sqlmock"), zap.NewNop(), []string{"contracts"}).
+		WithBulk(BulkConfig{Threshold: 3, ChunkSize: 2, BaseTimeout: time.Second})
+
+	// 3 записи при ChunkSize=2 дают два пакета: 2 + 1.
+	for _, size := range []int{2, 1} {
+		mock.ExpectBegin()
+		mock.ExpectExec("CREATE TEMP TABLE bulk_upsert_tmp").WillReturnResult(sqlmock.NewResult(0, 0))
+		prep := mock.ExpectPrepare("COPY")
+		for i := 0; i < size; i++ {
+			prep.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		prep.ExpectExec().WillReturnResult(sqlmock.NewResult(0, int64(size)))
+		rows := sqlmock.NewRows([]string{"id", "inserted", "previous"})
+		for i := 0; i < size; i++ {
+			rows.AddRow(int64(i+1), true, nil)
+		}
+		mock.ExpectQuery("INSERT INTO contracts").WillReturnRows(rows)
+		mock.ExpectCommit()
+	}
+
+	stats, err := u.UpsertMany(context.Background(), "contracts", testRecords(3))
+	if err != nil {
+		t.Fatalf("UpsertMany: %v", err)
+	}
+	if stats.Inserted != 3 || stats.Updated != 0 || stats.Unchanged != 0 || len(stats.Rejected) != 0 {
+		t.Fatalf("stats = %+v, want 3 inserted", stats)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBulkConfigTimeout(t *testing.T) {
+	cfg := BulkConfig{BaseTimeout: 5 * time.Second, PerRecordTimeout: 2 * time.Millisecond}
+	if got := cfg.timeout(1000); got != 7*time.Second {
+		t.Fatalf("timeout(1000) = %v, want 7s", got)
+	}
+}
+
+// benchUpserter подключается к PostgreSQL из EAISTSYNC_BENCH_DSN и создаёт таблицу bench_contracts
+// и, если её нет, rejected_records. Оба пути сохранения получают одну схему и одинаковые таймауты
+// из cfg: отличается только Threshold, выбирающий путь.
+func benchUpserter(b *testing.B, cfg BulkConfig) *JSONUpserter {
+	dsn := os.Getenv("EAISTSYNC_BENCH_DSN")
+	if dsn == "" {
+		b.Skip("EAISTSYNC_BENCH_DSN не задан")
+	}
+	conn, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var rejectedExists bool
+	if err := conn.Get(&rejectedExists, `SELECT to_regclass('rejected_records') IS NOT NULL`); err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		conn.Exec(`DROP TABLE IF EXISTS bench_contracts`)
+		if !rejectedExists {
+			conn.Exec(`DROP TABLE IF EXISTS rejected_records`)
+		}
+		conn.Close()
+	})
+	if _, err := conn.Exec(`CREATE TABLE IF NOT EXISTS bench_contracts (
+		id BIGINT PRIMARY KEY,
+		data JSONB NOT NULL,
+		content_hash TEXT,
+		first_seen_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+		updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+	)`); err != nil {
+		b.Fatal(err)
+	}
+	if _, err := conn.Exec(`CREATE TABLE IF NOT EXISTS rejected_records (
+		id BIGSERIAL PRIMARY KEY,
+		table_name TEXT NOT NULL,
+		record_id BIGINT,
+		reason TEXT NOT NULL,
+		data JSONB,
+		rejected_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+	)`); err != nil {
+		b.Fatal(err)
+	}
+	return NewJSONUpserter(conn, zap.NewNop(), []string{"bench_contracts"}).WithBulk(cfg)
+}
+
+// benchRecords возвращает n записей с полем revision: записи с новым revision отличаются
+// content_hash и действительно обновляются, а не пропускаются как неизменённые.
+func benchRecords(n, revision int) []map[string]interface{} {
+	records := testRecords(n)
+	for _, r := range records {
+		r["revision"] = revision
+	}
+	return records
+}
+
+// benchUpsert заполняет таблицу и измеряет обновление всех n записей изменённым содержимым.
+func benchUpsert(b *testing.B, cfg BulkConfig) {
+	const n = 5000
+	u := benchUpserter(b, cfg)
+	if _, err := u.UpsertMany(context.Background(), "bench_contracts", benchRecords(n, 0)); err != nil {
+		b.Fatal(err)
+	}
+	batches := make([][]map[string]interface{}, b.N)
+	for i := range batches {
+		batches[i] = benchRecords(n, i+1)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		stats, err := u.UpsertMany(context.Background(), "bench_contracts", batches[i])
+		if err != nil {
+			b.Fatal(err)
+		}
+		if stats.Updated != n {
+			b.Fatalf("stats = %+v, want %d updated", stats, n)
+		}
+	}
+}
+
+// Сравнение построчного UPSERT с загрузкой через COPY:
+//
+//	EAISTSYNC_BENCH_DSN=postgres://... go test ./pkg/db -run '^$' -bench Upsert
+func BenchmarkUpsertManyRowByRow(b *testing.B) {
+	cfg := DefaultBulkConfig()
+	cfg.Threshold = 0
+	benchUpsert(b, cfg)
+}
+
+func BenchmarkUpsertManyBulk(b *testing.B) {
+	cfg := DefaultBulkConfig()
+	cfg.Threshold = 1
+	benchUpsert(b, cfg)
+}
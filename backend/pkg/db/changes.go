@@ -0,0 +1,36 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Change – новая или изменённая запись, сохранённая UpsertMany.
+type Change struct {
+	ID       int64
+	Previous map[string]interface{} // nil для новой записи
+	Current  map[string]interface{}
+}
+
+// ChangeHandler вызывается в транзакции сохранения с новыми и изменёнными записями пакета, например
+// чтобы записать события в outbox атомарно с данными. Ошибка обработчика откатывает транзакцию.
+type ChangeHandler func(ctx context.Context, tx *sqlx.Tx, table string, changes []Change) error
+
+// WithChangeHandler задаёт обработчик изменений записей.
+func (u *JSONUpserter) WithChangeHandler(h ChangeHandler) *JSONUpserter {
+	u.onChange = h
+	return u
+}
+
+// newChange собирает изменение записи; previous – прежний JSON записи или nil для новой записи.
+func newChange(id int64, previous []byte, current map[string]interface{}) (Change, error) {
+	c := Change{ID: id, Current: current}
+	if previous != nil {
+		if err := json.Unmarshal(previous, &c.Previous); err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// recordVersionsQuery для пакета контрактов закрывает текущие версии, данные которых изменились,
+// и открывает новые; контракты без текущей версии получают первую, неизменённые не затрагиваются.
+// Вложенный запрос видит таблицу до UPDATE, поэтому закрытые версии учитываются через closed.
+const recordVersionsQuery = `
+	WITH src AS (
+		SELECT * FROM unnest($1::bigint[], $2::jsonb[]) AS s(contract_id, data)
+	), closed AS (
+		UPDATE contracts_history h SET valid_to = $3
+		FROM src
+		WHERE h.contract_id = src.contract_id AND h.valid_to IS NULL AND h.data <> src.data
+		RETURNING h.contract_id
+	)
+	INSERT INTO contracts_history (contract_id, data, valid_from)
+	SELECT src.contract_id, src.data, $3 FROM src
+	WHERE src.contract_id IN (SELECT contract_id FROM closed)
+	   OR NOT EXISTS (SELECT 1 FROM contracts_history h WHERE h.contract_id = src.contract_id AND h.valid_to IS NULL);
+`
+
+// HistoryWriter ведёт историю версий контрактов (SCD2) в таблице contracts_history. Версии пишутся
+// в транзакции сохранения самих контрактов, поэтому история не расходится с таблицей contracts.
+type HistoryWriter struct {
+	logger *zap.Logger
+}
+
+// NewHistoryWriter создаёт объект для записи истории контрактов.
+func NewHistoryWriter(logger *zap.Logger) *HistoryWriter {
+	return &HistoryWriter{logger: logger}
+}
+
+// Record одним запросом сохраняет на момент at версии новых и изменённых контрактов changes
+// (их передаёт ChangeHandler) и возвращает количество созданных версий.
+// exec – транзакция, в которой сохраняются контракты.
+func (h *HistoryWriter) Record(ctx context.Context, exec sqlx.ExecerContext, changes []Change, at time.Time) (int, error) {
+	ids := make([]int64, 0, len(changes))
+	data := make([]string, 0, len(changes))
+	for _, c := range changes {
+		dataBytes, err := json.Marshal(c.Current)
+		if err != nil {
+			h.logger.Warn("Error marshaling record", zap.Error(err), zap.Int64("id", c.ID))
+			continue
+		}
+		ids = append(ids, c.ID)
+		data = append(data, string(dataBytes))
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	res, err := exec.ExecContext(ctx, recordVersionsQuery, pq.Array(ids), pq.Array(data), at)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record contract versions: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// Close закрывает текущие версии контрактов ids на момент at (контракты удалены из выборки EAIST).
+// exec – соединение или транзакция, в которой выполняется мягкое удаление.
+func (h *HistoryWriter) Close(ctx context.Context, exec sqlx.ExecerContext, ids []int64, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := exec.ExecContext(ctx,
+		`UPDATE contracts_history SET valid_to = $2 WHERE contract_id = ANY($1) AND valid_to IS NULL`,
+		pq.Array(ids), at)
+	return err
+}
+
+// Reopen открывает версии контрактов ids, снова появившихся в выборке EAIST, на момент at.
+// Контракт, вернувшийся без изменений, не попадает в Record, поэтому его версия берётся из contracts;
+// контракты, у которых уже есть открытая версия, пропускаются.
+func (h *HistoryWriter) Reopen(ctx context.Context, exec sqlx.ExecerContext, ids []int64, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := exec.ExecContext(ctx,
+		`INSERT INTO contracts_history (contract_id, data, valid_from)
+		SELECT c.id, c.data, $2 FROM contracts c
+		WHERE c.id = ANY($1) AND NOT EXISTS (
+			SELECT 1 FROM contracts_history h WHERE h.contract_id = c.id AND h.valid_to IS NULL
+		)`,
+		pq.Array(ids), at)
+	return err
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// MissingResult – изменения, внесённые MarkMissing.
+type MissingResult struct {
+	Removed     []int64 // записи, впервые не найденные в полной выборке
+	Reactivated []int64 // ранее удалённые записи, снова появившиеся в выборке
+}
+
+// MarkMissing выполняет мягкое удаление по результатам полной выборки: записям таблицы, идентификаторов
+// которых нет в seen, проставляется missing_since = at, а снова появившимся записям missing_since сбрасывается.
+// Пустая выборка считается ошибкой источника и ничего не удаляет.
+func (u *JSONUpserter) MarkMissing(ctx context.Context, table string, seen []int64, at time.Time) (res MissingResult, err error) {
+	if _, ok := u.allowedTables[table]; !ok || !isSafeIdentifier(table) {
+		return res, fmt.Errorf("table %q is not allowed", table)
+	}
+	if len(seen) == 0 {
+		u.logger.Warn("MarkMissing: empty selection, skipping soft delete", zap.String("table", table))
+		return res, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := u.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return res, err
+	}
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				err = errors.Join(err, rbErr)
+			}
+			return
+		}
+		if err = tx.Commit(); err != nil {
+			res = MissingResult{}
+		}
+	}()
+
+	return u.MarkMissingTx(ctx, tx, table, seen, at)
+}
+
+// MarkMissingTx работает как MarkMissing, но выполняется в транзакции вызывающего, чтобы вместе
+// с пометками атомарно записать связанные изменения (например, события outbox).
+func (u *JSONUpserter) MarkMissingTx(ctx context.Context, tx *sqlx.Tx, table string, seen []int64, at time.Time) (res MissingResult, err error) {
+	if _, ok := u.allowedTables[table]; !ok || !isSafeIdentifier(table) {
+		return res, fmt.Errorf("table %q is not allowed", table)
+	}
+	if len(seen) == 0 {
+		u.logger.Warn("MarkMissing: empty selection, skipping soft delete", zap.String("table", table))
+		return res, nil
+	}
+
+	ids := pq.Array(seen)
+	reactivate := fmt.Sprintf(`UPDATE %s SET missing_since = NULL WHERE id = ANY($1) AND missing_since IS NOT NULL RETURNING id`, table)
+	if err = tx.SelectContext(ctx, &res.Reactivated, reactivate, ids); err != nil {
+		return res, fmt.Errorf("reactivate %s: %w", table, err)
+	}
+	remove := fmt.Sprintf(`UPDATE %s SET missing_since = $2 WHERE missing_since IS NULL AND NOT (id = ANY($1)) RETURNING id`, table)
+	if err = tx.SelectContext(ctx, &res.Removed, remove, ids, at); err != nil {
+		return res, fmt.Errorf("mark missing %s: %w", table, err)
+	}
+	return res, nil
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Статусы запуска синхронизации.
+const (
+	SyncRunning   = "running"
+	SyncSucceeded = "succeeded"
+	SyncFailed    = "failed"
+)
+
+// Источники запуска синхронизации.
+const (
+	SyncTriggerStartup  = "startup"
+	SyncTriggerSchedule = "schedule"
+	SyncTriggerTelegram = "telegram"
+)
+
+// SyncRun – запись журнала запусков синхронизации.
+type SyncRun struct {
+	ID           int64      `db:"id" json:"id"`
+	Trigger      string     `db:"trigger" json:"trigger"`
+	Status       string     `db:"status" json:"status"`
+	StartedAt    time.Time  `db:"started_at" json:"started_at"`
+	FinishedAt   *time.Time `db:"finished_at" json:"finished_at"`
+	Contracts    int        `db:"contracts" json:"contracts"`
+	NewContracts int        `db:"new_contracts" json:"new_contracts"`
+	Removed      int        `db:"removed" json:"removed"`
+	Rejected     int        `db:"rejected" json:"rejected"`
+	Error        *string    `db:"error" json:"error"`
+}
+
+// SyncRunStats – итоги успешного запуска.
+type SyncRunStats struct {
+	Contracts    int
+	NewContracts int
+	Removed      int
+	Rejected     int
+}
+
+// StartSyncRun записывает начало запуска и возвращает его ID.
+func StartSyncRun(ctx context.Context, db sqlx.QueryerContext, trigger string) (int64, error) {
+	var id int64
+	err := sqlx.GetContext(ctx, db, &id, "INSERT INTO sync_runs (trigger) VALUES ($1) RETURNING id", trigger)
+	return id, err
+}
+
+// FinishSyncRun записывает итог запуска: статистику при успехе или ошибку runErr.
+func FinishSyncRun(ctx context.Context, db sqlx.ExecerContext, id int64, stats SyncRunStats, runErr error) error {
+	status, errText := SyncSucceeded, sql.NullString{}
+	if runErr != nil {
+		status, errText = SyncFailed, sql.NullString{String: runErr.Error(), Valid: true}
+	}
+	_, err := db.ExecContext(ctx, `
+		UPDATE sync_runs SET status = $2, finished_at = now(), contracts = $3, new_contracts = $4,
+		       removed = $5, rejected = $6, error = $7
+		WHERE id = $1`, id, status, stats.Contracts, stats.NewContracts, stats.Removed, stats.Rejected, errText)
+	return err
+}
+
+// LastSyncRun возвращает последний запуск синхронизации или nil, если запусков не было.
+func LastSyncRun(ctx context.Context, db sqlx.QueryerContext) (*SyncRun, error) {
+	var run SyncRun
+	err := sqlx.GetContext(ctx, db, &run, "SELECT * FROM sync_runs ORDER BY started_at DESC, id DESC LIMIT 1")
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
@@ -2,6 +2,9 @@ package db
 
 import (
 	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -20,8 +23,53 @@ type JSONUpserter struct {
 	db            *sqlx.DB
 	logger        *zap.Logger
 	allowedTables map[string]struct{}
+	bulk          BulkConfig
+	onChange      ChangeHandler
+	dryRun        bool
 }
 
+// UpsertStats – результат сохранения записей: новые, изменённые, записи без изменений
+// и отклонённые записи. Запись считается изменённой, если отличается хэш её содержимого.
+type UpsertStats struct {
+	Inserted  int              `json:"inserted"`
+	Updated   int              `json:"updated"`
+	Unchanged int              `json:"unchanged"`
+	Rejected  []RejectedRecord `json:"rejected,omitempty"`
+}
+
+// RejectedRecord – запись, которую не удалось сохранить; она остаётся в таблице rejected_records.
+type RejectedRecord struct {
+	ID     int64  `json:"id,omitempty"` // 0, если идентификатор не удалось извлечь
+	Reason string `json:"reason"`
+}
+
+// add суммирует статистику пакетов.
+func (s *UpsertStats) add(o UpsertStats) {
+	s.Inserted += o.Inserted
+	s.Updated += o.Updated
+	s.Unchanged += o.Unchanged
+	s.Rejected = append(s.Rejected, o.Rejected...)
+}
+
+// contentHash возвращает SHA-256 канонического JSON записи. encoding/json сортирует ключи map,
+// поэтому одинаковые записи дают одинаковый хэш независимо от порядка полей в ответе EAIST.
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// upsertQuery вставляет запись или обновляет её только при изменении хэша содержимого;
+// для неизменённой записи строка не возвращается, xmax = 0 отличает вставку от обновления.
+// CTE prev видит снимок до вставки и возвращает прежние данные изменённой записи.
+const upsertQuery = `
+	WITH prev AS (SELECT data FROM %[1]s WHERE id = $1)
+	INSERT INTO %[1]s AS t (id, data, content_hash)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (id) DO UPDATE SET data = EXCLUDED.data, content_hash = EXCLUDED.content_hash, updated_at = now()
+	WHERE t.content_hash IS DISTINCT FROM EXCLUDED.content_hash
+	RETURNING (xmax = 0) AS inserted, (SELECT data FROM prev) AS previous;
+`
+
 // NewJSONUpserter создаёт новый объект JSONUpserter с динамически задаваемым списком разрешённых таблиц.
 func NewJSONUpserter(db *sqlx.DB, logger *zap.Logger, allowed []string) *JSONUpserter {
 	tables := make(map[string]struct{}, len(allowed))
@@ -31,6 +79,14 @@ func NewJSONUpserter(db *sqlx.DB, logger *zap.Logger, allowed []string) *JSONUps
 	return &JSONUpserter{db: db, logger: logger, allowedTables: tables}
 }
 
+// WithDryRun включает пробный режим: записи сохраняются и сравниваются как обычно, обработчик
+// изменений вызывается, но транзакции откатываются, и таблицы (в том числе rejected_records)
+// остаются без изменений.
+func (u *JSONUpserter) WithDryRun() *JSONUpserter {
+	u.dryRun = true
+	return u
+}
+
 // isSafeIdentifier проверяет, что имя является допустимым идентификатором.
 func isSafeIdentifier(name string) bool {
 	if name == "" {
@@ -46,33 +102,57 @@ func isSafeIdentifier(name string) bool {
 
 // UpsertMany выполняет транзакционное сохранение нескольких записей в указанную таблицу.
 // Каждая запись сериализуется в JSON, а уникальность определяется по полю "id".
-func (u *JSONUpserter) UpsertMany(ctx context.Context, table string, records []map[string]interface{}) (err error) {
+// Строки, содержимое которых не изменилось, не перезаписываются. Записи, которые не удалось
+// сохранить, не прерывают сохранение остальных и возвращаются в UpsertStats.Rejected;
+// ошибка возвращается, только если не удалось выполнить саму транзакцию.
+func (u *JSONUpserter) UpsertMany(ctx context.Context, table string, records []map[string]interface{}) (UpsertStats, error) {
+	return u.UpsertManyByField(ctx, table, "id", records)
+}
+
+// UpsertManyByField работает как UpsertMany, но берёт идентификатор записи из поля idField.
+func (u *JSONUpserter) UpsertManyByField(ctx context.Context, table, idField string, records []map[string]interface{}) (stats UpsertStats, err error) {
 	// Проверка допустимости таблицы.
 	if _, ok := u.allowedTables[table]; !ok {
 		err = fmt.Errorf("table %q is not allowed", table)
 		u.logger.Error("UpsertMany: table not allowed", zap.String("table", table), zap.Error(err))
-		return err
+		return stats, err
 	}
 	if !isSafeIdentifier(table) {
 		err = fmt.Errorf("invalid table name %q", table)
 		u.logger.Error("UpsertMany: invalid table name", zap.String("table", table), zap.Error(err))
-		return err
+		return stats, err
 	}
 
 	// Если записей нет, выходим.
 	if len(records) == 0 {
 		u.logger.Info("No records to upsert", zap.String("table", table))
-		return nil
+		return stats, nil
+	}
+
+	// Большие наборы сохраняются через COPY.
+	if u.bulk.Threshold > 0 && len(records) >= u.bulk.Threshold {
+		return u.BulkUpsertByField(ctx, table, idField, records)
 	}
 
-	// Контекст с таймаутом 5 секунд для транзакции.
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	return u.upsertRows(ctx, table, idField, records)
+}
+
+// upsertRows сохраняет записи построчно в одной транзакции. Каждая запись выполняется под
+// точкой сохранения: ошибка отдельной записи откатывает только её, запись попадает в
+// rejected_records, а остальные записи сохраняются.
+func (u *JSONUpserter) upsertRows(ctx context.Context, table, idField string, records []map[string]interface{}) (stats UpsertStats, err error) {
+	// Контекст с таймаутом транзакции: 5 секунд или таймаут, заданный WithBulk для пакета такого размера.
+	timeout := 5 * time.Second
+	if u.bulk.BaseTimeout > 0 {
+		timeout = max(timeout, u.bulk.timeout(len(records)))
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	tx, err := u.db.BeginTxx(ctx, nil)
 	if err != nil {
 		u.logger.Error("Failed to begin transaction", zap.Error(err))
-		return err
+		return stats, err
 	}
 	defer func() {
 		if err != nil {
@@ -82,6 +162,12 @@ func (u *JSONUpserter) UpsertMany(ctx context.Context, table string, records []m
 			} else {
 				u.logger.Error("Transaction rolled back", zap.Error(err))
 			}
+		} else if u.dryRun {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				u.logger.Error("Rollback failed", zap.Error(rbErr))
+				err = rbErr
+				stats = UpsertStats{}
+			}
 		} else {
 			if commitErr := tx.Commit(); commitErr != nil {
 				u.logger.Error("Commit failed", zap.Error(commitErr))
@@ -90,54 +176,110 @@ func (u *JSONUpserter) UpsertMany(ctx context.Context, table string, records []m
 					commitErr = errors.Join(commitErr, rbErr)
 				}
 				err = commitErr
+				stats = UpsertStats{}
 			} else {
-				u.logger.Info("Upsert successful", zap.String("table", table))
+				u.logger.Info("Upsert successful", zap.String("table", table),
+					zap.Int("inserted", stats.Inserted), zap.Int("updated", stats.Updated),
+					zap.Int("unchanged", stats.Unchanged), zap.Int("rejected", len(stats.Rejected)))
 			}
 		}
 	}()
 
 	// Готовим запрос UPSERT.
-	query := fmt.Sprintf(`
-		INSERT INTO %s (id, data)
-		VALUES ($1, $2)
-		ON CONFLICT (id) DO UPDATE SET data = EXCLUDED.data;
-	`, table)
-	stmt, err := tx.PrepareContext(ctx, query)
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf(upsertQuery, table))
 	if err != nil {
-		return fmt.Errorf("failed to prepare statement for table %s: %w", table, err)
+		return stats, fmt.Errorf("failed to prepare statement for table %s: %w", table, err)
 	}
 	defer stmt.Close()
 
-	var errs []error
+	var changes []Change
 	for _, rec := range records {
 		// Сериализация записи в JSON.
 		dataBytes, jErr := json.Marshal(rec)
 		if jErr != nil {
 			u.logger.Warn("Error marshaling record", zap.Error(jErr), zap.Any("record", rec))
-			errs = append(errs, fmt.Errorf("json marshal: %w", jErr))
+			if err = u.reject(ctx, tx, table, &stats, 0, nil, fmt.Errorf("json marshal: %w", jErr)); err != nil {
+				return stats, err
+			}
 			continue
 		}
 
 		// Извлечение идентификатора.
-		id, idErr := utils.ExtractID(rec)
+		id, idErr := utils.ExtractIDField(rec, idField)
 		if idErr != nil {
 			u.logger.Warn("Error extracting ID", zap.Error(idErr), zap.Any("record", rec))
-			errs = append(errs, idErr)
+			if err = u.reject(ctx, tx, table, &stats, 0, dataBytes, idErr); err != nil {
+				return stats, err
+			}
 			continue
 		}
 
+		if _, err = tx.ExecContext(ctx, "SAVEPOINT upsert_record"); err != nil {
+			return stats, fmt.Errorf("savepoint: %w", err)
+		}
+
 		// Для каждой записи создаем отдельный контекст с таймаутом.
 		execCtx, execCancel := context.WithTimeout(ctx, 5*time.Second)
-		_, execErr := stmt.ExecContext(execCtx, id, dataBytes)
+		var (
+			inserted bool
+			previous []byte
+		)
+		execErr := stmt.QueryRowContext(execCtx, id, dataBytes, contentHash(dataBytes)).Scan(&inserted, &previous)
 		execCancel()
-		if execErr != nil {
+		switch {
+		case errors.Is(execErr, sql.ErrNoRows):
+			stats.Unchanged++
+		case execErr != nil:
+			// Истёкший таймаут транзакции – не ошибка записи, продолжать бессмысленно.
+			if ctx.Err() != nil {
+				return stats, fmt.Errorf("id %v: %w", id, execErr)
+			}
 			u.logger.Warn("Upsert operation failed", zap.String("table", table), zap.Error(execErr), zap.Any("id", id))
-			errs = append(errs, fmt.Errorf("id %v: %w", id, execErr))
+			if _, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT upsert_record"); err != nil {
+				return stats, fmt.Errorf("rollback to savepoint: %w", err)
+			}
+			if err = u.reject(ctx, tx, table, &stats, id, dataBytes, execErr); err != nil {
+				return stats, err
+			}
+		default:
+			if inserted {
+				stats.Inserted++
+			} else {
+				stats.Updated++
+			}
+			if u.onChange != nil {
+				change, cErr := newChange(id, previous, rec)
+				if cErr != nil {
+					return stats, fmt.Errorf("id %v: previous data: %w", id, cErr)
+				}
+				changes = append(changes, change)
+			}
+		}
+		if _, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT upsert_record"); err != nil {
+			return stats, fmt.Errorf("release savepoint: %w", err)
 		}
 	}
+	if len(changes) > 0 {
+		if err = u.onChange(ctx, tx, table, changes); err != nil {
+			return stats, fmt.Errorf("change handler: %w", err)
+		}
+	}
+	return stats, nil
+}
 
-	if len(errs) > 0 {
-		return fmt.Errorf("errors occurred during upsert: %w", errors.Join(errs...))
+// reject сохраняет отклонённую запись с причиной в rejected_records и добавляет её в stats.
+// Неизвестный идентификатор передаётся как 0, несериализуемая запись – как nil data.
+func (u *JSONUpserter) reject(ctx context.Context, tx *sqlx.Tx, table string, stats *UpsertStats, id int64, data []byte, reason error) error {
+	var payload interface{}
+	if data != nil {
+		payload = data
+	}
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO rejected_records (table_name, record_id, reason, data) VALUES ($1, $2, $3, $4)`,
+		table, sql.NullInt64{Int64: id, Valid: id != 0}, reason.Error(), payload)
+	if err != nil {
+		return fmt.Errorf("failed to save rejected record %d: %w", id, err)
 	}
+	stats.Rejected = append(stats.Rejected, RejectedRecord{ID: id, Reason: reason.Error()})
 	return nil
 }
@@ -0,0 +1,175 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// expectRow ожидает сохранение одной записи под точкой сохранения.
+func expectRow(mock sqlmock.Sqlmock, prep *sqlmock.ExpectedPrepare, rows *sqlmock.Rows) {
+	mock.ExpectExec("SAVEPOINT upsert_record").WillReturnResult(sqlmock.NewResult(0, 0))
+	prep.ExpectQuery().WillReturnRows(rows)
+	mock.ExpectExec("RELEASE SAVEPOINT upsert_record").WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestUpsertManyCountsChanges(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	var changes []Change
+	u := NewJSONUpserter(sqlx.NewDb(sqlDB, "sqlmock"), zap.NewNop(), []string{"contracts"}).
+		WithChangeHandler(func(_ context.Context, _ *sqlx.Tx, _ string, c []Change) error {
+			changes = c
+			return nil
+		})
+
+	mock.ExpectBegin()
+	prep := mock.ExpectPrepare("INSERT INTO contracts AS t")
+	expectRow(mock, prep, sqlmock.NewRows([]string{"inserted", "previous"}).AddRow(true, nil))
+	expectRow(mock, prep, sqlmock.NewRows([]string{"inserted", "previous"}).AddRow(false, []byte(`{"id":2}`)))
+	// Хэш не изменился: ON CONFLICT ... WHERE не обновляет строку и ничего не возвращает.
+	expectRow(mock, prep, sqlmock.NewRows([]string{"inserted", "previous"}))
+	mock.ExpectCommit()
+
+	stats, err := u.UpsertMany(context.Background(), "contracts", testRecords(3))
+	if err != nil {
+		t.Fatalf("UpsertMany: %v", err)
+	}
+	if stats.Inserted != 1 || stats.Updated != 1 || stats.Unchanged != 1 || len(stats.Rejected) != 0 {
+		t.Fatalf("stats = %+v, want 1 inserted, 1 updated, 1 unchanged", stats)
+	}
+	// Обработчик получает новую и изменённую записи с прежними данными.
+	if len(changes) != 2 || changes[0].Previous != nil || changes[1].ID != 2 || changes[1].Previous["id"] != float64(2) {
+		t.Fatalf("changes = %+v", changes)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpsertManyRejectsBadRecords(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	u := NewJSONUpserter(sqlx.NewDb(sqlDB, "sqlmock"), zap.NewNop(), []string{"contracts"})
+	records := append(testRecords(2), map[string]interface{}{"number": "без id"})
+
+	mock.ExpectBegin()
+	prep := mock.ExpectPrepare("INSERT INTO contracts AS t")
+	// Первая запись нарушает ограничение: откатывается только она.
+	mock.ExpectExec("SAVEPOINT upsert_record").WillReturnResult(sqlmock.NewResult(0, 0))
+	prep.ExpectQuery().WillReturnError(errors.New("value too long"))
+	mock.ExpectExec("ROLLBACK TO SAVEPOINT upsert_record").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO rejected_records").
+		WithArgs("contracts", sqlmock.AnyArg(), "value too long", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("RELEASE SAVEPOINT upsert_record").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectRow(mock, prep, sqlmock.NewRows([]string{"inserted", "previous"}).AddRow(true, nil))
+	// Запись без идентификатора отклоняется без обращения к таблице.
+	mock.ExpectExec("INSERT INTO rejected_records").WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+
+	stats, err := u.UpsertMany(context.Background(), "contracts", records)
+	if err != nil {
+		t.Fatalf("UpsertMany: %v", err)
+	}
+	if stats.Inserted != 1 || len(stats.Rejected) != 2 {
+		t.Fatalf("stats = %+v, want 1 inserted and 2 rejected", stats)
+	}
+	if r := stats.Rejected[0]; r.ID != 1 || r.Reason != "value too long" {
+		t.Errorf("Rejected[0] = %+v", r)
+	}
+	if r := stats.Rejected[1]; r.ID != 0 {
+		t.Errorf("Rejected[1] = %+v, want unknown id", r)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHistoryWriterRecord(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+	at := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	// Версии всего пакета пишутся одним запросом в переданной транзакции.
+	mock.ExpectBegin()
+	mock.ExpectExec("WITH src AS").WithArgs("{1,2}", sqlmock.AnyArg(), at).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	tx, err := sqlx.NewDb(sqlDB, "sqlmock").Beginx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := []Change{
+		{ID: 1, Current: map[string]interface{}{"id": 1}},
+		{ID: 2, Previous: map[string]interface{}{"id": 2}, Current: map[string]interface{}{"id": 2, "sum": 10}},
+	}
+	versions, err := NewHistoryWriter(zap.NewNop()).Record(context.Background(), tx, changes, at)
+	if err != nil || versions != 1 {
+		t.Fatalf("Record = %d, %v", versions, err)
+	}
+	if versions, err := NewHistoryWriter(zap.NewNop()).Record(context.Background(), tx, nil, at); err != nil || versions != 0 {
+		t.Fatalf("Record без изменений = %d, %v", versions, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpsertManyDryRunRollsBack(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	var changes []Change
+	u := NewJSONUpserter(sqlx.NewDb(sqlDB, "sqlmock"), zap.NewNop(), []string{"contracts"}).
+		WithChangeHandler(func(_ context.Context, _ *sqlx.Tx, _ string, c []Change) error {
+			changes = c
+			return nil
+		}).
+		WithDryRun()
+
+	mock.ExpectBegin()
+	prep := mock.ExpectPrepare("INSERT INTO contracts AS t")
+	expectRow(mock, prep, sqlmock.NewRows([]string{"inserted", "previous"}).AddRow(true, nil))
+	mock.ExpectRollback()
+
+	stats, err := u.UpsertMany(context.Background(), "contracts", testRecords(1))
+	if err != nil || stats.Inserted != 1 || len(changes) != 1 {
+		t.Fatalf("UpsertMany = %+v, %v; changes %d", stats, err, len(changes))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	a := []byte(`{"id":1,"number":"1"}`)
+	if contentHash(a) != contentHash([]byte(`{"id":1,"number":"1"}`)) {
+		t.Fatal("одинаковые данные дали разные хэши")
+	}
+	if contentHash(a) == contentHash([]byte(`{"id":1,"number":"2"}`)) {
+		t.Fatal("разные данные дали одинаковые хэши")
+	}
+}
@@ -8,9 +8,9 @@ import (
 	"go.uber.org/zap"
 )
 
-// FetchRecords выполняет запрос к БД и возвращает срез записей с декодированным полем "data".
-func FetchRecords(db *sqlx.DB, log *zap.Logger, query string) ([]map[string]interface{}, error) {
-	rows, err := db.Queryx(query)
+// FetchRecords выполняет запрос к БД с параметрами args и возвращает срез записей с декодированным полем "data".
+func FetchRecords(db *sqlx.DB, log *zap.Logger, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := db.Queryx(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,206 @@
+// Package documents загружает файлы документов контрактов из EAIST в объектное хранилище
+// и ведёт их метаданные в таблице contract_files.
+package documents
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+
+	"github.com/ryantrue/EaistSync/pkg/config"
+	"github.com/ryantrue/EaistSync/pkg/storage"
+	"github.com/ryantrue/EaistSync/pkg/utils"
+)
+
+// File – метаданные файла документа контракта.
+type File struct {
+	ID          int64     `db:"id" json:"id"`
+	ContractID  int64     `db:"contract_id" json:"contract_id"`
+	DocumentID  int64     `db:"document_id" json:"document_id"`
+	FileName    string    `db:"file_name" json:"file_name"`
+	ContentType string    `db:"content_type" json:"content_type"`
+	Size        int64     `db:"size" json:"size"`
+	SHA256      string    `db:"sha256" json:"sha256"`
+	ObjectKey   string    `db:"object_key" json:"-"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	URL         string    `db:"-" json:"url,omitempty"`
+}
+
+// Downloader загружает файл документа по идентификатору; реализуется rest.EAISTClient.
+type Downloader interface {
+	Download(ctx context.Context, endpoint, id string) ([]byte, error)
+}
+
+// Stats – результат синхронизации файлов.
+type Stats struct {
+	Downloaded   int // новых объектов сохранено в хранилище
+	Deduplicated int // файлов, совпавших по контрольной сумме с уже сохранёнными
+	Failed       int
+}
+
+// Syncer загружает файлы документов, ещё не сохранённых в contract_files.
+type Syncer struct {
+	client Downloader
+	store  storage.ObjectStore
+	db     *sqlx.DB
+	log    *zap.Logger
+}
+
+// NewSyncer создаёт синхронизатор файлов документов.
+func NewSyncer(client Downloader, store storage.ObjectStore, db *sqlx.DB, log *zap.Logger) *Syncer {
+	return &Syncer{client: client, store: store, db: db, log: log}
+}
+
+// pendingDocument – документ из contract_documents, файл которого ещё не загружен.
+type pendingDocument struct {
+	ID         int64  `db:"id"`
+	ContractID int64  `db:"contract_id"`
+	Data       []byte `db:"data"`
+}
+
+// Sync загружает файлы всех документов, для которых ещё нет записи в contract_files.
+// Документы обрабатываются последовательно, чтобы одинаковые файлы не загружались в хранилище
+// параллельно; ошибка отдельного документа не прерывает обработку остальных.
+func (s *Syncer) Sync(ctx context.Context) (Stats, error) {
+	var stats Stats
+	var pending []pendingDocument
+	err := s.db.SelectContext(ctx, &pending, `
+		SELECT d.id, d.contract_id, d.data
+		FROM contract_documents d
+		LEFT JOIN contract_files f ON f.document_id = d.id
+		WHERE f.id IS NULL AND d.contract_id IS NOT NULL
+		ORDER BY d.id`)
+	if err != nil {
+		return stats, fmt.Errorf("выборка документов без файлов: %w", err)
+	}
+
+	var errs []error
+	for _, doc := range pending {
+		if ctx.Err() != nil {
+			return stats, ctx.Err()
+		}
+		deduplicated, err := s.syncDocument(ctx, doc)
+		if err != nil {
+			s.log.Warn("Не удалось загрузить файл документа",
+				zap.Int64("documentId", doc.ID), zap.Int64("contractId", doc.ContractID), zap.Error(err))
+			stats.Failed++
+			errs = append(errs, fmt.Errorf("документ %d: %w", doc.ID, err))
+			continue
+		}
+		if deduplicated {
+			stats.Deduplicated++
+		} else {
+			stats.Downloaded++
+		}
+	}
+	return stats, errors.Join(errs...)
+}
+
+// syncDocument загружает файл документа и сохраняет его метаданные. Если у контракта уже есть
+// файл с той же контрольной суммой, объект повторно не сохраняется и возвращается true.
+func (s *Syncer) syncDocument(ctx context.Context, doc pendingDocument) (bool, error) {
+	var record map[string]interface{}
+	if err := json.Unmarshal(doc.Data, &record); err != nil {
+		return false, fmt.Errorf("разбор документа: %w", err)
+	}
+
+	fileID := doc.ID
+	if id, err := utils.ExtractIDField(record, "fileId"); err == nil {
+		fileID = id
+	}
+	data, err := s.client.Download(ctx, config.EndpointDocumentDownload, strconv.FormatInt(fileID, 10))
+	if err != nil {
+		return false, err
+	}
+
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+	fileName := documentFileName(record, doc.ID)
+	contentType := detectContentType(fileName, data)
+
+	var objectKey string
+	err = s.db.GetContext(ctx, &objectKey,
+		`SELECT object_key FROM contract_files WHERE contract_id = $1 AND sha256 = $2 LIMIT 1`,
+		doc.ContractID, checksum)
+	deduplicated := err == nil
+	switch {
+	case deduplicated:
+	case errors.Is(err, sql.ErrNoRows):
+		objectKey = ObjectKey(doc.ContractID, checksum)
+		if err := s.store.Put(ctx, objectKey, data, contentType); err != nil {
+			return false, err
+		}
+	default:
+		return false, fmt.Errorf("поиск файла по контрольной сумме: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO contract_files (contract_id, document_id, file_name, content_type, size, sha256, object_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (document_id) DO NOTHING`,
+		doc.ContractID, doc.ID, fileName, contentType, len(data), checksum, objectKey)
+	if err != nil {
+		return false, fmt.Errorf("сохранение метаданных файла: %w", err)
+	}
+	return deduplicated, nil
+}
+
+// ObjectKey возвращает ключ объекта в хранилище: файлы сгруппированы по контракту
+// и адресуются контрольной суммой содержимого.
+func ObjectKey(contractID int64, checksum string) string {
+	return fmt.Sprintf("contracts/%d/%s", contractID, checksum)
+}
+
+// documentFileName берёт имя файла из записи документа EAIST.
+func documentFileName(record map[string]interface{}, documentID int64) string {
+	for _, field := range []string{"fileName", "name", "title"} {
+		if name, ok := record[field].(string); ok && name != "" {
+			return filepath.Base(name)
+		}
+	}
+	return fmt.Sprintf("document-%d", documentID)
+}
+
+// detectContentType определяет тип содержимого по расширению файла, а при его отсутствии – по данным.
+func detectContentType(fileName string, data []byte) string {
+	if ct := mime.TypeByExtension(filepath.Ext(fileName)); ct != "" {
+		return ct
+	}
+	return http.DetectContentType(data)
+}
+
+// ListFiles возвращает файлы контракта; если store задан, к каждому файлу добавляется ссылка на скачивание.
+func ListFiles(ctx context.Context, db *sqlx.DB, store storage.ObjectStore, contractID int64) ([]File, error) {
+	files := []File{}
+	err := db.SelectContext(ctx, &files, `
+		SELECT id, contract_id, document_id, file_name, content_type, size, sha256, object_key, created_at
+		FROM contract_files
+		WHERE contract_id = $1
+		ORDER BY id`, contractID)
+	if err != nil {
+		return nil, err
+	}
+	if store == nil {
+		return files, nil
+	}
+	for i := range files {
+		url, err := store.PresignedURL(ctx, files[i].ObjectKey, files[i].FileName)
+		if err != nil {
+			return nil, err
+		}
+		files[i].URL = url
+	}
+	return files, nil
+}
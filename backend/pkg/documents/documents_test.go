@@ -0,0 +1,84 @@
+package documents
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// fakeDownloader отдаёт одинаковое содержимое для всех документов.
+type fakeDownloader struct{ calls []string }
+
+func (d *fakeDownloader) Download(_ context.Context, _ string, id string) ([]byte, error) {
+	d.calls = append(d.calls, id)
+	return []byte("%PDF-1.4 signed contract"), nil
+}
+
+// fakeStore запоминает сохранённые объекты.
+type fakeStore struct{ objects map[string]string }
+
+func (s *fakeStore) Put(_ context.Context, key string, _ []byte, contentType string) error {
+	s.objects[key] = contentType
+	return nil
+}
+
+func (s *fakeStore) PresignedURL(_ context.Context, key, _ string) (string, error) {
+	return "http://minio.local/" + key, nil
+}
+
+func TestSyncDeduplicatesByChecksum(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Ошибка создания sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	sum := sha256.Sum256([]byte("%PDF-1.4 signed contract"))
+	checksum := hex.EncodeToString(sum[:])
+	key := ObjectKey(42, checksum)
+
+	mock.ExpectQuery("SELECT d.id, d.contract_id, d.data").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "contract_id", "data"}).
+			AddRow(1, 42, []byte(`{"id":1,"fileName":"contract.pdf"}`)).
+			AddRow(2, 42, []byte(`{"id":2,"fileId":20,"name":"copy.pdf"}`)))
+
+	// Первый документ: файла с такой суммой ещё нет – объект сохраняется.
+	mock.ExpectQuery("SELECT object_key FROM contract_files").WithArgs(42, checksum).
+		WillReturnRows(sqlmock.NewRows([]string{"object_key"}))
+	mock.ExpectExec("INSERT INTO contract_files").
+		WithArgs(42, 1, "contract.pdf", "application/pdf", 24, checksum, key).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	// Второй документ с тем же содержимым использует уже сохранённый объект.
+	mock.ExpectQuery("SELECT object_key FROM contract_files").WithArgs(42, checksum).
+		WillReturnRows(sqlmock.NewRows([]string{"object_key"}).AddRow(key))
+	mock.ExpectExec("INSERT INTO contract_files").
+		WithArgs(42, 2, "copy.pdf", "application/pdf", 24, checksum, key).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+
+	downloader := &fakeDownloader{}
+	store := &fakeStore{objects: map[string]string{}}
+	syncer := NewSyncer(downloader, store, sqlx.NewDb(db, "sqlmock"), zap.NewNop())
+
+	stats, err := syncer.Sync(context.Background())
+	if err != nil {
+		t.Fatalf("Sync завершился ошибкой: %v", err)
+	}
+	if stats.Downloaded != 1 || stats.Deduplicated != 1 {
+		t.Errorf("Stats = %+v, ожидалось 1 сохранение и 1 совпадение", stats)
+	}
+	if len(store.objects) != 1 || store.objects[key] != "application/pdf" {
+		t.Errorf("Сохранены объекты %v, ожидался один объект %s", store.objects, key)
+	}
+	if len(downloader.calls) != 2 || downloader.calls[1] != "20" {
+		t.Errorf("Загружены файлы %v, ожидались 1 и 20", downloader.calls)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Не выполнены ожидания БД: %v", err)
+	}
+}
@@ -0,0 +1,294 @@
+// Package eaistmock реализует имитацию EAIST REST API на записанных JSON-фикстурах
+// для офлайн-тестирования синхронизации.
+package eaistmock
+
+import (
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Пути эндпоинтов, совпадающие с путями EAIST.
+const (
+	LoginPath     = "/module/protected-admin/api/login"
+	ContractsPath = "/eaist2rc/api/contracts/contract/list"
+	StatesPath    = "/eaist2rc/api/core/states/state/list"
+)
+
+// sessionCookie – имя cookie сессии, выдаваемой при авторизации.
+const sessionCookie = "SESSION"
+
+//go:embed fixtures/*.json
+var defaultFixtures embed.FS
+
+// Fixtures содержит записанные ответы EAIST.
+type Fixtures struct {
+	Contracts []map[string]interface{}
+	States    []map[string]interface{}
+}
+
+// DefaultFixtures возвращает фикстуры, встроенные в пакет.
+func DefaultFixtures() (*Fixtures, error) {
+	return loadFixtures(func(name string) ([]byte, error) {
+		return defaultFixtures.ReadFile("fixtures/" + name)
+	})
+}
+
+// LoadFixtures читает фикстуры contracts.json и states.json из каталога dir.
+func LoadFixtures(dir string) (*Fixtures, error) {
+	return loadFixtures(func(name string) ([]byte, error) {
+		return os.ReadFile(filepath.Join(dir, name))
+	})
+}
+
+// loadFixtures разбирает фикстуры, читая файлы функцией read.
+func loadFixtures(read func(name string) ([]byte, error)) (*Fixtures, error) {
+	var f Fixtures
+	for name, dst := range map[string]*[]map[string]interface{}{
+		"contracts.json": &f.Contracts,
+		"states.json":    &f.States,
+	} {
+		data, err := read(name)
+		if err != nil {
+			return nil, fmt.Errorf("чтение фикстуры %s: %w", name, err)
+		}
+		if err := json.Unmarshal(data, dst); err != nil {
+			return nil, fmt.Errorf("разбор фикстуры %s: %w", name, err)
+		}
+	}
+	return &f, nil
+}
+
+// Faults описывает сбои, которые имитирует сервер.
+type Faults struct {
+	Latency    time.Duration // задержка перед каждым ответом
+	ErrorRate  float64       // вероятность ответа 500 на запрос данных (0..1)
+	FailNext   int           // количество ближайших запросов данных, на которые вернётся 500
+	SessionTTL int           // количество запросов, после которого сессия истекает (0 – не истекает)
+}
+
+// Stats содержит счётчики обращений к серверу.
+type Stats struct {
+	Logins   int
+	Requests int
+	Failures int
+}
+
+// Server имитирует эндпоинты авторизации, списка контрактов и списка состояний EAIST.
+type Server struct {
+	mu       sync.Mutex
+	fixtures *Fixtures
+	username string
+	password string
+	faults   Faults
+	sessions map[string]int // токен сессии -> количество выполненных запросов
+	stats    Stats
+	mux      *http.ServeMux
+}
+
+// NewServer создаёт имитацию EAIST. Если username пуст, принимаются любые учётные данные.
+func NewServer(fixtures *Fixtures, username, password string) *Server {
+	s := &Server{
+		fixtures: fixtures,
+		username: username,
+		password: password,
+		sessions: make(map[string]int),
+		mux:      http.NewServeMux(),
+	}
+	s.mux.HandleFunc(LoginPath, s.handleLogin)
+	s.mux.HandleFunc(ContractsPath, s.protected(s.handleContracts))
+	s.mux.HandleFunc(StatesPath, s.protected(s.handleStates))
+	return s
+}
+
+// ServeHTTP реализует http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	latency := s.faults.Latency
+	s.mu.Unlock()
+	if latency > 0 {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(latency):
+		}
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// SetFaults задаёт имитируемые сбои.
+func (s *Server) SetFaults(f Faults) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = f
+}
+
+// ExpireSessions делает все выданные сессии недействительными.
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = make(map[string]int)
+}
+
+// Stats возвращает счётчики обращений.
+func (s *Server) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// handleLogin проверяет учётные данные и выдаёт cookie сессии.
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var creds struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if s.username != "" && (creds.Username != s.username || creds.Password != s.password) {
+		http.Error(w, `{"error":"invalid credentials"}`, http.StatusUnauthorized)
+		return
+	}
+
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	token := hex.EncodeToString(buf)
+
+	s.mu.Lock()
+	s.sessions[token] = 0
+	s.stats.Logins++
+	s.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: token, Path: "/", HttpOnly: true})
+	writeJSON(w, map[string]interface{}{"username": creds.Username})
+}
+
+// protected проверяет сессию и применяет имитацию сбоев перед вызовом обработчика.
+func (s *Server) protected(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(sessionCookie)
+
+		s.mu.Lock()
+		s.stats.Requests++
+		count, ok := 0, false
+		if err == nil {
+			count, ok = s.sessions[cookie.Value]
+		}
+		if ok && s.faults.SessionTTL > 0 && count >= s.faults.SessionTTL {
+			delete(s.sessions, cookie.Value)
+			ok = false
+		}
+		if !ok {
+			s.mu.Unlock()
+			http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		s.sessions[cookie.Value] = count + 1
+
+		fail := false
+		if s.faults.FailNext > 0 {
+			s.faults.FailNext--
+			fail = true
+		} else if s.faults.ErrorRate > 0 && mathrand.Float64() < s.faults.ErrorRate {
+			fail = true
+		}
+		if fail {
+			s.stats.Failures++
+		}
+		s.mu.Unlock()
+
+		if fail {
+			http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// listRequest – параметры запроса списка в формате EAIST.
+type listRequest struct {
+	Filter    map[string]interface{} `json:"filter"`
+	Skip      int                    `json:"skip"`
+	Take      int                    `json:"take"`
+	WithCount bool                   `json:"withCount"`
+}
+
+// handleContracts отдаёт страницу контрактов с учётом skip/take/withCount.
+func (s *Server) handleContracts(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeListRequest(r.Body)
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	writeList(w, s.fixtures.Contracts, req)
+}
+
+// handleStates отдаёт состояния, отфильтрованные по categoryCode.
+func (s *Server) handleStates(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeListRequest(r.Body)
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	items := s.fixtures.States
+	if category, ok := req.Filter["categoryCode"]; ok {
+		items = nil
+		for _, st := range s.fixtures.States {
+			if st["categoryCode"] == category {
+				items = append(items, st)
+			}
+		}
+	}
+	writeList(w, items, req)
+}
+
+// decodeListRequest разбирает тело запроса списка.
+func decodeListRequest(body io.Reader) (listRequest, error) {
+	var req listRequest
+	err := json.NewDecoder(body).Decode(&req)
+	return req, err
+}
+
+// writeList отдаёт срез items в формате {"items": [...], "count": N}.
+// Если take не задан, возвращаются все элементы начиная с skip; count заполняется только при withCount.
+func writeList(w http.ResponseWriter, items []map[string]interface{}, req listRequest) {
+	start := req.Skip
+	if start < 0 || start > len(items) {
+		start = len(items)
+	}
+	end := len(items)
+	if req.Take > 0 && start+req.Take < end {
+		end = start + req.Take
+	}
+	page := items[start:end]
+	if page == nil {
+		page = []map[string]interface{}{}
+	}
+
+	resp := map[string]interface{}{"items": page}
+	if req.WithCount {
+		resp["count"] = len(items)
+	}
+	writeJSON(w, resp)
+}
+
+// writeJSON сериализует v в тело ответа.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
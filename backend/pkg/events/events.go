@@ -0,0 +1,224 @@
+// Package events описывает события об изменениях контрактов, публикуемые в Kafka: конверт в стиле
+// CloudEvents 1.0 и JSON Schema данных событий.
+package events
+
+import (
+	"crypto/rand"
+	"embed"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Типы событий о контрактах.
+const (
+	TypeContractCreated      = "contract.created"
+	TypeContractUpdated      = "contract.updated"
+	TypeContractStateChanged = "contract.state_changed"
+	TypeContractRemoved      = "contract.removed"
+	TypeContractRestored     = "contract.restored"
+)
+
+// Типы ответов на входящие команды.
+const (
+	TypeCommandCompleted = "command.completed"
+	TypeCommandRejected  = "command.rejected"
+)
+
+const (
+	// SpecVersion – версия спецификации CloudEvents, которой следует конверт.
+	SpecVersion = "1.0"
+	// Source – источник событий.
+	Source = "/eaistsync"
+	// ContractSchemaName – имя JSON Schema событий о контрактах; при несовместимых изменениях
+	// данных выпускается новая версия схемы.
+	ContractSchemaName = "contract-event.v1.json"
+	// ContractSchemaURL – адрес, по которому HTTP API отдаёт схему.
+	ContractSchemaURL = "/api/schemas/" + ContractSchemaName
+	// CommandReplySchemaName – имя JSON Schema ответов на команды.
+	CommandReplySchemaName = "command-reply.v1.json"
+	// CommandReplySchemaURL – адрес схемы ответов на команды.
+	CommandReplySchemaURL = "/api/schemas/" + CommandReplySchemaName
+
+	// stateField – поле контракта EAIST с идентификатором состояния.
+	stateField = "stateId"
+)
+
+//go:embed schemas/*.json
+var schemas embed.FS
+
+// Schema возвращает опубликованную JSON Schema по имени файла.
+func Schema(name string) ([]byte, error) {
+	return schemas.ReadFile("schemas/" + name)
+}
+
+// Event – конверт события. Subject содержит ID контракта (или команды для ответов) и используется
+// как ключ сообщения Kafka, чтобы события одного контракта попадали в одну партицию и сохраняли порядок.
+type Event struct {
+	SpecVersion     string      `json:"specversion"`
+	ID              string      `json:"id"`
+	Source          string      `json:"source"`
+	Type            string      `json:"type"`
+	Subject         string      `json:"subject"`
+	Time            time.Time   `json:"time"`
+	DataContentType string      `json:"datacontenttype"`
+	DataSchema      string      `json:"dataschema"`
+	Data            interface{} `json:"data"`
+}
+
+// MessageKey возвращает ключ сообщения Kafka.
+func (e Event) MessageKey() string {
+	return e.Subject
+}
+
+// ContractCreated – данные события contract.created.
+type ContractCreated struct {
+	ContractID int64                  `json:"contractId"`
+	Contract   map[string]interface{} `json:"contract"`
+}
+
+// FieldChange – прежнее и новое значение поля контракта.
+type FieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// ContractUpdated – данные события contract.updated: только изменившиеся поля.
+type ContractUpdated struct {
+	ContractID int64                  `json:"contractId"`
+	Changes    map[string]FieldChange `json:"changes"`
+}
+
+// ContractStateChanged – данные события contract.state_changed.
+type ContractStateChanged struct {
+	ContractID      int64       `json:"contractId"`
+	PreviousStateID interface{} `json:"previousStateId"`
+	StateID         interface{} `json:"stateId"`
+}
+
+// ContractRemovedData – данные события contract.removed.
+type ContractRemovedData struct {
+	ContractID   int64     `json:"contractId"`
+	MissingSince time.Time `json:"missingSince"`
+}
+
+// ContractRestoredData – данные события contract.restored.
+type ContractRestoredData struct {
+	ContractID int64 `json:"contractId"`
+}
+
+// CommandReply – данные ответа на команду.
+type CommandReply struct {
+	CommandID   string `json:"commandId"`
+	CommandType string `json:"commandType"`
+	Error       string `json:"error,omitempty"`
+}
+
+// ContractChanged возвращает события о сохранении контракта: contract.created для нового контракта
+// (previous == nil), иначе contract.updated и, если изменилось состояние, contract.state_changed.
+func ContractChanged(id int64, previous, current map[string]interface{}, at time.Time) []Event {
+	if previous == nil {
+		return []Event{newContractEvent(TypeContractCreated, id, at, ContractCreated{ContractID: id, Contract: current})}
+	}
+	changes := diff(previous, current)
+	if len(changes) == 0 {
+		return nil
+	}
+	events := []Event{newContractEvent(TypeContractUpdated, id, at, ContractUpdated{ContractID: id, Changes: changes})}
+	if state, ok := changes[stateField]; ok {
+		events = append(events, newContractEvent(TypeContractStateChanged, id, at, ContractStateChanged{
+			ContractID:      id,
+			PreviousStateID: state.Old,
+			StateID:         state.New,
+		}))
+	}
+	return events
+}
+
+// ContractRemoved возвращает событие contract.removed для контракта, пропавшего из выборки EAIST.
+func ContractRemoved(id int64, missingSince time.Time) Event {
+	return newContractEvent(TypeContractRemoved, id, missingSince, ContractRemovedData{ContractID: id, MissingSince: missingSince})
+}
+
+// ContractRestored возвращает событие contract.restored для контракта, снова появившегося
+// в выборке EAIST после удаления.
+func ContractRestored(id int64, at time.Time) Event {
+	return newContractEvent(TypeContractRestored, id, at, ContractRestoredData{ContractID: id})
+}
+
+// CommandCompleted возвращает ответ на успешно выполненную команду.
+func CommandCompleted(commandID, commandType string, at time.Time) Event {
+	return newEvent(TypeCommandCompleted, commandID, CommandReplySchemaURL, at, CommandReply{CommandID: commandID, CommandType: commandType})
+}
+
+// CommandRejected возвращает ответ на команду, отклонённую при проверке.
+func CommandRejected(commandID, commandType string, reason error, at time.Time) Event {
+	return newEvent(TypeCommandRejected, commandID, CommandReplySchemaURL, at, CommandReply{
+		CommandID:   commandID,
+		CommandType: commandType,
+		Error:       reason.Error(),
+	})
+}
+
+// diff возвращает поля верхнего уровня, значения которых различаются; удалённое поле имеет New = nil.
+func diff(previous, current map[string]interface{}) map[string]FieldChange {
+	keys := make([]string, 0, len(previous)+len(current))
+	for k := range previous {
+		keys = append(keys, k)
+	}
+	for k := range current {
+		if _, ok := previous[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	changes := make(map[string]FieldChange)
+	for _, k := range keys {
+		// Прежние данные прочитаны из JSONB, поэтому сравниваются JSON-представления значений.
+		if !reflect.DeepEqual(normalize(previous[k]), normalize(current[k])) {
+			changes[k] = FieldChange{Old: previous[k], New: current[k]}
+		}
+	}
+	return changes
+}
+
+// normalize приводит целые числа к float64, как после декодирования JSON.
+func normalize(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	}
+	return v
+}
+
+func newContractEvent(typ string, contractID int64, at time.Time, data interface{}) Event {
+	return newEvent(typ, strconv.FormatInt(contractID, 10), ContractSchemaURL, at, data)
+}
+
+func newEvent(typ, subject, schema string, at time.Time, data interface{}) Event {
+	return Event{
+		SpecVersion:     SpecVersion,
+		ID:              newID(),
+		Source:          Source,
+		Type:            typ,
+		Subject:         subject,
+		Time:            at.UTC(),
+		DataContentType: "application/json",
+		DataSchema:      schema,
+		Data:            data,
+	}
+}
+
+// newID возвращает случайный UUID версии 4.
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,46 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestContractChanged(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	previous := map[string]interface{}{"id": float64(7), "stateId": float64(1), "price": 100.0, "note": "x"}
+	current := map[string]interface{}{"id": float64(7), "stateId": float64(2), "price": 100.0}
+
+	got := ContractChanged(7, previous, current, at)
+	if len(got) != 2 || got[0].Type != TypeContractUpdated || got[1].Type != TypeContractStateChanged {
+		t.Fatalf("события: %+v", got)
+	}
+	changes := got[0].Data.(ContractUpdated).Changes
+	if len(changes) != 2 || changes["stateId"].New != float64(2) || changes["note"].New != nil {
+		t.Errorf("изменения: %+v", changes)
+	}
+	if got[0].Subject != "7" || got[0].MessageKey() != "7" || got[0].ID == got[1].ID {
+		t.Errorf("конверт: %+v", got[0])
+	}
+
+	if created := ContractChanged(7, nil, current, at); len(created) != 1 || created[0].Type != TypeContractCreated {
+		t.Errorf("новый контракт: %+v", created)
+	}
+	if same := ContractChanged(7, current, current, at); len(same) != 0 {
+		t.Errorf("без изменений: %+v", same)
+	}
+}
+
+func TestSchemaPublished(t *testing.T) {
+	data, err := Schema(ContractSchemaName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("схема не является JSON: %v", err)
+	}
+	if schema["$id"] != ContractSchemaURL {
+		t.Errorf("$id = %v, want %s", schema["$id"], ContractSchemaURL)
+	}
+}
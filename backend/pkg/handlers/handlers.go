@@ -3,13 +3,18 @@ package handlers
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
 
+	"github.com/ryantrue/EaistSync/pkg/config"
 	"github.com/ryantrue/EaistSync/pkg/dbutils" // Импорт пакета с утилитами для работы с БД
+	"github.com/ryantrue/EaistSync/pkg/documents"
+	"github.com/ryantrue/EaistSync/pkg/events"
+	"github.com/ryantrue/EaistSync/pkg/storage"
 )
 
 // HandleGetRecords возвращает обработчик для GET-запросов, который выбирает данные по указанному запросу.
@@ -24,6 +29,91 @@ func HandleGetRecords(db *sqlx.DB, log *zap.Logger, query string, sourceName str
 	}
 }
 
+// contractsAsOfQuery выбирает версии контрактов, действовавшие в момент $1.
+const contractsAsOfQuery = `
+	SELECT contract_id AS id, data FROM contracts_history
+	WHERE valid_from <= $1 AND (valid_to IS NULL OR valid_to > $1)
+	ORDER BY contract_id`
+
+// ContractsHandler возвращает действующие контракты; с include_removed=true – также контракты,
+// пропавшие из выборки EAIST (с заполненным missing_since). С параметром as_of (RFC3339 или дата
+// YYYY-MM-DD) возвращает набор контрактов в том виде, в каком он был в указанный момент (для даты – на конец дня).
+func ContractsHandler(db *sqlx.DB, log *zap.Logger) echo.HandlerFunc {
+	active := HandleGetRecords(db, log, "SELECT * FROM contracts WHERE missing_since IS NULL", "contracts")
+	all := HandleGetRecords(db, log, "SELECT * FROM contracts", "contracts")
+	return func(c echo.Context) error {
+		value := c.QueryParam("as_of")
+		if value == "" {
+			if includeRemoved, _ := strconv.ParseBool(c.QueryParam("include_removed")); includeRemoved {
+				return all(c)
+			}
+			return active(c)
+		}
+		asOf, err := ParseAsOf(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Неверный формат as_of, ожидается RFC3339 или YYYY-MM-DD"})
+		}
+		records, err := dbutils.FetchRecords(db, log, contractsAsOfQuery, asOf)
+		if err != nil {
+			log.Error("Ошибка получения истории контрактов", zap.Time("asOf", asOf), zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Ошибка получения данных"})
+		}
+		return c.JSON(http.StatusOK, records)
+	}
+}
+
+// ParseAsOf разбирает момент времени в формате RFC3339 или дату YYYY-MM-DD (конец дня по местному времени).
+func ParseAsOf(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return day.AddDate(0, 0, 1).Add(-time.Microsecond), nil
+}
+
+// EAISTEndpointsHandler возвращает реестр эндпоинтов EAIST, с которыми работает синхронизация.
+func EAISTEndpointsHandler(cfg *config.Config) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"base_url":  cfg.EAIST.BaseURL,
+			"endpoints": cfg.EAIST.URLs(),
+		})
+	}
+}
+
+// EventSchemaHandler отдаёт опубликованную JSON Schema событий Kafka по имени файла.
+func EventSchemaHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		schema, err := events.Schema(c.Param("name"))
+		if err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Схема не найдена"})
+		}
+		return c.Blob(http.StatusOK, "application/schema+json", schema)
+	}
+}
+
+// ContractFilesHandler возвращает файлы документов контракта со ссылками на скачивание из хранилища.
+func ContractFilesHandler(db *sqlx.DB, store storage.ObjectStore, log *zap.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		contractID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Неверный идентификатор контракта"})
+		}
+		if store == nil {
+			return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "Хранилище файлов недоступно"})
+		}
+		files, err := documents.ListFiles(c.Request().Context(), db, store, contractID)
+		if err != nil {
+			log.Error("Ошибка получения файлов контракта", zap.Int64("contractId", contractID), zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Ошибка получения данных"})
+		}
+		return c.JSON(http.StatusOK, files)
+	}
+}
+
 // SSEHandler реализует сервер-сент эвенты (SSE) по адресу /api/events.
 func SSEHandler(log *zap.Logger) echo.HandlerFunc {
 	return func(c echo.Context) error {
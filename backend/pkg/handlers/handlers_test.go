@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+func TestContractsHandlerAsOf(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Ошибка создания sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	asOf := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("FROM contracts_history").WithArgs(asOf).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "data"}).AddRow(1, []byte(`{"id":1}`)))
+
+	e := echo.New()
+	handler := ContractsHandler(sqlx.NewDb(db, "sqlmock"), zap.NewNop())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/contracts?as_of=2026-03-01T12:00:00Z", nil)
+	rec := httptest.NewRecorder()
+	if err := handler(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("Ошибка обработчика: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Errorf("Код ответа %d, ожидался 200: %s", rec.Code, rec.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Не выполнены ожидания БД: %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/contracts?as_of=вчера", nil)
+	rec = httptest.NewRecorder()
+	if err := handler(e.NewContext(req, rec)); err != nil {
+		t.Fatalf("Ошибка обработчика: %v", err)
+	}
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Код ответа %d, ожидался 400", rec.Code)
+	}
+}
+
+func TestParseAsOfDate(t *testing.T) {
+	got, err := ParseAsOf("2026-03-01")
+	if err != nil {
+		t.Fatalf("Ошибка разбора даты: %v", err)
+	}
+	want := time.Date(2026, 3, 2, 0, 0, 0, 0, time.Local).Add(-time.Microsecond)
+	if !got.Equal(want) {
+		t.Errorf("ParseAsOf = %v, ожидалось %v", got, want)
+	}
+}
@@ -0,0 +1,145 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/IBM/sarama"
+	"go.uber.org/zap"
+)
+
+const (
+	consumerRetryDelay   = 5 * time.Second
+	consumerSessionDelay = 5 * time.Second
+)
+
+// Message – сообщение, прочитанное из Kafka.
+type Message struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+}
+
+// MessageHandler обрабатывает сообщение. Смещение фиксируется только после успешной обработки;
+// при ошибке сообщение будет прочитано повторно.
+type MessageHandler func(ctx context.Context, msg Message) error
+
+// ConsumerInterface описывает потребителя Kafka в составе consumer group.
+type ConsumerInterface interface {
+	// Run читает сообщения и передаёт их handler до отмены контекста или закрытия потребителя.
+	Run(ctx context.Context, handler MessageHandler) error
+	// Close завершает участие в группе.
+	Close() error
+}
+
+// kafkaConsumer реализует ConsumerInterface поверх sarama.ConsumerGroup.
+type kafkaConsumer struct {
+	group  sarama.ConsumerGroup
+	topics []string
+	logger *zap.Logger
+}
+
+// NewKafkaConsumer создаёт потребителя группы groupID для топиков topics. Автоматическая фиксация
+// смещений отключена: смещение фиксируется после того, как обработчик успешно выполнил действие.
+func NewKafkaConsumer(cfg KafkaConfig, groupID string, topics []string, logger *zap.Logger) (ConsumerInterface, error) {
+	config, err := cfg.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	config.Consumer.Offsets.AutoCommit.Enable = false
+	config.Consumer.Return.Errors = true
+
+	group, err := sarama.NewConsumerGroup(cfg.Brokers, groupID, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka consumer group: %w", err)
+	}
+
+	c := &kafkaConsumer{group: group, topics: topics, logger: logger}
+	go c.logErrors()
+	return c, nil
+}
+
+// Run участвует в группе до отмены контекста. После ребалансировки или ошибки сессии
+// подключение к группе повторяется.
+func (c *kafkaConsumer) Run(ctx context.Context, handler MessageHandler) error {
+	h := &groupHandler{handler: handler, logger: c.logger}
+	for {
+		if err := c.group.Consume(ctx, c.topics, h); err != nil {
+			if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+				return nil
+			}
+			c.logger.Warn("Ошибка сессии потребителя Kafka", zap.Strings("topics", c.topics), zap.Error(err))
+			select {
+			case <-ctx.Done():
+			case <-time.After(consumerSessionDelay):
+			}
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// Close закрывает потребителя, оборачивая возможные ошибки.
+func (c *kafkaConsumer) Close() error {
+	if err := c.group.Close(); err != nil {
+		return fmt.Errorf("failed to close Kafka consumer: %w", err)
+	}
+	return nil
+}
+
+func (c *kafkaConsumer) logErrors() {
+	for err := range c.group.Errors() {
+		c.logger.Warn("Ошибка потребителя Kafka", zap.Error(err))
+	}
+}
+
+// groupHandler передаёт сообщения партиции обработчику по одному.
+type groupHandler struct {
+	handler    MessageHandler
+	logger     *zap.Logger
+	retryDelay time.Duration
+}
+
+func (h *groupHandler) Setup(sarama.ConsumerGroupSession) error   { return nil }
+func (h *groupHandler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+// ConsumeClaim обрабатывает сообщения партиции. Начатая обработка не прерывается при завершении
+// сессии, чтобы действие не осталось выполненным наполовину. При ошибке сессия завершается
+// после паузы, и сообщение будет прочитано снова с последнего зафиксированного смещения.
+func (h *groupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	delay := h.retryDelay
+	if delay <= 0 {
+		delay = consumerRetryDelay
+	}
+	for {
+		select {
+		case <-sess.Context().Done():
+			return nil
+		case m, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			msg := Message{Topic: m.Topic, Partition: m.Partition, Offset: m.Offset, Key: m.Key, Value: m.Value}
+			if err := h.handler(context.WithoutCancel(sess.Context()), msg); err != nil {
+				h.logger.Warn("Не удалось обработать сообщение Kafka",
+					zap.String("topic", m.Topic),
+					zap.Int32("partition", m.Partition),
+					zap.Int64("offset", m.Offset),
+					zap.Error(err))
+				select {
+				case <-sess.Context().Done():
+				case <-time.After(delay):
+				}
+				return fmt.Errorf("message %s/%d/%d: %w", m.Topic, m.Partition, m.Offset, err)
+			}
+			sess.MarkMessage(m, "")
+			sess.Commit()
+		}
+	}
+}
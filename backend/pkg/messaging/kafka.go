@@ -14,6 +14,8 @@ import (
 type KafkaProducerInterface interface {
 	// PublishMessage отправляет сообщение в Kafka с поддержкой контекста.
 	PublishMessage(ctx context.Context, message interface{}) error
+	// PublishKeyedMessage отправляет сообщение с ключом: сообщения с одним ключом попадают в одну партицию.
+	PublishKeyedMessage(ctx context.Context, key string, message interface{}) error
 	// Close закрывает соединение продюсера.
 	Close() error
 }
@@ -27,14 +29,17 @@ type kafkaProducer struct {
 
 // NewKafkaProducer создаёт нового синхронного продюсера Kafka с заданными настройками.
 // Использование интерфейса улучшает тестирование и заменяемость компонента.
-func NewKafkaProducer(brokers []string, topic string, logger *zap.Logger) (KafkaProducerInterface, error) {
-	config := sarama.NewConfig()
+func NewKafkaProducer(cfg KafkaConfig, topic string, logger *zap.Logger) (KafkaProducerInterface, error) {
+	config, err := cfg.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
 	config.Producer.RequiredAcks = sarama.WaitForAll
 	config.Producer.Retry.Max = 5
 	config.Producer.Return.Successes = true
 	config.Producer.Timeout = 5 * time.Second
 
-	producer, err := sarama.NewSyncProducer(brokers, config)
+	producer, err := sarama.NewSyncProducer(cfg.Brokers, config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Kafka producer: %w", err)
 	}
@@ -49,6 +54,11 @@ func NewKafkaProducer(brokers []string, topic string, logger *zap.Logger) (Kafka
 // PublishMessage отправляет сообщение, предварительно сериализуя его в JSON.
 // Добавлен параметр контекста (context.Context) для возможности отмены операции, если это потребуется.
 func (kp *kafkaProducer) PublishMessage(ctx context.Context, message interface{}) error {
+	return kp.PublishKeyedMessage(ctx, "", message)
+}
+
+// PublishKeyedMessage отправляет сообщение с ключом key; пустой ключ не передаётся.
+func (kp *kafkaProducer) PublishKeyedMessage(ctx context.Context, key string, message interface{}) error {
 	// Проверяем, не отменён ли контекст до начала операции.
 	select {
 	case <-ctx.Done():
@@ -69,6 +79,9 @@ func (kp *kafkaProducer) PublishMessage(ctx context.Context, message interface{}
 		Topic: kp.topic,
 		Value: sarama.ByteEncoder(data),
 	}
+	if key != "" {
+		msg.Key = sarama.StringEncoder(key)
+	}
 
 	// Отправка сообщения.
 	partition, offset, err := kp.producer.SendMessage(msg)
@@ -0,0 +1,211 @@
+package messaging
+
+import (
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/IBM/sarama"
+)
+
+// KafkaConfig – параметры подключения к Kafka, общие для продюсера и потребителя.
+type KafkaConfig struct {
+	Brokers  []string
+	ClientID string
+
+	// SASL: "PLAIN", "SCRAM-SHA-256" или "SCRAM-SHA-512"; пустое значение отключает аутентификацию.
+	SASLMechanism string
+	SASLUsername  string
+	SASLPassword  string
+
+	// TLS: при пустом TLSCAFile используются системные корневые сертификаты.
+	TLS                   bool
+	TLSCAFile             string
+	TLSInsecureSkipVerify bool
+
+	Compression string // "none", "gzip", "snappy", "lz4" или "zstd"
+	Idempotent  bool   // идемпотентный продюсер: повторная отправка не создаёт дубликатов в партиции
+}
+
+// compressionCodecs сопоставляет названия алгоритмов сжатия кодекам sarama.
+var compressionCodecs = map[string]sarama.CompressionCodec{
+	"":       sarama.CompressionNone,
+	"none":   sarama.CompressionNone,
+	"gzip":   sarama.CompressionGZIP,
+	"snappy": sarama.CompressionSnappy,
+	"lz4":    sarama.CompressionLZ4,
+	"zstd":   sarama.CompressionZSTD,
+}
+
+// saramaConfig возвращает конфигурацию sarama с параметрами подключения, аутентификации и продюсера.
+func (c KafkaConfig) saramaConfig() (*sarama.Config, error) {
+	config := sarama.NewConfig()
+	if c.ClientID != "" {
+		config.ClientID = c.ClientID
+	}
+
+	if c.TLS {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: c.TLSInsecureSkipVerify}
+		if c.TLSCAFile != "" {
+			pem, err := os.ReadFile(c.TLSCAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read Kafka CA file: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in Kafka CA file %s", c.TLSCAFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+
+	if c.SASLMechanism != "" {
+		config.Net.SASL.Enable = true
+		config.Net.SASL.Handshake = true
+		config.Net.SASL.User = c.SASLUsername
+		config.Net.SASL.Password = c.SASLPassword
+		switch strings.ToUpper(c.SASLMechanism) {
+		case sarama.SASLTypePlaintext:
+			config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		case sarama.SASLTypeSCRAMSHA256:
+			config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hash: sha256.New} }
+		case sarama.SASLTypeSCRAMSHA512:
+			config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hash: sha512.New} }
+		default:
+			return nil, fmt.Errorf("unsupported SASL mechanism %q", c.SASLMechanism)
+		}
+	}
+
+	codec, ok := compressionCodecs[strings.ToLower(c.Compression)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported compression %q", c.Compression)
+	}
+	config.Producer.Compression = codec
+
+	if c.Idempotent {
+		// Требования sarama к идемпотентному продюсеру.
+		config.Version = sarama.V2_1_0_0
+		config.Producer.Idempotent = true
+		config.Producer.RequiredAcks = sarama.WaitForAll
+		config.Net.MaxOpenRequests = 1
+	}
+	return config, nil
+}
+
+// scramClient реализует клиентскую сторону SASL SCRAM (RFC 5802) для sarama.
+type scramClient struct {
+	hash func() hash.Hash
+
+	step            int
+	username        string
+	password        string
+	nonce           string
+	clientFirstBare string
+	serverSignature []byte
+	done            bool
+}
+
+func (s *scramClient) Begin(userName, password, _ string) error {
+	nonce := make([]byte, 24)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	s.username, s.password = userName, password
+	s.nonce = base64.RawStdEncoding.EncodeToString(nonce)
+	s.step, s.done = 0, false
+	return nil
+}
+
+func (s *scramClient) Step(challenge string) (string, error) {
+	s.step++
+	switch s.step {
+	case 1:
+		name := strings.NewReplacer("=", "=3D", ",", "=2C").Replace(s.username)
+		s.clientFirstBare = "n=" + name + ",r=" + s.nonce
+		return "n,," + s.clientFirstBare, nil
+	case 2:
+		return s.clientFinal(challenge)
+	case 3:
+		attrs := scramAttributes(challenge)
+		if e, ok := attrs["e"]; ok {
+			return "", fmt.Errorf("SCRAM server error: %s", e)
+		}
+		signature, err := base64.StdEncoding.DecodeString(attrs["v"])
+		if err != nil || subtle.ConstantTimeCompare(signature, s.serverSignature) != 1 {
+			return "", fmt.Errorf("SCRAM server signature mismatch")
+		}
+		s.done = true
+		return "", nil
+	}
+	return "", fmt.Errorf("unexpected SCRAM step %d", s.step)
+}
+
+// clientFinal вычисляет доказательство клиента по первому сообщению сервера.
+func (s *scramClient) clientFinal(serverFirst string) (string, error) {
+	attrs := scramAttributes(serverFirst)
+	nonce := attrs["r"]
+	if !strings.HasPrefix(nonce, s.nonce) {
+		return "", fmt.Errorf("SCRAM server nonce mismatch")
+	}
+	salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+	if err != nil {
+		return "", fmt.Errorf("invalid SCRAM salt: %w", err)
+	}
+	iterations, err := strconv.Atoi(attrs["i"])
+	if err != nil || iterations <= 0 {
+		return "", fmt.Errorf("invalid SCRAM iteration count %q", attrs["i"])
+	}
+
+	salted, err := pbkdf2.Key(s.hash, s.password, salt, iterations, s.hash().Size())
+	if err != nil {
+		return "", err
+	}
+	withoutProof := "c=biws,r=" + nonce
+	authMessage := s.clientFirstBare + "," + serverFirst + "," + withoutProof
+
+	clientKey := s.hmac(salted, "Client Key")
+	storedKey := s.hash()
+	storedKey.Write(clientKey)
+	proof := s.hmac(storedKey.Sum(nil), authMessage)
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+	s.serverSignature = s.hmac(s.hmac(salted, "Server Key"), authMessage)
+	return withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof), nil
+}
+
+func (s *scramClient) hmac(key []byte, message string) []byte {
+	mac := hmac.New(s.hash, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+func (s *scramClient) Done() bool {
+	return s.done
+}
+
+// scramAttributes разбирает сообщение SCRAM вида "a=value,b=value".
+func scramAttributes(message string) map[string]string {
+	attrs := make(map[string]string)
+	for _, part := range strings.Split(message, ",") {
+		if k, v, ok := strings.Cut(part, "="); ok {
+			attrs[k] = v
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,75 @@
+package messaging
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+// Пример обмена SCRAM-SHA-256 из RFC 7677, раздел 3.
+func TestSCRAMClientRFC7677(t *testing.T) {
+	c := &scramClient{hash: sha256.New}
+	if err := c.Begin("user", "pencil", ""); err != nil {
+		t.Fatal(err)
+	}
+	c.nonce = "rOprNGfwEbeRWgbNEkqO"
+
+	first, err := c.Step("")
+	if err != nil || first != "n,,n=user,r=rOprNGfwEbeRWgbNEkqO" {
+		t.Fatalf("client-first = %q, %v", first, err)
+	}
+	final, err := c.Step("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	want := "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+	if err != nil || final != want {
+		t.Fatalf("client-final = %q, %v", final, err)
+	}
+	if _, err := c.Step("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="); err != nil {
+		t.Fatal(err)
+	}
+	if !c.Done() {
+		t.Fatal("обмен SCRAM не завершён")
+	}
+}
+
+func TestSCRAMClientRejectsServerSignature(t *testing.T) {
+	c := &scramClient{hash: sha256.New}
+	_ = c.Begin("user", "pencil", "")
+	c.nonce = "rOprNGfwEbeRWgbNEkqO"
+	_, _ = c.Step("")
+	_, _ = c.Step("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	if _, err := c.Step("v=AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="); err == nil {
+		t.Fatal("ожидалась ошибка проверки подписи сервера")
+	}
+}
+
+func TestKafkaConfigSarama(t *testing.T) {
+	cfg := KafkaConfig{
+		Brokers:       []string{"kafka-1:9093", "kafka-2:9093"},
+		ClientID:      "eaistsync",
+		SASLMechanism: "scram-sha-512",
+		SASLUsername:  "eaist",
+		SASLPassword:  "secret",
+		TLS:           true,
+		Compression:   "zstd",
+		Idempotent:    true,
+	}
+	config, err := cfg.saramaConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ClientID != "eaistsync" || !config.Net.TLS.Enable || !config.Net.SASL.Enable ||
+		config.Net.SASL.Mechanism != sarama.SASLTypeSCRAMSHA512 || config.Net.SASL.SCRAMClientGeneratorFunc == nil {
+		t.Fatalf("net = %+v", config.Net)
+	}
+	if config.Producer.Compression != sarama.CompressionZSTD || !config.Producer.Idempotent || config.Net.MaxOpenRequests != 1 {
+		t.Fatalf("producer = %+v", config.Producer)
+	}
+
+	if _, err := (KafkaConfig{Compression: "brotli"}).saramaConfig(); err == nil {
+		t.Fatal("ожидалась ошибка для неизвестного сжатия")
+	}
+	if _, err := (KafkaConfig{TLS: true, TLSCAFile: "/nonexistent/ca.pem"}).saramaConfig(); err == nil {
+		t.Fatal("ожидалась ошибка для отсутствующего CA")
+	}
+}
@@ -0,0 +1,137 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const defaultNATSTimeout = 5 * time.Second
+
+// NATSConfig – параметры подключения к NATS.
+type NATSConfig struct {
+	URL     string // адреса серверов через запятую: nats://[user:password@]host:port или tls://host:port
+	Subject string
+	Timeout time.Duration // таймаут подключения и подтверждения публикации (по умолчанию 5 секунд)
+
+	// Аутентификация: пользователь и пароль задаются в URL, токен, файл учётных данных
+	// (JWT и seed NKey) или seed NKey без JWT – здесь.
+	Token        string
+	CredsFile    string
+	NKeySeedFile string
+
+	// TLS включается схемой tls:// или CA-файлом; клиентский сертификат нужен для mTLS.
+	TLSCAFile   string
+	TLSCertFile string
+	TLSKeyFile  string
+}
+
+// natsSink публикует события в NATS через клиент nats.go. Соединение устанавливается при первой
+// публикации, поэтому недоступность сервера не мешает запуску сервиса; после разрыва клиент сам
+// переподключается. Каждая публикация подтверждается сервером (flush), чтобы ошибка вернулась в Relay.
+type natsSink struct {
+	subject string
+	timeout time.Duration
+	url     string
+	opts    []nats.Option
+
+	mu   sync.Mutex
+	conn *nats.Conn
+}
+
+// NewNATSSink создаёт получателя, публикующего события в cfg.Subject. Ключ события передаётся
+// в заголовке X-Event-Key, если сервер поддерживает заголовки.
+func NewNATSSink(cfg NATSConfig) (EventSink, error) {
+	for _, raw := range strings.Split(cfg.URL, ",") {
+		if u, err := url.Parse(strings.TrimSpace(raw)); err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid NATS URL %q", raw)
+		}
+	}
+	if cfg.Subject == "" || strings.ContainsAny(cfg.Subject, " \t\r\n") {
+		return nil, fmt.Errorf("invalid NATS subject %q", cfg.Subject)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultNATSTimeout
+	}
+
+	opts := []nats.Option{
+		nats.Name("eaistsync"),
+		nats.Timeout(cfg.Timeout),
+		nats.MaxReconnects(-1),
+		// Без буфера публикация во время переподключения сразу завершается ошибкой,
+		// и событие остаётся в outbox до следующей попытки Relay.
+		nats.ReconnectBufSize(-1),
+	}
+	if cfg.Token != "" {
+		opts = append(opts, nats.Token(cfg.Token))
+	}
+	if cfg.CredsFile != "" {
+		opts = append(opts, nats.UserCredentials(cfg.CredsFile))
+	}
+	if cfg.NKeySeedFile != "" {
+		opt, err := nats.NkeyOptionFromSeed(cfg.NKeySeedFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read NATS NKey seed: %w", err)
+		}
+		opts = append(opts, opt)
+	}
+	if cfg.TLSCAFile != "" {
+		opts = append(opts, nats.RootCAs(cfg.TLSCAFile))
+	}
+	if cfg.TLSCertFile != "" {
+		opts = append(opts, nats.ClientCert(cfg.TLSCertFile, cfg.TLSKeyFile))
+	}
+	return &natsSink{subject: cfg.Subject, timeout: cfg.Timeout, url: cfg.URL, opts: opts}, nil
+}
+
+func (s *natsSink) Publish(ctx context.Context, key string, payload []byte) error {
+	conn, err := s.connection()
+	if err != nil {
+		return fmt.Errorf("nats: %w", err)
+	}
+
+	msg := &nats.Msg{Subject: s.subject, Data: payload}
+	if key != "" && conn.HeadersSupported() {
+		msg.Header = nats.Header{"X-Event-Key": []string{key}}
+	}
+	if err := conn.PublishMsg(msg); err != nil {
+		return fmt.Errorf("nats: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	if err := conn.FlushWithContext(ctx); err != nil {
+		return fmt.Errorf("nats: %w", err)
+	}
+	return nil
+}
+
+// connection возвращает соединение, подключаясь заново, если его ещё нет или клиент его закрыл.
+func (s *natsSink) connection() (*nats.Conn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil && !s.conn.IsClosed() {
+		return s.conn, nil
+	}
+	conn, err := nats.Connect(s.url, s.opts...)
+	if err != nil {
+		return nil, err
+	}
+	s.conn = conn
+	return conn, nil
+}
+
+// Close закрывает соединение; опубликованные события к этому моменту уже подтверждены сервером.
+func (s *natsSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package messaging
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultRelayInterval = 5 * time.Second
+	relayBatchSize       = 100
+	relayBaseDelay       = time.Second
+	relayMaxDelay        = 5 * time.Minute
+	// relayLockID – ключ advisory-блокировки: публикует только один Relay, иначе порядок нарушался бы.
+	relayLockID = 7415001
+	// purgeInterval – как часто удаляются сообщения старше срока хранения.
+	purgeInterval = time.Hour
+)
+
+// Keyed реализуется сообщениями, которые публикуются с ключом упорядочивания (ключом Kafka).
+type Keyed interface {
+	MessageKey() string
+}
+
+// Enqueue записывает сообщения в таблицу outbox. Вызывается в той же транзакции, что и изменения
+// данных, поэтому событие не теряется, даже если получатель недоступен: его опубликует Relay.
+// Для сообщений, реализующих Keyed, сохраняется ключ.
+func Enqueue(ctx context.Context, exec sqlx.ExecerContext, messages ...interface{}) error {
+	for _, message := range messages {
+		if message == nil {
+			return fmt.Errorf("message is nil")
+		}
+		data, err := json.Marshal(message)
+		if err != nil {
+			return fmt.Errorf("failed to marshal message: %w", err)
+		}
+		var key sql.NullString
+		if k, ok := message.(Keyed); ok {
+			key = sql.NullString{String: k.MessageKey(), Valid: true}
+		}
+		if _, err := exec.ExecContext(ctx, `INSERT INTO outbox (key, payload) VALUES ($1, $2)`, key, data); err != nil {
+			return fmt.Errorf("failed to enqueue message: %w", err)
+		}
+	}
+	return nil
+}
+
+// Requeue возвращает в очередь сообщения outbox, записанные начиная с since, и возвращает их число.
+// Ответы на команды повторно не отправляются.
+func Requeue(ctx context.Context, exec sqlx.ExecerContext, since time.Time) (int64, error) {
+	res, err := exec.ExecContext(ctx, `
+		UPDATE outbox SET sent_at = NULL, attempts = 0, last_error = NULL, next_attempt_at = now()
+		WHERE created_at >= $1 AND sent_at IS NOT NULL AND coalesce(payload->>'type', '') NOT LIKE 'command.%'`, since)
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue outbox messages: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// outboxRow – неотправленное сообщение outbox.
+type outboxRow struct {
+	ID       int64          `db:"id"`
+	Key      sql.NullString `db:"key"`
+	Payload  []byte         `db:"payload"`
+	Attempts int            `db:"attempts"`
+	Due      bool           `db:"due"` // наступило ли время следующей попытки
+}
+
+// Relay публикует сообщения из outbox в получатели событий в порядке записи и помечает их отправленными.
+// Доставка – at-least-once: сообщение, отправленное перед сбоем фиксации, будет отправлено повторно.
+// Отправленные сообщения хранятся retention (см. WithRetention), после чего удаляются.
+type Relay struct {
+	db        *sqlx.DB
+	sink      EventSink
+	logger    *zap.Logger
+	interval  time.Duration
+	retention time.Duration
+	lastPurge time.Time
+}
+
+// NewRelay создаёт Relay, проверяющий outbox каждые interval (по умолчанию 5 секунд).
+func NewRelay(db *sqlx.DB, sink EventSink, logger *zap.Logger, interval time.Duration) *Relay {
+	if interval <= 0 {
+		interval = defaultRelayInterval
+	}
+	return &Relay{db: db, sink: sink, logger: logger, interval: interval}
+}
+
+// WithRetention задаёт, сколько хранятся отправленные сообщения; 0 – хранить бессрочно.
+// Команда replay может вернуть в очередь только сообщения, которые ещё хранятся.
+func (r *Relay) WithRetention(retention time.Duration) *Relay {
+	r.retention = retention
+	return r
+}
+
+// Run публикует накопленные сообщения до отмены контекста.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		r.purge(ctx)
+		for {
+			sent, err := r.Flush(ctx)
+			if err != nil {
+				r.logger.Warn("Не удалось опубликовать сообщения outbox", zap.Int("sent", sent), zap.Error(err))
+			}
+			// Полный пакет означает, что в outbox могут остаться сообщения.
+			if err != nil || sent < relayBatchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush публикует один пакет готовых к отправке сообщений и возвращает число отправленных.
+// На первой ошибке публикация останавливается, чтобы сохранить порядок сообщений; сообщение
+// откладывается с экспоненциальной задержкой, и пока его время не наступит, более поздние
+// сообщения тоже ждут. Одновременно публикует только один Relay.
+func (r *Relay) Flush(ctx context.Context) (sent int, err error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	// Ошибка публикации не мешает зафиксировать отметки об отправке и отложенную попытку;
+	// при ошибке БД транзакция откатывается, и уже опубликованные сообщения будут отправлены повторно.
+	var pubErr error
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				err = errors.Join(err, rbErr)
+			}
+			return
+		}
+		if err = tx.Commit(); err != nil {
+			return
+		}
+		err = pubErr
+	}()
+
+	var locked bool
+	if err = tx.GetContext(ctx, &locked, `SELECT pg_try_advisory_xact_lock($1)`, relayLockID); err != nil {
+		return 0, fmt.Errorf("failed to lock outbox: %w", err)
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	var rows []outboxRow
+	err = tx.SelectContext(ctx, &rows, `
+		SELECT id, key, payload, attempts, next_attempt_at <= now() AS due FROM outbox
+		WHERE sent_at IS NULL
+		ORDER BY id
+		LIMIT $1`, relayBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to select outbox: %w", err)
+	}
+
+	for _, row := range rows {
+		// Отложенное сообщение задерживает все следующие за ним.
+		if !row.Due {
+			break
+		}
+		if pubErr = r.sink.Publish(ctx, row.Key.String, row.Payload); pubErr != nil {
+			pubErr = fmt.Errorf("outbox message %d: %w", row.ID, pubErr)
+			_, err = tx.ExecContext(ctx,
+				`UPDATE outbox SET attempts = attempts + 1, last_error = $2, next_attempt_at = now() + $3 * interval '1 millisecond' WHERE id = $1`,
+				row.ID, pubErr.Error(), retryDelay(row.Attempts+1).Milliseconds())
+			if err != nil {
+				return sent, fmt.Errorf("failed to postpone outbox message %d: %w", row.ID, err)
+			}
+			break
+		}
+		if _, err = tx.ExecContext(ctx, `UPDATE outbox SET sent_at = now() WHERE id = $1`, row.ID); err != nil {
+			return sent, fmt.Errorf("failed to mark outbox message %d as sent: %w", row.ID, err)
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// purge не чаще раза в purgeInterval удаляет сообщения, отправленные раньше срока хранения.
+func (r *Relay) purge(ctx context.Context) {
+	if r.retention <= 0 || time.Since(r.lastPurge) < purgeInterval {
+		return
+	}
+	r.lastPurge = time.Now()
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM outbox WHERE sent_at < now() - $1 * interval '1 millisecond'`, r.retention.Milliseconds())
+	if err != nil {
+		r.logger.Warn("Не удалось удалить старые сообщения outbox", zap.Error(err))
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		r.logger.Info("Удалены старые сообщения outbox", zap.Int64("count", n))
+	}
+}
+
+// retryDelay возвращает задержку перед attempt-й повторной публикацией.
+func retryDelay(attempt int) time.Duration {
+	delay := relayBaseDelay
+	for i := 1; i < attempt && delay < relayMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, relayMaxDelay)
+}
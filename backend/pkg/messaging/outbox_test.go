@@ -0,0 +1,122 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// flakyProducer отправляет первые ok сообщений и отказывает на остальных.
+type flakyProducer struct {
+	ok   int
+	sent []string
+	keys []string
+}
+
+func (p *flakyProducer) Publish(_ context.Context, key string, payload []byte) error {
+	if len(p.sent) >= p.ok {
+		return errors.New("kafka: broker not available")
+	}
+	p.sent = append(p.sent, string(payload))
+	p.keys = append(p.keys, key)
+	return nil
+}
+
+func (p *flakyProducer) Close() error { return nil }
+
+func TestRelayFlushStopsOnFailure(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	producer := &flakyProducer{ok: 1}
+	relay := NewRelay(sqlx.NewDb(sqlDB, "sqlmock"), producer, zap.NewNop(), time.Second)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT pg_try_advisory_xact_lock").WithArgs(relayLockID).
+		WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+	mock.ExpectQuery("SELECT id, key, payload, attempts, next_attempt_at <= now\\(\\) AS due FROM outbox").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "key", "payload", "attempts", "due"}).
+			AddRow(1, "1048571", []byte(`{"type":"contract.updated"}`), 0, true).
+			AddRow(2, nil, []byte(`{"event":"data_updated"}`), 2, true).
+			AddRow(3, "1048571", []byte(`{"type":"contract.removed"}`), 0, true))
+	mock.ExpectExec("UPDATE outbox SET sent_at").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	// Второе сообщение откладывается на 4 секунды (третья попытка), третье не отправляется.
+	mock.ExpectExec("UPDATE outbox SET attempts").
+		WithArgs(2, sqlmock.AnyArg(), int64(4000)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	sent, err := relay.Flush(context.Background())
+	if err == nil {
+		t.Fatal("ожидалась ошибка публикации")
+	}
+	if sent != 1 || len(producer.sent) != 1 || producer.sent[0] != `{"type":"contract.updated"}` || producer.keys[0] != "1048571" {
+		t.Fatalf("sent = %d, producer.sent = %v, keys = %v", sent, producer.sent, producer.keys)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRelayFlushWaitsForHead(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	producer := &flakyProducer{ok: 10}
+	relay := NewRelay(sqlx.NewDb(sqlDB, "sqlmock"), producer, zap.NewNop(), time.Second)
+
+	// Первое сообщение отложено после ошибки: следующие не должны его обгонять.
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT pg_try_advisory_xact_lock").WithArgs(relayLockID).
+		WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+	mock.ExpectQuery("SELECT id, key, payload, attempts").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "key", "payload", "attempts", "due"}).
+			AddRow(1, "1048571", []byte(`{"type":"contract.updated"}`), 1, false).
+			AddRow(2, "1048572", []byte(`{"type":"contract.created"}`), 0, true))
+	mock.ExpectCommit()
+
+	sent, err := relay.Flush(context.Background())
+	if err != nil || sent != 0 || len(producer.sent) != 0 {
+		t.Fatalf("sent = %d, err = %v, producer.sent = %v", sent, err, producer.sent)
+	}
+
+	// Другой Relay уже публикует: этот ничего не делает.
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT pg_try_advisory_xact_lock").WithArgs(relayLockID).
+		WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(false))
+	mock.ExpectCommit()
+
+	if sent, err := relay.Flush(context.Background()); err != nil || sent != 0 {
+		t.Fatalf("sent = %d, err = %v", sent, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEnqueue(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	mock.ExpectExec("INSERT INTO outbox").WithArgs(nil, []byte(`{"event":"data_updated"}`)).WillReturnResult(sqlmock.NewResult(1, 1))
+	if err := Enqueue(context.Background(), sqlx.NewDb(sqlDB, "sqlmock"), map[string]interface{}{"event": "data_updated"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,174 @@
+package messaging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// EventSink – получатель событий из outbox. Payload – сериализованное в JSON событие,
+// key – ключ упорядочивания (ID контракта), может быть пустым.
+type EventSink interface {
+	Publish(ctx context.Context, key string, payload []byte) error
+	Close() error
+}
+
+// fanOut публикует событие во все вложенные получатели.
+type fanOut struct {
+	sinks []EventSink
+}
+
+// NewFanOut объединяет получателей. Событие считается опубликованным, только если его приняли все;
+// при повторной публикации получатели, уже принявшие событие, получат его ещё раз.
+// Без получателей события только отмечаются отправленными.
+func NewFanOut(sinks ...EventSink) EventSink {
+	return &fanOut{sinks: sinks}
+}
+
+func (f *fanOut) Publish(ctx context.Context, key string, payload []byte) error {
+	var errs []error
+	for _, s := range f.sinks {
+		if err := s.Publish(ctx, key, payload); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f *fanOut) Close() error {
+	var errs []error
+	for _, s := range f.sinks {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// kafkaSink создаёт продюсера при первой публикации, поэтому недоступность Kafka при запуске
+// не мешает работе сервиса: события остаются в outbox и публикуются после восстановления брокера.
+type kafkaSink struct {
+	cfg    KafkaConfig
+	topic  string
+	logger *zap.Logger
+
+	mu       sync.Mutex
+	producer KafkaProducerInterface
+}
+
+// NewKafkaSink создаёт получателя, публикующего события в топик topic.
+func NewKafkaSink(cfg KafkaConfig, topic string, logger *zap.Logger) EventSink {
+	return &kafkaSink{cfg: cfg, topic: topic, logger: logger}
+}
+
+func (s *kafkaSink) Publish(ctx context.Context, key string, payload []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.producer == nil {
+		producer, err := NewKafkaProducer(s.cfg, s.topic, s.logger)
+		if err != nil {
+			return fmt.Errorf("kafka: %w", err)
+		}
+		s.producer = producer
+		s.logger.Info("Kafka продюсер успешно создан", zap.Strings("brokers", s.cfg.Brokers))
+	}
+	if err := s.producer.PublishKeyedMessage(ctx, key, json.RawMessage(payload)); err != nil {
+		return fmt.Errorf("kafka: %w", err)
+	}
+	return nil
+}
+
+func (s *kafkaSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.producer == nil {
+		return nil
+	}
+	return s.producer.Close()
+}
+
+// webhookSink отправляет каждое событие POST-запросом на заданный URL.
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink создаёт получателя, отправляющего события на url. Ключ передаётся в заголовке
+// X-Event-Key; ответ с кодом вне 2xx считается ошибкой.
+func NewWebhookSink(url string, timeout time.Duration) EventSink {
+	return &webhookSink{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (s *webhookSink) Publish(ctx context.Context, key string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("X-Event-Key", key)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook: %s ответил %d", s.url, resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *webhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// fileSink дописывает события в файл, по одному JSON на строку.
+type fileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink открывает (или создаёт) файл path для дозаписи событий.
+func NewFileSink(path string) (EventSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create events directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open events file: %w", err)
+	}
+	return &fileSink{file: file}, nil
+}
+
+func (s *fileSink) Publish(_ context.Context, _ string, payload []byte) error {
+	// Payload из JSONB не содержит переводов строк, но событие, сериализованное с отступами, сжимается.
+	var line bytes.Buffer
+	if err := json.Compact(&line, payload); err != nil {
+		return fmt.Errorf("file: %w", err)
+	}
+	line.WriteByte('\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(line.Bytes()); err != nil {
+		return fmt.Errorf("file: %w", err)
+	}
+	return nil
+}
+
+func (s *fileSink) Close() error {
+	return s.file.Close()
+}
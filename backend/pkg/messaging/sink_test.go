@@ -0,0 +1,150 @@
+package messaging
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingSink запоминает события и возвращает err.
+type recordingSink struct {
+	payloads []string
+	err      error
+}
+
+func (s *recordingSink) Publish(_ context.Context, _ string, payload []byte) error {
+	s.payloads = append(s.payloads, string(payload))
+	return s.err
+}
+
+func (s *recordingSink) Close() error { return nil }
+
+func TestFanOutPublishesToAllSinks(t *testing.T) {
+	ok := &recordingSink{}
+	failing := &recordingSink{err: errors.New("down")}
+	sink := NewFanOut(ok, failing)
+
+	if err := sink.Publish(context.Background(), "1", []byte(`{}`)); err == nil {
+		t.Fatal("ожидалась ошибка недоступного получателя")
+	}
+	if len(ok.payloads) != 1 || len(failing.payloads) != 1 {
+		t.Fatalf("ok = %v, failing = %v", ok.payloads, failing.payloads)
+	}
+	if err := NewFanOut().Publish(context.Background(), "1", []byte(`{}`)); err != nil {
+		t.Fatalf("без получателей: %v", err)
+	}
+}
+
+func TestFileSinkAppendsLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events", "events.jsonl")
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, payload := range []string{"{\n  \"id\": 1\n}", `{"id":2}`} {
+		if err := sink.Publish(context.Background(), "", []byte(payload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != "{\"id\":1}\n{\"id\":2}\n" {
+		t.Fatalf("file = %q", got)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var gotKey, gotBody string
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotKey, gotBody = r.Header.Get("X-Event-Key"), string(body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	sink := NewWebhookSink(srv.URL, time.Second)
+	if err := sink.Publish(context.Background(), "1048571", []byte(`{"type":"contract.updated"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if gotKey != "1048571" || gotBody != `{"type":"contract.updated"}` {
+		t.Fatalf("key = %q, body = %q", gotKey, gotBody)
+	}
+
+	status = http.StatusBadGateway
+	if err := sink.Publish(context.Background(), "", []byte(`{}`)); err == nil {
+		t.Fatal("ожидалась ошибка для ответа 502")
+	}
+}
+
+// fakeNATS принимает одно соединение, выполняет рукопожатие и пересылает опубликованные
+// сообщения в канал.
+func fakeNATS(t *testing.T) (string, <-chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	published := make(chan string, 4)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.WriteString(conn, "INFO {\"server_id\":\"test\",\"headers\":true,\"proto\":1,\"max_payload\":1048576}\r\n")
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			switch fields[0] {
+			case "PING":
+				io.WriteString(conn, "PONG\r\n")
+			case "HPUB", "PUB":
+				size, _ := strconv.Atoi(fields[len(fields)-1])
+				msg := make([]byte, size+2)
+				if _, err := io.ReadFull(r, msg); err != nil {
+					return
+				}
+				published <- fields[1] + " " + string(msg[:size])
+			}
+		}
+	}()
+	return "nats://" + ln.Addr().String(), published
+}
+
+func TestNATSSinkPublishes(t *testing.T) {
+	url, published := fakeNATS(t)
+	sink, err := NewNATSSink(NATSConfig{URL: url, Subject: "eaist.updates", Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	if err := sink.Publish(context.Background(), "1048571", []byte(`{"id":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	want := "eaist.updates NATS/1.0\r\nX-Event-Key: 1048571\r\n\r\n{\"id\":1}"
+	if got := <-published; got != want {
+		t.Fatalf("published = %q, want %q", got, want)
+	}
+}
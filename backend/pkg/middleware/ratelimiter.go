@@ -1,69 +1,120 @@
 package middleware
 
 import (
+	"math"
 	"net/http"
-	"sync"
+	"strconv"
 	"time"
 
 	"github.com/labstack/echo/v4"
-	"golang.org/x/time/rate"
+	"go.uber.org/zap"
+
+	"github.com/ryantrue/EaistSync/pkg/config"
+)
+
+// Типы клиентов, для которых действуют разные лимиты.
+const (
+	PrincipalAnonymous = "ip"
+	PrincipalUser      = "user"
+	PrincipalAPIKey    = "apikey"
 )
 
-type ipLimiter struct {
-	limiter  *rate.Limiter
-	lastSeen time.Time
+// Principal идентифицирует клиента, к которому применяется лимит.
+type Principal struct {
+	Kind string // PrincipalAnonymous, PrincipalUser или PrincipalAPIKey
+	ID   string
 }
 
-var (
-	clients   = make(map[string]*ipLimiter)
-	mu        sync.Mutex
-	cleanupIn = 5 * time.Minute
-)
+// PrincipalFunc определяет клиента по запросу.
+type PrincipalFunc func(c echo.Context) Principal
+
+// ipPrincipal – определение клиента по умолчанию: все запросы считаются анонимными.
+func ipPrincipal(c echo.Context) Principal {
+	return Principal{Kind: PrincipalAnonymous, ID: c.RealIP()}
+}
 
-// getLimiter возвращает лимитер для IP, создавая новый при необходимости.
-func getLimiter(ip string) *rate.Limiter {
-	mu.Lock()
-	defer mu.Unlock()
+// RateLimiter применяет лимиты по типу клиента и по маршрутам.
+type RateLimiter struct {
+	cfg       config.RateLimitConfig
+	store     Store
+	principal PrincipalFunc
+	log       *zap.Logger
+}
 
-	if limiter, exists := clients[ip]; exists {
-		limiter.lastSeen = time.Now()
-		return limiter.limiter
+// NewRateLimiter создаёт лимитер. Если principal равен nil, клиенты различаются только по IP.
+func NewRateLimiter(cfg config.RateLimitConfig, store Store, principal PrincipalFunc, log *zap.Logger) *RateLimiter {
+	if principal == nil {
+		principal = ipPrincipal
 	}
+	return &RateLimiter{cfg: cfg, store: store, principal: principal, log: log}
+}
 
-	limiter := rate.NewLimiter(1, 5) // 1 запрос в секунду, burst до 5
-	clients[ip] = &ipLimiter{
-		limiter:  limiter,
-		lastSeen: time.Now(),
+// NewStore создаёт хранилище лимитов, указанное в конфигурации.
+func NewStore(cfg config.RateLimitConfig) Store {
+	if cfg.Store == "redis" {
+		return NewRedisStore(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB)
 	}
-	return limiter
+	return NewMemoryStore(5 * time.Minute)
 }
 
-// Cleanup удаляет лимитеры, которые не использовались более заданного времени.
-func Cleanup() {
-	for {
-		time.Sleep(cleanupIn)
-		mu.Lock()
-		for ip, limiter := range clients {
-			if time.Since(limiter.lastSeen) > cleanupIn {
-				delete(clients, ip)
-			}
-		}
-		mu.Unlock()
+// ruleFor возвращает лимит для типа клиента.
+func (rl *RateLimiter) ruleFor(kind string) config.RateLimitRule {
+	switch kind {
+	case PrincipalUser:
+		return rl.cfg.User
+	case PrincipalAPIKey:
+		return rl.cfg.APIKey
+	default:
+		return rl.cfg.Anonymous
 	}
 }
 
-// RateLimiterMiddleware ограничивает количество запросов от одного IP.
-func RateLimiterMiddleware() echo.MiddlewareFunc {
-	// Запускаем cleanup в фоне.
-	go Cleanup()
+// Middleware возвращает echo middleware, проверяющее лимиты и выставляющее заголовки X-RateLimit-*.
+// При недоступности хранилища запрос пропускается, чтобы сбой лимитера не останавливал API.
+func (rl *RateLimiter) Middleware() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			ip := c.RealIP()
-			limiter := getLimiter(ip)
-			if !limiter.Allow() {
+			if !rl.cfg.Enabled {
+				return next(c)
+			}
+			ctx := c.Request().Context()
+			p := rl.principal(c)
+			base := p.Kind + ":" + p.ID
+
+			res, err := rl.store.Allow(ctx, base, rl.ruleFor(p.Kind))
+			if err != nil {
+				rl.log.Warn("Ошибка хранилища лимитов", zap.Error(err))
+				return next(c)
+			}
+
+			// Лимит маршрута проверяется дополнительно к лимиту клиента; в заголовки попадает более строгий.
+			if route, ok := rl.cfg.Routes[c.Path()]; ok && res.Allowed {
+				routeRes, err := rl.store.Allow(ctx, base+":"+c.Path(), route)
+				if err != nil {
+					rl.log.Warn("Ошибка хранилища лимитов", zap.Error(err))
+				} else if !routeRes.Allowed || routeRes.Remaining < res.Remaining {
+					res = routeRes
+				}
+			}
+
+			setRateLimitHeaders(c.Response().Header(), res)
+			if !res.Allowed {
+				c.Response().Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
 				return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "Слишком много запросов"})
 			}
 			return next(c)
 		}
 	}
 }
+
+// setRateLimitHeaders выставляет заголовки с состоянием лимита.
+func setRateLimitHeaders(h http.Header, res Result) {
+	h.Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(res.ResetAfter)))
+}
+
+// ceilSeconds округляет длительность вверх до целых секунд.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
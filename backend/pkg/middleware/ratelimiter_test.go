@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+
+	"github.com/ryantrue/EaistSync/pkg/config"
+)
+
+func TestMemoryStoreGCRA(t *testing.T) {
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+	now := time.Unix(1700000000, 0)
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	rule := config.RateLimitRule{Requests: 3, Period: 3 * time.Second}
+	for i := 0; i < 3; i++ {
+		res, _ := store.Allow(ctx, "k", rule)
+		if !res.Allowed {
+			t.Fatalf("Запрос %d отклонён, хотя укладывается в burst", i+1)
+		}
+		if res.Remaining != 2-i {
+			t.Errorf("Запрос %d: Remaining = %d, ожидалось %d", i+1, res.Remaining, 2-i)
+		}
+	}
+
+	res, _ := store.Allow(ctx, "k", rule)
+	if res.Allowed {
+		t.Fatal("Четвёртый запрос должен быть отклонён")
+	}
+	if res.RetryAfter != time.Second {
+		t.Errorf("RetryAfter = %v, ожидалась 1s", res.RetryAfter)
+	}
+
+	// Через секунду восстанавливается один запрос.
+	now = now.Add(time.Second)
+	if res, _ := store.Allow(ctx, "k", rule); !res.Allowed {
+		t.Error("После ожидания запрос должен быть разрешён")
+	}
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	cfg := config.RateLimitConfig{
+		Enabled:   true,
+		Anonymous: config.RateLimitRule{Requests: 1, Period: time.Minute},
+		User:      config.RateLimitRule{Requests: 5, Period: time.Minute},
+		Routes: map[string]config.RateLimitRule{
+			"/login": {Requests: 2, Period: time.Minute},
+		},
+	}
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+
+	principal := func(c echo.Context) Principal {
+		if u := c.Request().Header.Get("X-User"); u != "" {
+			return Principal{Kind: PrincipalUser, ID: u}
+		}
+		return Principal{Kind: PrincipalAnonymous, ID: c.RealIP()}
+	}
+	logger, _ := zap.NewDevelopment()
+	limiter := NewRateLimiter(cfg, store, principal, logger)
+
+	e := echo.New()
+	e.Use(limiter.Middleware())
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	e.GET("/contracts", ok)
+	e.POST("/login", ok)
+
+	do := func(method, path, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if user != "" {
+			req.Header.Set("X-User", user)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Анонимный клиент: один запрос в минуту.
+	if rec := do(http.MethodGet, "/contracts", ""); rec.Code != http.StatusOK {
+		t.Fatalf("Первый анонимный запрос: статус %d", rec.Code)
+	}
+	rec := do(http.MethodGet, "/contracts", "")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Второй анонимный запрос: статус %d, ожидался 429", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Отсутствует заголовок Retry-After")
+	}
+
+	// Пользователь: собственный лимит, но маршрут /login ограничен двумя запросами.
+	rec = do(http.MethodGet, "/contracts", "42")
+	if rec.Code != http.StatusOK || rec.Header().Get("X-RateLimit-Limit") != "5" {
+		t.Errorf("Запрос пользователя: статус %d, X-RateLimit-Limit=%q", rec.Code, rec.Header().Get("X-RateLimit-Limit"))
+	}
+	for i := 0; i < 2; i++ {
+		if rec := do(http.MethodPost, "/login", "42"); rec.Code != http.StatusOK {
+			t.Fatalf("Запрос %d к /login: статус %d", i+1, rec.Code)
+		}
+	}
+	if rec := do(http.MethodPost, "/login", "42"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Третий запрос к /login: статус %d, ожидался 429", rec.Code)
+	}
+}
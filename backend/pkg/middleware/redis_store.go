@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/ryantrue/EaistSync/pkg/config"
+)
+
+// gcraScript реализует GCRA атомарно на стороне Redis.
+// KEYS[1] – ключ лимита; ARGV[1] – интервал между запросами (мс); ARGV[2] – период (мс).
+// Возвращает {allowed, remaining, reset_after_ms, retry_after_ms}.
+var gcraScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local interval = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+
+local tat = tonumber(redis.call('GET', KEYS[1]))
+if not tat or tat < now then
+  tat = now
+end
+
+local new_tat = tat + interval
+local allow_at = new_tat - period
+if now < allow_at then
+  return {0, 0, tat - now, allow_at - now}
+end
+
+redis.call('SET', KEYS[1], new_tat, 'PX', new_tat - now)
+local remaining = math.floor((period - (new_tat - now)) / interval)
+return {1, remaining, new_tat - now, 0}
+`)
+
+// RedisStore – хранилище лимитов в Redis (или совместимом сервере), общее для всех реплик.
+type RedisStore struct {
+	client    redis.UniversalClient
+	keyPrefix string
+}
+
+// NewRedisStore создаёт хранилище лимитов поверх клиента Redis.
+func NewRedisStore(addr, password string, db int) *RedisStore {
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       db,
+	})
+	return &RedisStore{client: client, keyPrefix: "ratelimit:"}
+}
+
+// Allow реализует Store.
+func (s *RedisStore) Allow(ctx context.Context, key string, rule config.RateLimitRule) (Result, error) {
+	interval := rule.Period / time.Duration(rule.Requests)
+	vals, err := gcraScript.Run(ctx, s.client, []string{s.keyPrefix + key},
+		interval.Milliseconds(), rule.Period.Milliseconds()).Int64Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("redis rate limit: %w", err)
+	}
+	if len(vals) != 4 {
+		return Result{}, fmt.Errorf("redis rate limit: unexpected reply %v", vals)
+	}
+	return Result{
+		Allowed:    vals[0] == 1,
+		Limit:      rule.Requests,
+		Remaining:  int(vals[1]),
+		ResetAfter: time.Duration(vals[2]) * time.Millisecond,
+		RetryAfter: time.Duration(vals[3]) * time.Millisecond,
+	}, nil
+}
+
+// Close закрывает соединение с Redis.
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ryantrue/EaistSync/pkg/config"
+)
+
+// Result описывает решение лимитера для одного запроса.
+type Result struct {
+	Allowed    bool
+	Limit      int           // максимальное количество запросов за период
+	Remaining  int           // сколько запросов ещё можно выполнить без ожидания
+	ResetAfter time.Duration // через сколько лимит полностью восстановится
+	RetryAfter time.Duration // через сколько можно повторить отклонённый запрос
+}
+
+// Store хранит состояние лимитов. Реализация должна быть безопасной для конкурентного использования,
+// а для работы нескольких реплик – общей для них (например, Redis).
+type Store interface {
+	// Allow учитывает запрос по ключу key в соответствии с правилом rule.
+	Allow(ctx context.Context, key string, rule config.RateLimitRule) (Result, error)
+	// Close освобождает ресурсы хранилища.
+	Close() error
+}
+
+// gcra вычисляет решение по алгоритму GCRA (generic cell rate algorithm).
+// tat – теоретическое время прибытия следующего запроса, сохранённое для ключа.
+// Возвращает решение и новое значение tat, которое нужно сохранить при разрешении запроса.
+func gcra(now, tat time.Time, rule config.RateLimitRule) (Result, time.Time) {
+	interval := rule.Period / time.Duration(rule.Requests)
+	if tat.Before(now) {
+		tat = now
+	}
+	newTat := tat.Add(interval)
+	allowAt := newTat.Add(-rule.Period)
+
+	if now.Before(allowAt) {
+		return Result{
+			Allowed:    false,
+			Limit:      rule.Requests,
+			Remaining:  0,
+			ResetAfter: tat.Sub(now),
+			RetryAfter: allowAt.Sub(now),
+		}, tat
+	}
+
+	remaining := int(math.Floor(float64(rule.Period-newTat.Sub(now)) / float64(interval)))
+	return Result{
+		Allowed:    true,
+		Limit:      rule.Requests,
+		Remaining:  remaining,
+		ResetAfter: newTat.Sub(now),
+	}, newTat
+}
+
+// memoryEntry хранит состояние лимита для одного ключа.
+type memoryEntry struct {
+	tat      time.Time
+	lastSeen time.Time
+}
+
+// MemoryStore – хранилище лимитов в памяти процесса. Подходит для одной реплики и тестов.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	idleTTL time.Duration
+	now     func() time.Time
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// NewMemoryStore создаёт хранилище в памяти и запускает фоновую очистку записей,
+// не использовавшихся дольше idleTTL. Очистка останавливается вызовом Close.
+func NewMemoryStore(idleTTL time.Duration) *MemoryStore {
+	s := &MemoryStore{
+		entries: make(map[string]*memoryEntry),
+		idleTTL: idleTTL,
+		now:     time.Now,
+		stop:    make(chan struct{}),
+	}
+	go s.cleanupLoop()
+	return s
+}
+
+// Allow реализует Store.
+func (s *MemoryStore) Allow(_ context.Context, key string, rule config.RateLimitRule) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &memoryEntry{}
+		s.entries[key] = entry
+	}
+	res, tat := gcra(now, entry.tat, rule)
+	entry.tat = tat
+	entry.lastSeen = now
+	return res, nil
+}
+
+// cleanupLoop периодически удаляет неиспользуемые записи.
+func (s *MemoryStore) cleanupLoop() {
+	ticker := time.NewTicker(s.idleTTL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.cleanup()
+		}
+	}
+}
+
+// cleanup удаляет записи, не использовавшиеся дольше idleTTL.
+func (s *MemoryStore) cleanup() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for key, entry := range s.entries {
+		if now.Sub(entry.lastSeen) > s.idleTTL && !entry.tat.After(now) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// Close останавливает фоновую очистку.
+func (s *MemoryStore) Close() error {
+	s.once.Do(func() { close(s.stop) })
+	return nil
+}
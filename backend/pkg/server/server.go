@@ -1,6 +1,8 @@
 package server
 
 import (
+	"expvar"
+
 	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
@@ -9,21 +11,26 @@ import (
 	"github.com/ryantrue/EaistSync/pkg/config"
 	"github.com/ryantrue/EaistSync/pkg/handlers"
 	"github.com/ryantrue/EaistSync/pkg/middleware"
+	"github.com/ryantrue/EaistSync/pkg/storage"
+	"github.com/ryantrue/EaistSync/pkg/telegrambot"
+	"github.com/ryantrue/EaistSync/pkg/webhooks"
 )
 
-// Server хранит ссылки на базу данных, логгер и конфигурацию.
+// Server хранит ссылки на базу данных, логгер, конфигурацию и хранилище файлов.
 type Server struct {
 	DB     *sqlx.DB
 	Log    *zap.Logger
 	Config *config.Config
+	Files  storage.ObjectStore // nil, если хранилище файлов недоступно
 }
 
 // NewServer создаёт новый экземпляр Server.
-func NewServer(db *sqlx.DB, log *zap.Logger, cfg *config.Config) *Server {
+func NewServer(db *sqlx.DB, log *zap.Logger, cfg *config.Config, files storage.ObjectStore) *Server {
 	return &Server{
 		DB:     db,
 		Log:    log,
 		Config: cfg,
+		Files:  files,
 	}
 }
 
@@ -32,15 +39,23 @@ func (s *Server) Start(addr string) error {
 	e := echo.New()
 
 	// Применяем rate limiter ко всем маршрутам.
-	e.Use(middleware.RateLimiterMiddleware())
+	store := middleware.NewStore(s.Config.RateLimit)
+	defer store.Close()
+	limiter := middleware.NewRateLimiter(s.Config.RateLimit, store, rest.RateLimitPrincipal(s.Config, s.DB), s.Log)
+	e.Use(limiter.Middleware())
+
+	// Метрики процесса (в том числе счётчики клиента EAIST и командная строка) в формате expvar:
+	// только для администраторов.
+	e.GET("/debug/vars", echo.WrapHandler(expvar.Handler()), rest.AdminMiddleware(s.Config, s.DB, s.Log))
 
 	// Группа для API-эндпоинтов.
 	api := e.Group("/api")
 
 	// Существующие публичные маршруты.
-	api.GET("/contracts", handlers.HandleGetRecords(s.DB, s.Log, "SELECT * FROM contracts", "contracts"))
+	api.GET("/contracts", handlers.ContractsHandler(s.DB, s.Log))
 	api.GET("/states", handlers.HandleGetRecords(s.DB, s.Log, "SELECT * FROM states", "states"))
 	api.GET("/events", handlers.SSEHandler(s.Log))
+	api.GET("/schemas/:name", handlers.EventSchemaHandler())
 
 	// Маршруты для регистрации и авторизации.
 	api.POST("/register", rest.RegisterHandler(s.Config, s.DB, s.Log))
@@ -50,9 +65,41 @@ func (s *Server) Start(addr string) error {
 
 	// Защищённая группа маршрутов, требующая валидного JWT токена.
 	protected := api.Group("")
-	protected.Use(rest.JWTMiddleware(s.Config, s.Log))
+	protected.Use(rest.JWTMiddleware(s.Config, s.DB, s.Log))
 	// Пример защищённого маршрута, возвращающего профиль пользователя.
 	protected.GET("/profile", rest.ProfileHandler())
 
+	// Управление API-ключами для межсервисного доступа.
+	protected.GET("/profile/api-keys", rest.ListAPIKeysHandler(s.DB, s.Log))
+	protected.POST("/profile/api-keys", rest.CreateAPIKeyHandler(s.DB, s.Log))
+	protected.DELETE("/profile/api-keys/:id", rest.RevokeAPIKeyHandler(s.DB, s.Log))
+
+	// Привязка Telegram и подписки на уведомления в нём.
+	protected.GET("/profile/telegram", telegrambot.GetLinkHandler(s.DB, s.Log))
+	protected.DELETE("/profile/telegram", telegrambot.UnlinkHandler(s.DB, s.Log))
+	protected.POST("/profile/telegram/link", telegrambot.CreateLinkCodeHandler(s.DB, s.Log))
+	protected.GET("/profile/telegram/subscriptions", telegrambot.ListSubscriptionsHandler(s.DB, s.Log))
+	protected.POST("/profile/telegram/subscriptions", telegrambot.CreateSubscriptionHandler(s.DB, s.Log))
+	protected.DELETE("/profile/telegram/subscriptions/:id", telegrambot.DeleteSubscriptionHandler(s.DB, s.Log))
+
+	// Файлы документов контракта со ссылками на скачивание.
+	protected.GET("/contracts/:id/files", handlers.ContractFilesHandler(s.DB, s.Files, s.Log))
+
+	// Реестр эндпоинтов EAIST, с которыми работает синхронизация.
+	protected.GET("/eaist/endpoints", handlers.EAISTEndpointsHandler(s.Config))
+
+	// Подписки на события о контрактах (webhook) и журнал их доставок: только для администраторов
+	// и API-ключей с областью "webhooks".
+	hooks := api.Group("/webhooks", rest.AdminOrScopeMiddleware(s.Config, s.DB, s.Log, rest.ScopeWebhooks))
+	allowPrivate := s.Config.WebhookAllowPrivateNetworks
+	hooks.GET("", webhooks.ListSubscriptionsHandler(s.DB, s.Log))
+	hooks.POST("", webhooks.CreateSubscriptionHandler(s.DB, s.Log, allowPrivate))
+	hooks.GET("/:id", webhooks.GetSubscriptionHandler(s.DB, s.Log))
+	hooks.PUT("/:id", webhooks.UpdateSubscriptionHandler(s.DB, s.Log, allowPrivate))
+	hooks.DELETE("/:id", webhooks.DeleteSubscriptionHandler(s.DB, s.Log))
+	hooks.GET("/:id/deliveries", webhooks.ListDeliveriesHandler(s.DB, s.Log))
+	hooks.GET("/:id/deliveries/:delivery", webhooks.GetDeliveryHandler(s.DB, s.Log))
+	hooks.POST("/:id/deliveries/:delivery/redeliver", webhooks.RedeliverHandler(s.DB, s.Log))
+
 	return e.Start(addr)
 }
@@ -0,0 +1,115 @@
+// Package storage работает с объектным хранилищем MinIO (S3): файлы документов контрактов и архив ответов EAIST.
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/ryantrue/EaistSync/pkg/config"
+)
+
+// presignRegion задаётся явно, чтобы подпись ссылок не требовала запроса региона бакета.
+const presignRegion = "us-east-1"
+
+// ObjectStore – хранилище объектов, в которое сохраняются файлы документов.
+type ObjectStore interface {
+	// Put сохраняет объект с ключом key.
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// PresignedURL возвращает временную ссылку на скачивание объекта под именем fileName.
+	PresignedURL(ctx context.Context, key, fileName string) (string, error)
+}
+
+// MinioStore реализует ObjectStore поверх MinIO.
+type MinioStore struct {
+	client    *minio.Client
+	presigner *minio.Client // клиент с публичным адресом для подписи ссылок
+	bucket    string
+	expiry    time.Duration
+}
+
+// NewMinioStore подключается к MinIO и создаёт бакет bucket, если его ещё нет.
+func NewMinioStore(ctx context.Context, cfg *config.Config, bucket string) (*MinioStore, error) {
+	creds := credentials.NewStaticV4(cfg.MinioAccessKey, cfg.MinioSecretKey, "")
+	client, err := minio.New(cfg.MinioEndpoint, &minio.Options{Creds: creds, Secure: cfg.MinioUseSSL, Region: presignRegion})
+	if err != nil {
+		return nil, fmt.Errorf("создание клиента MinIO: %w", err)
+	}
+
+	presigner := client
+	if cfg.MinioPublicEndpoint != "" {
+		endpoint, secure, err := parsePublicEndpoint(cfg.MinioPublicEndpoint, cfg.MinioUseSSL)
+		if err != nil {
+			return nil, err
+		}
+		presigner, err = minio.New(endpoint, &minio.Options{Creds: creds, Secure: secure, Region: presignRegion})
+		if err != nil {
+			return nil, fmt.Errorf("создание клиента MinIO для ссылок: %w", err)
+		}
+	}
+
+	exists, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("проверка бакета %s: %w", bucket, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{Region: presignRegion}); err != nil {
+			return nil, fmt.Errorf("создание бакета %s: %w", bucket, err)
+		}
+	}
+
+	return &MinioStore{client: client, presigner: presigner, bucket: bucket, expiry: cfg.MinioPresignExpiry}, nil
+}
+
+// parsePublicEndpoint разбирает публичный адрес MinIO вида "host:port" или "https://host".
+func parsePublicEndpoint(value string, defaultSecure bool) (string, bool, error) {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		// Адрес без схемы.
+		return value, defaultSecure, nil
+	}
+	return u.Host, u.Scheme == "https", nil
+}
+
+// Put сохраняет объект в бакет.
+func (s *MinioStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return fmt.Errorf("сохранение объекта %s: %w", key, err)
+	}
+	return nil
+}
+
+// Get читает объект из бакета.
+func (s *MinioStore) Get(ctx context.Context, key string) ([]byte, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("чтение объекта %s: %w", key, err)
+	}
+	defer obj.Close()
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		return nil, fmt.Errorf("чтение объекта %s: %w", key, err)
+	}
+	return data, nil
+}
+
+// PresignedURL возвращает ссылку на скачивание объекта; браузер сохранит файл под именем fileName.
+func (s *MinioStore) PresignedURL(ctx context.Context, key, fileName string) (string, error) {
+	params := url.Values{}
+	if fileName != "" {
+		params.Set("response-content-disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", url.PathEscape(fileName)))
+	}
+	u, err := s.presigner.PresignedGetObject(ctx, s.bucket, key, s.expiry, params)
+	if err != nil {
+		return "", fmt.Errorf("подпись ссылки на %s: %w", key, err)
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,577 @@
+package telegrambot
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+
+	"github.com/ryantrue/EaistSync/pkg/db"
+)
+
+// RoleAdmin – роль пользователя, которому доступен запуск синхронизации.
+const RoleAdmin = "admin"
+
+const (
+	// pageSize – число контрактов на странице результатов.
+	pageSize = 10
+	// maxCallbackData – ограничение Telegram на данные inline-кнопки в байтах.
+	maxCallbackData = 64
+	// maxSearchText – наибольшая длина поискового запроса в байтах: запрос передаётся
+	// в данных кнопок листания вместе с префиксом и смещением.
+	maxSearchText = maxCallbackData - len("search:99999:")
+)
+
+// Префиксы данных inline-кнопок.
+const (
+	callbackSearch      = "search"
+	callbackExpiring    = "expiring"
+	callbackUnsubscribe = "unsub"
+)
+
+// ErrSyncRunning возвращается SyncTrigger, если синхронизация уже выполняется.
+var ErrSyncRunning = errors.New("синхронизация уже выполняется")
+
+// SyncTrigger запускает синхронизацию в фоне.
+type SyncTrigger func(ctx context.Context) error
+
+const helpText = `Команды EaistSync:
+/status – последний запуск синхронизации
+/sync – запустить синхронизацию (администраторы)
+/contract <id или номер> – сведения о контракте
+/search <текст> – поиск контрактов
+/expiring <дней> – контракты, заканчивающиеся в ближайшие дни
+/subscribe <вид> [параметр] – подписаться на уведомления
+/unsubscribe [id] – отписаться от уведомлений`
+
+const subscribeUsage = `Использование:
+/subscribe new_contracts – новые контракты
+/subscribe state_changes <id контракта> – смена состояния контракта
+/subscribe expiring <дней> – контракты, заканчивающиеся в ближайшие дни
+/subscribe sync_failures – ошибки синхронизации`
+
+// Commands обрабатывает команды бота. Все команды, кроме /help, принимаются только в личном чате
+// с ботом: в группе роль привязанного пользователя получили бы все её участники. Команды, кроме
+// /start, доступны только в чатах, привязанных к пользователю EaistSync, и выполняются с его ролью.
+type Commands struct {
+	bot  *TelegramBot
+	db   *sqlx.DB
+	log  *zap.Logger
+	sync SyncTrigger
+}
+
+// NewCommands создаёт обработчик команд; sync вызывается командой /sync.
+func NewCommands(bot *TelegramBot, db *sqlx.DB, log *zap.Logger, sync SyncTrigger) *Commands {
+	return &Commands{bot: bot, db: db, log: log, sync: sync}
+}
+
+// chatUser – пользователь, привязанный к чату.
+type chatUser struct {
+	ID   int64  `db:"id"`
+	Role string `db:"role"`
+}
+
+// contractRow – строка списка контрактов.
+type contractRow struct {
+	ID             int64        `db:"id"`
+	ContractNumber string       `db:"contract_number"`
+	Name           string       `db:"name"`
+	EndDate        sql.NullTime `db:"end_date"`
+}
+
+// HandleCommand обрабатывает команду из сообщения; предназначен для StartCommandListener.
+func (c *Commands) HandleCommand(ctx context.Context, command, args string, message tgbotapi.Message) {
+	chatID := message.Chat.ID
+	args = strings.TrimSpace(args)
+	if command == "help" {
+		c.reply(ctx, chatID, helpText)
+		return
+	}
+	if !privateChat(message.Chat, message.From) {
+		c.reply(ctx, chatID, "Команды EaistSync доступны только в личном чате с ботом.")
+		return
+	}
+	if command == "start" {
+		c.handleStart(ctx, args, chatID)
+		return
+	}
+
+	user := c.authorize(ctx, chatID)
+	if user == nil {
+		return
+	}
+	switch command {
+	case "status":
+		c.status(ctx, chatID)
+	case "sync":
+		c.startSync(ctx, chatID, user)
+	case "contract":
+		c.contract(ctx, chatID, args)
+	case "search":
+		c.search(ctx, chatID, 0, args, 0)
+	case "expiring":
+		c.expiring(ctx, chatID, 0, args, 0)
+	case "subscribe":
+		c.subscribe(ctx, chatID, user, args)
+	case "unsubscribe":
+		c.unsubscribe(ctx, chatID, 0, user, args)
+	default:
+		c.reply(ctx, chatID, "Неизвестная команда. Список команд: /help")
+	}
+}
+
+// HandleCallback обрабатывает нажатие inline-кнопки: листание результатов и отписку.
+func (c *Commands) HandleCallback(ctx context.Context, query tgbotapi.CallbackQuery) {
+	answer := ""
+	defer func() {
+		if err := c.bot.sender.AnswerCallback(ctx, query.ID, answer); err != nil {
+			c.log.Warn("Ошибка ответа на нажатие кнопки Telegram", zap.Error(err))
+		}
+	}()
+	if query.Message == nil {
+		return
+	}
+	chatID, messageID := query.Message.Chat.ID, query.Message.MessageID
+	if !privateChat(query.Message.Chat, query.From) {
+		answer = "Кнопки EaistSync работают только в личном чате с ботом"
+		return
+	}
+	user, err := c.userForChat(ctx, chatID)
+	if err != nil || user == nil {
+		answer = "Чат не привязан к пользователю EaistSync"
+		return
+	}
+
+	kind, rest, _ := strings.Cut(query.Data, ":")
+	switch kind {
+	case callbackSearch:
+		offset, text, _ := strings.Cut(rest, ":")
+		c.search(ctx, chatID, messageID, text, atoi(offset))
+	case callbackExpiring:
+		days, offset, _ := strings.Cut(rest, ":")
+		c.expiring(ctx, chatID, messageID, days, atoi(offset))
+	case callbackUnsubscribe:
+		c.unsubscribe(ctx, chatID, messageID, user, rest)
+		answer = "Подписка удалена"
+	default:
+		answer = "Кнопка устарела"
+	}
+}
+
+// privateChat сообщает, что чат – личный чат с отправителем from: только тогда роль пользователя,
+// привязанного к чату, принадлежит тому, кто отправил команду.
+func privateChat(chat *tgbotapi.Chat, from *tgbotapi.User) bool {
+	return chat != nil && chat.IsPrivate() && from != nil && from.ID == chat.ID
+}
+
+// handleStart привязывает чат к пользователю по коду из профиля.
+func (c *Commands) handleStart(ctx context.Context, code string, chatID int64) {
+	if code == "" {
+		c.reply(ctx, chatID, "Чтобы получать уведомления EaistSync, получите код привязки в профиле и отправьте /start <код>.")
+		return
+	}
+	userID, err := LinkChat(ctx, c.db, code, chatID)
+	if errors.Is(err, ErrLinkCodeInvalid) {
+		c.reply(ctx, chatID, "Код привязки не найден или истёк. Получите новый код в профиле EaistSync.")
+		return
+	}
+	if err != nil {
+		c.log.Error("Ошибка привязки Telegram-чата", zap.Int64("chatId", chatID), zap.Error(err))
+		c.reply(ctx, chatID, "Не удалось привязать аккаунт, попробуйте позже.")
+		return
+	}
+	c.log.Info("Telegram-чат привязан к пользователю", zap.Int64("userId", userID), zap.Int64("chatId", chatID))
+	c.reply(ctx, chatID, "Аккаунт EaistSync привязан. Подпишитесь на уведомления командой /subscribe.\n\n"+helpText)
+}
+
+// authorize возвращает пользователя чата или сообщает, что чат не привязан.
+func (c *Commands) authorize(ctx context.Context, chatID int64) *chatUser {
+	user, err := c.userForChat(ctx, chatID)
+	if err != nil {
+		c.log.Error("Ошибка получения пользователя Telegram-чата", zap.Int64("chatId", chatID), zap.Error(err))
+		c.reply(ctx, chatID, "Ошибка БД, попробуйте позже.")
+		return nil
+	}
+	if user == nil {
+		c.reply(ctx, chatID, "Чат не привязан к пользователю EaistSync. Получите код привязки в профиле и отправьте /start <код>.")
+	}
+	return user
+}
+
+// userForChat возвращает пользователя, привязанного к чату, или nil.
+func (c *Commands) userForChat(ctx context.Context, chatID int64) (*chatUser, error) {
+	var user chatUser
+	err := c.db.GetContext(ctx, &user, `
+		SELECT u.id, COALESCE(u.role, 'user') AS role
+		FROM telegram_links l JOIN users u ON u.id = l.user_id
+		WHERE l.chat_id = $1`, chatID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// status сообщает о последнем запуске синхронизации.
+func (c *Commands) status(ctx context.Context, chatID int64) {
+	run, err := db.LastSyncRun(ctx, c.db)
+	if err != nil {
+		c.fail(ctx, chatID, "Ошибка получения журнала синхронизации", err)
+		return
+	}
+	if run == nil {
+		c.reply(ctx, chatID, "Синхронизация ещё не запускалась.")
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Последняя синхронизация #%d (%s)\n", run.ID, run.Trigger)
+	fmt.Fprintf(&b, "Начата: %s\n", run.StartedAt.Local().Format("02.01.2006 15:04:05"))
+	switch run.Status {
+	case db.SyncRunning:
+		fmt.Fprintf(&b, "Выполняется %s", time.Since(run.StartedAt).Round(time.Second))
+	case db.SyncFailed:
+		fmt.Fprintf(&b, "Завершилась с ошибкой за %s", run.FinishedAt.Sub(run.StartedAt).Round(time.Second))
+		if run.Error != nil {
+			fmt.Fprintf(&b, ": %s", *run.Error)
+		}
+	default:
+		fmt.Fprintf(&b, "Успешно за %s\nКонтрактов: %d, новых: %d, удалено: %d, не сохранено: %d",
+			run.FinishedAt.Sub(run.StartedAt).Round(time.Second), run.Contracts, run.NewContracts, run.Removed, run.Rejected)
+	}
+	c.reply(ctx, chatID, b.String())
+}
+
+// startSync запускает синхронизацию по команде администратора.
+func (c *Commands) startSync(ctx context.Context, chatID int64, user *chatUser) {
+	if user.Role != RoleAdmin {
+		c.reply(ctx, chatID, "Команда доступна только администраторам.")
+		return
+	}
+	err := c.sync(ctx)
+	if errors.Is(err, ErrSyncRunning) {
+		c.reply(ctx, chatID, "Синхронизация уже выполняется. Состояние: /status")
+		return
+	}
+	if err != nil {
+		c.fail(ctx, chatID, "Не удалось запустить синхронизацию", err)
+		return
+	}
+	c.log.Info("Синхронизация запущена из Telegram", zap.Int64("userId", user.ID))
+	c.reply(ctx, chatID, "Синхронизация запущена. Состояние: /status")
+}
+
+// contract отправляет сводку по контракту, найденному по ID, номеру контракта или реестровому номеру.
+func (c *Commands) contract(ctx context.Context, chatID int64, args string) {
+	if args == "" {
+		c.reply(ctx, chatID, "Использование: /contract <id или номер контракта>")
+		return
+	}
+	id, _ := strconv.ParseInt(args, 10, 64)
+	var row struct {
+		ID           int64          `db:"id"`
+		Data         []byte         `db:"data"`
+		MissingSince sql.NullTime   `db:"missing_since"`
+		StateName    sql.NullString `db:"state_name"`
+	}
+	err := c.db.GetContext(ctx, &row, `
+		SELECT c.id, c.data, c.missing_since, st.data->>'name' AS state_name
+		FROM contracts c
+		LEFT JOIN states st ON st.id::text = c.data->>'stateId'
+		WHERE c.id = $1 OR c.data->>'contractNumber' = $2 OR c.data->>'registryNumber' = $2
+		ORDER BY (c.id = $1) DESC, c.id DESC
+		LIMIT 1`, id, args)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.reply(ctx, chatID, fmt.Sprintf("Контракт %s не найден.", args))
+		return
+	}
+	if err != nil {
+		c.fail(ctx, chatID, "Ошибка получения контракта", err)
+		return
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(row.Data, &data); err != nil {
+		c.fail(ctx, chatID, "Ошибка разбора контракта", err)
+		return
+	}
+	c.reply(ctx, chatID, contractSummary(row.ID, data, row.StateName.String, row.MissingSince))
+}
+
+// contractSummary форматирует сводку по контракту.
+func contractSummary(id int64, data map[string]interface{}, stateName string, missingSince sql.NullTime) string {
+	field := func(key string) string {
+		switch v := data[key].(type) {
+		case nil:
+			return ""
+		case string:
+			return v
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return fmt.Sprint(v)
+		}
+	}
+	var b strings.Builder
+	b.WriteString(contractLabel(id, field("contractNumber"), field("name")))
+	lines := []struct{ label, value string }{
+		{"Реестровый номер", field("registryNumber")},
+		{"Заказчик", field("customerName")},
+		{"Поставщик", strings.TrimSpace(field("supplierName") + " " + innSuffix(field("supplierInn")))},
+		{"Состояние", firstNonEmpty(stateName, field("stateId"))},
+		{"Цена", field("price")},
+		{"Дата заключения", formatDate(field("signDate"))},
+		{"Дата окончания", formatDate(field("endDate"))},
+	}
+	for _, l := range lines {
+		if l.value != "" {
+			fmt.Fprintf(&b, "\n%s: %s", l.label, l.value)
+		}
+	}
+	if missingSince.Valid {
+		fmt.Fprintf(&b, "\nНе возвращается EAIST с %s", missingSince.Time.Local().Format("02.01.2006"))
+	}
+	return b.String()
+}
+
+// search отправляет страницу контрактов, найденных по тексту в номере, наименовании, заказчике или поставщике.
+func (c *Commands) search(ctx context.Context, chatID int64, messageID int, text string, offset int) {
+	if text == "" {
+		c.reply(ctx, chatID, "Использование: /search <текст>")
+		return
+	}
+	if len(text) > maxSearchText {
+		c.reply(ctx, chatID, fmt.Sprintf("Слишком длинный запрос: до %d символов латиницей или %d кириллицей.", maxSearchText, maxSearchText/2))
+		return
+	}
+	var rows []contractRow
+	err := c.db.SelectContext(ctx, &rows, `
+		SELECT id, COALESCE(data->>'contractNumber', '') AS contract_number, COALESCE(data->>'name', '') AS name,
+		       NULL::date AS end_date
+		FROM contracts
+		WHERE missing_since IS NULL AND (
+		      data->>'contractNumber' ILIKE $1 OR data->>'registryNumber' ILIKE $1 OR data->>'name' ILIKE $1
+		   OR data->>'customerName' ILIKE $1 OR data->>'supplierName' ILIKE $1 OR data->>'supplierInn' ILIKE $1)
+		ORDER BY id DESC
+		LIMIT $2 OFFSET $3`, "%"+escapeLike(text)+"%", pageSize+1, offset)
+	if err != nil {
+		c.fail(ctx, chatID, "Ошибка поиска контрактов", err)
+		return
+	}
+	c.sendPage(ctx, chatID, messageID, fmt.Sprintf("Поиск «%s»", text), rows, offset, func(offset int) string {
+		return fmt.Sprintf("%s:%d:%s", callbackSearch, offset, text)
+	})
+}
+
+// expiring отправляет страницу контрактов, заканчивающихся в ближайшие days дней.
+func (c *Commands) expiring(ctx context.Context, chatID int64, messageID int, args string, offset int) {
+	days, err := strconv.Atoi(args)
+	if err != nil || days <= 0 || days > maxExpiringDays {
+		c.reply(ctx, chatID, fmt.Sprintf("Использование: /expiring <дней от 1 до %d>", maxExpiringDays))
+		return
+	}
+	var rows []contractRow
+	err = c.db.SelectContext(ctx, &rows, `
+		SELECT id, COALESCE(data->>'contractNumber', '') AS contract_number, COALESCE(data->>'name', '') AS name, end_date
+		FROM (`+activeContractsEndDate+`) c
+		WHERE end_date BETWEEN CURRENT_DATE AND CURRENT_DATE + $1::int
+		ORDER BY end_date, id
+		LIMIT $2 OFFSET $3`, days, pageSize+1, offset)
+	if err != nil {
+		c.fail(ctx, chatID, "Ошибка получения контрактов", err)
+		return
+	}
+	c.sendPage(ctx, chatID, messageID, fmt.Sprintf("Заканчиваются в ближайшие %d дн.", days), rows, offset, func(offset int) string {
+		return fmt.Sprintf("%s:%d:%d", callbackExpiring, days, offset)
+	})
+}
+
+// sendPage отправляет или обновляет страницу списка контрактов с кнопками листания. Строк передаётся
+// на одну больше размера страницы, чтобы определить, есть ли следующая.
+func (c *Commands) sendPage(ctx context.Context, chatID int64, messageID int, title string, rows []contractRow, offset int, callback func(offset int) string) {
+	hasNext := len(rows) > pageSize
+	if hasNext {
+		rows = rows[:pageSize]
+	}
+	var b strings.Builder
+	b.WriteString(title)
+	if len(rows) == 0 {
+		b.WriteString("\nНичего не найдено.")
+	}
+	for i, r := range rows {
+		fmt.Fprintf(&b, "\n%d. %s", offset+i+1, contractLabel(r.ID, r.ContractNumber, r.Name))
+		if r.EndDate.Valid {
+			fmt.Fprintf(&b, " – до %s", r.EndDate.Time.Format("02.01.2006"))
+		}
+	}
+
+	var row []tgbotapi.InlineKeyboardButton
+	if offset > 0 {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("« Назад", callback(max(offset-pageSize, 0))))
+	}
+	if hasNext {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("Далее »", callback(offset+pageSize)))
+	}
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	if len(row) > 0 {
+		keyboard = append(keyboard, row)
+	}
+	if err := c.bot.sender.SendPage(ctx, chatID, messageID, b.String(), keyboard); err != nil {
+		c.log.Error("Ошибка отправки страницы в Telegram", zap.Int64("chatId", chatID), zap.Error(err))
+	}
+}
+
+// subscribe создаёт подписку: /subscribe <вид> [contract_id | days].
+func (c *Commands) subscribe(ctx context.Context, chatID int64, user *chatUser, args string) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		c.reply(ctx, chatID, subscribeUsage)
+		return
+	}
+	sub := Subscription{UserID: user.ID, Kind: fields[0]}
+	if len(fields) > 1 {
+		switch sub.Kind {
+		case KindStateChanges:
+			if id, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+				sub.ContractID = &id
+			}
+		case KindExpiring:
+			if days, err := strconv.Atoi(fields[1]); err == nil {
+				sub.Days = &days
+			}
+		}
+	}
+	if err := sub.Validate(); err != nil {
+		c.reply(ctx, chatID, err.Error()+"\n\n"+subscribeUsage)
+		return
+	}
+	sub, created, err := Subscribe(ctx, c.db, sub)
+	if err != nil {
+		c.fail(ctx, chatID, "Ошибка сохранения подписки", err)
+		return
+	}
+	if !created {
+		c.reply(ctx, chatID, fmt.Sprintf("Подписка #%d уже есть: %s", sub.ID, describeSubscription(sub)))
+		return
+	}
+	c.reply(ctx, chatID, fmt.Sprintf("Подписка #%d создана: %s", sub.ID, describeSubscription(sub)))
+}
+
+// unsubscribe удаляет подписку по ID; без аргумента показывает подписки с кнопками отписки.
+func (c *Commands) unsubscribe(ctx context.Context, chatID int64, messageID int, user *chatUser, args string) {
+	if args != "" {
+		id, err := strconv.ParseInt(args, 10, 64)
+		if err != nil {
+			c.reply(ctx, chatID, "Использование: /unsubscribe [id подписки]")
+			return
+		}
+		removed, err := Unsubscribe(ctx, c.db, user.ID, id)
+		if err != nil {
+			c.fail(ctx, chatID, "Ошибка удаления подписки", err)
+			return
+		}
+		if !removed {
+			c.reply(ctx, chatID, fmt.Sprintf("Подписка #%d не найдена.", id))
+			return
+		}
+		if messageID == 0 {
+			c.reply(ctx, chatID, fmt.Sprintf("Подписка #%d удалена.", id))
+			return
+		}
+	}
+
+	subs, err := ListSubscriptions(ctx, c.db, user.ID)
+	if err != nil {
+		c.fail(ctx, chatID, "Ошибка получения подписок", err)
+		return
+	}
+	text := "Подписок нет. Подписаться: /subscribe"
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	if len(subs) > 0 {
+		text = "Ваши подписки. Нажмите, чтобы отписаться:"
+		for _, s := range subs {
+			keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+				fmt.Sprintf("✕ #%d %s", s.ID, describeSubscription(s)),
+				fmt.Sprintf("%s:%d", callbackUnsubscribe, s.ID))))
+		}
+	}
+	if err := c.bot.sender.SendPage(ctx, chatID, messageID, text, keyboard); err != nil {
+		c.log.Error("Ошибка отправки подписок в Telegram", zap.Int64("chatId", chatID), zap.Error(err))
+	}
+}
+
+// describeSubscription возвращает описание подписки для пользователя.
+func describeSubscription(s Subscription) string {
+	switch s.Kind {
+	case KindNewContracts:
+		return "новые контракты"
+	case KindStateChanges:
+		if s.ContractID != nil {
+			return fmt.Sprintf("смена состояния контракта %d", *s.ContractID)
+		}
+	case KindExpiring:
+		if s.Days != nil {
+			return fmt.Sprintf("окончание контрактов за %d дн.", *s.Days)
+		}
+	case KindSyncFailures:
+		return "ошибки синхронизации"
+	}
+	return s.Kind
+}
+
+func (c *Commands) reply(ctx context.Context, chatID int64, text string) {
+	if err := c.bot.SendTo(ctx, chatID, text); err != nil {
+		c.log.Error("Ошибка отправки ответа в Telegram", zap.Int64("chatId", chatID), zap.Error(err))
+	}
+}
+
+// fail записывает ошибку в журнал и сообщает о ней пользователю без подробностей.
+func (c *Commands) fail(ctx context.Context, chatID int64, message string, err error) {
+	c.log.Error(message, zap.Int64("chatId", chatID), zap.Error(err))
+	c.reply(ctx, chatID, message+", попробуйте позже.")
+}
+
+// escapeLike экранирует спецсимволы шаблона LIKE.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// formatDate переводит дату EAIST вида 2024-12-31T00:00:00 в 31.12.2024.
+func formatDate(s string) string {
+	if len(s) < 10 {
+		return s
+	}
+	if t, err := time.Parse("2006-01-02", s[:10]); err == nil {
+		return t.Format("02.01.2006")
+	}
+	return s
+}
+
+func innSuffix(inn string) string {
+	if inn == "" {
+		return ""
+	}
+	return "(ИНН " + inn + ")"
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return max(n, 0)
+}
@@ -0,0 +1,145 @@
+package telegrambot
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+func newTestCommands(t *testing.T, sync SyncTrigger) (*Commands, *fakeSender, sqlmock.Sqlmock) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	sender := &fakeSender{chatID: 100}
+	return NewCommands(newTestBot(t, sender), sqlx.NewDb(sqlDB, "sqlmock"), zap.NewNop(), sync), sender, mock
+}
+
+func expectChatUser(mock sqlmock.Sqlmock, chatID int64, role string) {
+	mock.ExpectQuery("FROM telegram_links l JOIN users u").WithArgs(chatID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "role"}).AddRow(3, role))
+}
+
+// message возвращает сообщение пользователя chatID в личном чате с ботом.
+func message(chatID int64) tgbotapi.Message {
+	return tgbotapi.Message{Chat: &tgbotapi.Chat{ID: chatID, Type: "private"}, From: &tgbotapi.User{ID: chatID}}
+}
+
+func TestSyncRequiresAdmin(t *testing.T) {
+	started := 0
+	cmds, sender, mock := newTestCommands(t, func(context.Context) error { started++; return nil })
+
+	expectChatUser(mock, 5, "user")
+	cmds.HandleCommand(context.Background(), "sync", "", message(5))
+	if started != 0 || !strings.Contains(sender.messages[5][0], "только администраторам") {
+		t.Fatalf("started = %d, ответ %q", started, sender.messages[5])
+	}
+
+	expectChatUser(mock, 5, RoleAdmin)
+	cmds.HandleCommand(context.Background(), "sync", "", message(5))
+	if started != 1 {
+		t.Fatalf("started = %d", started)
+	}
+
+	cmds.sync = func(context.Context) error { return ErrSyncRunning }
+	expectChatUser(mock, 5, RoleAdmin)
+	cmds.HandleCommand(context.Background(), "sync", "", message(5))
+	if last := sender.messages[5][len(sender.messages[5])-1]; !strings.Contains(last, "уже выполняется") {
+		t.Fatalf("ответ %q", last)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommandsRequireLink(t *testing.T) {
+	cmds, sender, mock := newTestCommands(t, nil)
+	mock.ExpectQuery("FROM telegram_links l JOIN users u").WithArgs(int64(9)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "role"}))
+
+	cmds.HandleCommand(context.Background(), "search", "бумага", message(9))
+	if len(sender.messages[9]) != 1 || !strings.Contains(sender.messages[9][0], "/start") {
+		t.Fatalf("ответ %q", sender.messages[9])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommandsRequirePrivateChat(t *testing.T) {
+	started := 0
+	cmds, sender, mock := newTestCommands(t, func(context.Context) error { started++; return nil })
+
+	// Участник группы, привязанной к администратору, не получает его прав и не может привязать группу.
+	group := tgbotapi.Message{Chat: &tgbotapi.Chat{ID: -500, Type: "group"}, From: &tgbotapi.User{ID: 8}}
+	cmds.HandleCommand(context.Background(), "sync", "", group)
+	cmds.HandleCommand(context.Background(), "start", "code", group)
+	if started != 0 || len(sender.messages[-500]) != 2 || !strings.Contains(sender.messages[-500][0], "личном чате") {
+		t.Fatalf("started = %d, ответы %q", started, sender.messages[-500])
+	}
+	cmds.HandleCallback(context.Background(), tgbotapi.CallbackQuery{
+		ID:      "cb",
+		Data:    "unsub:1",
+		From:    &tgbotapi.User{ID: 8},
+		Message: &tgbotapi.Message{MessageID: 1, Chat: &tgbotapi.Chat{ID: -500, Type: "group"}},
+	})
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSearchPaging(t *testing.T) {
+	cmds, sender, mock := newTestCommands(t, nil)
+	rows := sqlmock.NewRows([]string{"id", "contract_number", "name", "end_date"})
+	for i := 0; i <= pageSize; i++ {
+		rows.AddRow(100-i, "", "Поставка", nil)
+	}
+	expectChatUser(mock, 5, "user")
+	mock.ExpectQuery("FROM contracts").WithArgs(`%50\%%`, pageSize+1, pageSize).WillReturnRows(rows)
+
+	cmds.HandleCallback(context.Background(), tgbotapi.CallbackQuery{
+		ID:      "q",
+		Data:    "search:10:50%",
+		From:    &tgbotapi.User{ID: 5},
+		Message: &tgbotapi.Message{MessageID: 77, Chat: &tgbotapi.Chat{ID: 5, Type: "private"}},
+	})
+
+	if len(sender.pages) != 1 {
+		t.Fatalf("pages = %d", len(sender.pages))
+	}
+	page := sender.pages[0]
+	if page.messageID != 77 || !strings.Contains(page.text, "11. 100: Поставка") || strings.Contains(page.text, "21.") {
+		t.Fatalf("page = %+v", page)
+	}
+	if len(page.keyboard) != 1 || len(page.keyboard[0]) != 2 ||
+		*page.keyboard[0][0].CallbackData != "search:0:50%" || *page.keyboard[0][1].CallbackData != "search:20:50%" {
+		t.Fatalf("keyboard = %+v", page.keyboard)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubscribeCommand(t *testing.T) {
+	cmds, sender, mock := newTestCommands(t, nil)
+	expectChatUser(mock, 5, "user")
+	mock.ExpectQuery("INSERT INTO telegram_subscriptions").WithArgs(int64(3), KindExpiring, nil, 30).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "kind", "contract_id", "days", "created_at"}).
+			AddRow(4, 3, KindExpiring, nil, 30, time.Now()))
+
+	cmds.HandleCommand(context.Background(), "subscribe", "expiring 30", message(5))
+	if len(sender.messages[5]) != 1 || !strings.Contains(sender.messages[5][0], "#4 создана: окончание контрактов за 30 дн.") {
+		t.Fatalf("ответ %q", sender.messages[5])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
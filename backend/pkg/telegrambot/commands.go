@@ -8,17 +8,26 @@ import (
 )
 
 // StartCommandListener запускает слушатель входящих обновлений и обрабатывает команды,
-// вызывая callback-функцию для каждого сообщения с командой.
-func (tb *TelegramBot) StartCommandListener(ctx context.Context, handler func(ctx context.Context, command string, args string, message tgbotapi.Message)) {
+// вызывая callback-функцию для каждого сообщения с командой. Нажатия inline-кнопок передаются
+// в callbacks, если он задан.
+func (tb *TelegramBot) StartCommandListener(ctx context.Context, handler func(ctx context.Context, command string, args string, message tgbotapi.Message), callbacks func(ctx context.Context, query tgbotapi.CallbackQuery)) {
 	updateConfig := tgbotapi.NewUpdate(0)
 	updateConfig.Timeout = 60
 	updates := tb.botAPI.GetUpdatesChan(updateConfig)
 	go func() {
+		defer tb.botAPI.StopReceivingUpdates()
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case update := <-updates:
+			case update, ok := <-updates:
+				if !ok {
+					return
+				}
+				if update.CallbackQuery != nil && callbacks != nil {
+					callbacks(ctx, *update.CallbackQuery)
+					continue
+				}
 				if update.Message == nil {
 					continue
 				}
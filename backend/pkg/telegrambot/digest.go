@@ -0,0 +1,188 @@
+package telegrambot
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Форматы вложения дайджеста.
+const (
+	DigestFormatCSV  = "csv"
+	DigestFormatXLSX = "xlsx"
+)
+
+// digestHeader – заголовки столбцов таблицы дайджеста.
+var digestHeader = []string{
+	"Событие", "ID", "Номер", "Реестровый номер", "Наименование", "Заказчик",
+	"Поставщик", "ИНН поставщика", "Цена", "Дата окончания", "Изменённые поля",
+}
+
+// digestRows формирует строки таблицы дайджеста: сначала новые контракты, затем изменённые.
+// Значения – string или float64 для чисел.
+func digestRows(created []map[string]interface{}, updated []ContractMessage) [][]interface{} {
+	rows := make([][]interface{}, 0, len(created)+len(updated))
+	for _, c := range created {
+		rows = append(rows, digestRow("Новый", c, nil))
+	}
+	for _, u := range updated {
+		contract := u.Contract
+		if contract == nil {
+			contract = map[string]interface{}{"id": float64(u.ID)}
+		}
+		fields := make([]string, 0, len(u.Changes))
+		for field := range u.Changes {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		rows = append(rows, digestRow("Изменён", contract, fields))
+	}
+	return rows
+}
+
+func digestRow(event string, c map[string]interface{}, changed []string) []interface{} {
+	str := func(key string) interface{} {
+		switch v := c[key].(type) {
+		case nil:
+			return ""
+		case float64:
+			return v
+		case string:
+			return v
+		default:
+			return formatValue(v)
+		}
+	}
+	endDate := ""
+	if s, ok := c["endDate"].(string); ok && s != "" {
+		endDate = formatDate(s)
+	}
+	return []interface{}{
+		event, str("id"), str("contractNumber"), str("registryNumber"), str("name"), str("customerName"),
+		str("supplierName"), str("supplierInn"), str("price"), endDate, strings.Join(changed, ", "),
+	}
+}
+
+// digestFile формирует вложение дайджеста в формате format и возвращает его содержимое.
+func digestFile(format string, rows [][]interface{}) ([]byte, error) {
+	switch format {
+	case DigestFormatCSV:
+		return digestCSV(rows)
+	case DigestFormatXLSX:
+		return digestXLSX(rows)
+	}
+	return nil, fmt.Errorf("неподдерживаемый формат дайджеста %q", format)
+}
+
+// digestCSV формирует CSV с разделителем ";" и меткой BOM – в таком виде файл без настройки
+// открывается в Excel с русской локалью.
+func digestCSV(rows [][]interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("\uFEFF")
+	w := csv.NewWriter(&b)
+	w.Comma = ';'
+	w.UseCRLF = true
+	if err := w.Write(digestHeader); err != nil {
+		return nil, err
+	}
+	record := make([]string, len(digestHeader))
+	for _, row := range rows {
+		for i, v := range row {
+			switch x := v.(type) {
+			case float64:
+				record[i] = strings.Replace(strconv.FormatFloat(x, 'f', -1, 64), ".", ",", 1)
+			default:
+				record[i] = fmt.Sprint(x)
+			}
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return b.Bytes(), w.Error()
+}
+
+// Части минимальной книги XLSX (Office Open XML) с одним листом.
+const (
+	xlsxContentTypes = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`
+	xlsxRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+	xlsxWorkbook = xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Контракты" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxWorkbookRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`
+)
+
+// digestXLSX формирует книгу XLSX с одним листом. Строки записываются как inline-строки,
+// поэтому книге не нужны таблица общих строк и стили.
+func digestXLSX(rows [][]interface{}) ([]byte, error) {
+	var sheet bytes.Buffer
+	sheet.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	header := make([]interface{}, len(digestHeader))
+	for i, h := range digestHeader {
+		header[i] = h
+	}
+	for r, row := range append([][]interface{}{header}, rows...) {
+		fmt.Fprintf(&sheet, `<row r="%d">`, r+1)
+		for c, v := range row {
+			ref := xlsxColumn(c) + strconv.Itoa(r+1)
+			if f, ok := v.(float64); ok {
+				fmt.Fprintf(&sheet, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(f, 'f', -1, 64))
+				continue
+			}
+			fmt.Fprintf(&sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+			if err := xml.EscapeText(&sheet, []byte(fmt.Sprint(v))); err != nil {
+				return nil, err
+			}
+			sheet.WriteString(`</t></is></c>`)
+		}
+		sheet.WriteString(`</row>`)
+	}
+	sheet.WriteString(`</sheetData></worksheet>`)
+
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/worksheets/sheet1.xml", sheet.String()},
+	}
+	for _, p := range parts {
+		w, err := zw.Create(p.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(p.body)); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// xlsxColumn возвращает буквенное имя столбца: 0 → A, 26 → AA.
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
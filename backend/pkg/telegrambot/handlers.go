@@ -0,0 +1,154 @@
+package telegrambot
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+
+	"github.com/ryantrue/EaistSync/pkg/api/rest"
+)
+
+// LinkCodeResponse – код привязки и команда, которую нужно отправить боту.
+type LinkCodeResponse struct {
+	Code      string    `json:"code"`
+	Command   string    `json:"command"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// LinkStatusResponse – состояние привязки Telegram текущего пользователя.
+type LinkStatusResponse struct {
+	Linked   bool       `json:"linked"`
+	ChatID   int64      `json:"chat_id,omitempty"`
+	LinkedAt *time.Time `json:"linked_at,omitempty"`
+}
+
+// SubscriptionInput – данные новой подписки.
+type SubscriptionInput struct {
+	Kind       string `json:"kind"`
+	ContractID *int64 `json:"contract_id"`
+	Days       *int   `json:"days"`
+}
+
+// CreateLinkCodeHandler выдаёт одноразовый код для команды /start.
+func CreateLinkCodeHandler(db *sqlx.DB, log *zap.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := rest.UserIDFromContext(c)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Неавторизованный доступ"})
+		}
+		code, expiresAt, err := CreateLinkCode(c.Request().Context(), db, userID)
+		if err != nil {
+			log.Error("Ошибка создания кода привязки Telegram", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Ошибка БД"})
+		}
+		return c.JSON(http.StatusCreated, LinkCodeResponse{Code: code, Command: "/start " + code, ExpiresAt: expiresAt})
+	}
+}
+
+// GetLinkHandler возвращает состояние привязки Telegram.
+func GetLinkHandler(db *sqlx.DB, log *zap.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := rest.UserIDFromContext(c)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Неавторизованный доступ"})
+		}
+		link, err := GetLink(c.Request().Context(), db, userID)
+		if err != nil {
+			log.Error("Ошибка получения привязки Telegram", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Ошибка БД"})
+		}
+		if link == nil {
+			return c.JSON(http.StatusOK, LinkStatusResponse{})
+		}
+		return c.JSON(http.StatusOK, LinkStatusResponse{Linked: true, ChatID: link.ChatID, LinkedAt: &link.LinkedAt})
+	}
+}
+
+// UnlinkHandler отвязывает Telegram от текущего пользователя.
+func UnlinkHandler(db *sqlx.DB, log *zap.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := rest.UserIDFromContext(c)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Неавторизованный доступ"})
+		}
+		removed, err := Unlink(c.Request().Context(), db, userID)
+		if err != nil {
+			log.Error("Ошибка удаления привязки Telegram", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Ошибка БД"})
+		}
+		if !removed {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Telegram не привязан"})
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// ListSubscriptionsHandler возвращает Telegram-подписки текущего пользователя.
+func ListSubscriptionsHandler(db *sqlx.DB, log *zap.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := rest.UserIDFromContext(c)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Неавторизованный доступ"})
+		}
+		subs, err := ListSubscriptions(c.Request().Context(), db, userID)
+		if err != nil {
+			log.Error("Ошибка получения подписок Telegram", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Ошибка БД"})
+		}
+		return c.JSON(http.StatusOK, subs)
+	}
+}
+
+// CreateSubscriptionHandler создаёт подписку; повторная подписка возвращает существующую.
+func CreateSubscriptionHandler(db *sqlx.DB, log *zap.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := rest.UserIDFromContext(c)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Неавторизованный доступ"})
+		}
+		var input SubscriptionInput
+		if err := c.Bind(&input); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Неверные входные данные"})
+		}
+		sub := Subscription{UserID: userID, Kind: input.Kind, ContractID: input.ContractID, Days: input.Days}
+		if err := sub.Validate(); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		sub, created, err := Subscribe(c.Request().Context(), db, sub)
+		if err != nil {
+			log.Error("Ошибка сохранения подписки Telegram", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Ошибка БД"})
+		}
+		if !created {
+			return c.JSON(http.StatusOK, sub)
+		}
+		return c.JSON(http.StatusCreated, sub)
+	}
+}
+
+// DeleteSubscriptionHandler удаляет подписку текущего пользователя.
+func DeleteSubscriptionHandler(db *sqlx.DB, log *zap.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := rest.UserIDFromContext(c)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Неавторизованный доступ"})
+		}
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Неверный идентификатор подписки"})
+		}
+		removed, err := Unsubscribe(c.Request().Context(), db, userID, id)
+		if err != nil {
+			log.Error("Ошибка удаления подписки Telegram", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Ошибка БД"})
+		}
+		if !removed {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Подписка не найдена"})
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
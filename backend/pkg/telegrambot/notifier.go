@@ -0,0 +1,255 @@
+package telegrambot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+
+	"github.com/ryantrue/EaistSync/pkg/events"
+)
+
+// activeContractsEndDate выбирает действующие контракты с датой окончания end_date;
+// у контрактов без корректной даты (нет даты, не тот формат, 2024-13-45) end_date равна NULL:
+// eaist_date не прерывает запрос ошибкой приведения из-за одного контракта.
+const activeContractsEndDate = `
+	SELECT id, data, eaist_date(data->>'endDate') AS end_date
+	FROM contracts
+	WHERE missing_since IS NULL`
+
+// Notifier рассылает уведомления привязанным пользователям по их подпискам. Общий чат TelegramChatID
+// получает уведомления через TelegramBot как прежде, поэтому новые контракты и ошибки синхронизации
+// в него повторно не отправляются.
+type Notifier struct {
+	bot *TelegramBot
+	db  *sqlx.DB
+	log *zap.Logger
+}
+
+// NewNotifier создаёт рассыльщика уведомлений по подпискам.
+func NewNotifier(bot *TelegramBot, db *sqlx.DB, log *zap.Logger) *Notifier {
+	return &Notifier{bot: bot, db: db, log: log}
+}
+
+// NotifyNewContracts сообщает подписчикам new_contracts о новых контрактах.
+func (n *Notifier) NotifyNewContracts(ctx context.Context, contracts []map[string]interface{}) {
+	if len(contracts) == 0 {
+		return
+	}
+	n.broadcast(ctx, KindNewContracts, func(chatID int64) error {
+		return n.bot.SendContracts(ctx, chatID, contracts, nil)
+	})
+}
+
+// NotifySyncFailure сообщает подписчикам sync_failures об ошибке синхронизации.
+func (n *Notifier) NotifySyncFailure(ctx context.Context, failure SyncFailedMessage) {
+	n.broadcast(ctx, KindSyncFailures, func(chatID int64) error {
+		return n.bot.SendTemplate(ctx, chatID, TemplateSyncFailed, failure)
+	})
+}
+
+// broadcast вызывает send для всех чатов с подпиской kind, кроме общего чата.
+func (n *Notifier) broadcast(ctx context.Context, kind string, send func(chatID int64) error) {
+	chats, err := subscribedChats(ctx, n.db, kind)
+	if err != nil {
+		n.log.Error("Ошибка получения подписчиков Telegram", zap.String("kind", kind), zap.Error(err))
+		return
+	}
+	for _, chatID := range chats {
+		if chatID == n.bot.ChatID() {
+			continue
+		}
+		if err := send(chatID); err != nil {
+			n.log.Error("Ошибка отправки уведомления в Telegram", zap.String("kind", kind), zap.Int64("chatId", chatID), zap.Error(err))
+		}
+	}
+}
+
+// NotifyStateChanges сообщает подписчикам state_changes о смене состояния их контрактов.
+func (n *Notifier) NotifyStateChanges(ctx context.Context, changes []events.ContractStateChanged) {
+	if len(changes) == 0 {
+		return
+	}
+	byContract := make(map[int64]events.ContractStateChanged, len(changes))
+	ids := make([]int64, 0, len(changes))
+	for _, c := range changes {
+		if _, ok := byContract[c.ContractID]; !ok {
+			ids = append(ids, c.ContractID)
+		}
+		byContract[c.ContractID] = c
+	}
+	subs, err := stateSubscribers(ctx, n.db, ids)
+	if err != nil {
+		n.log.Error("Ошибка получения подписчиков Telegram", zap.String("kind", KindStateChanges), zap.Error(err))
+		return
+	}
+
+	if len(subs) == 0 {
+		return
+	}
+	names := n.stateNames(ctx, changes)
+
+	items := make(map[int64][]interface{})
+	var chats []int64
+	for _, s := range subs {
+		c := byContract[s.ContractID]
+		if _, ok := items[s.ChatID]; !ok {
+			chats = append(chats, s.ChatID)
+		}
+		items[s.ChatID] = append(items[s.ChatID], StateChangeMessage{
+			ContractID:      c.ContractID,
+			PreviousStateID: c.PreviousStateID,
+			StateID:         c.StateID,
+			PreviousState:   names[stateKey(c.PreviousStateID)],
+			State:           names[stateKey(c.StateID)],
+		})
+	}
+	for _, chatID := range chats {
+		if err := n.bot.SendTemplate(ctx, chatID, TemplateContractStateChanged, items[chatID]...); err != nil {
+			n.log.Error("Ошибка отправки уведомления в Telegram", zap.String("kind", KindStateChanges), zap.Int64("chatId", chatID), zap.Error(err))
+		}
+	}
+}
+
+// stateNames возвращает наименования состояний из справочника states по их ID. Если справочник
+// недоступен, уведомление отправляется с одними ID.
+func (n *Notifier) stateNames(ctx context.Context, changes []events.ContractStateChanged) map[string]string {
+	var ids []int64
+	for _, c := range changes {
+		for _, v := range []interface{}{c.PreviousStateID, c.StateID} {
+			if id, ok := v.(float64); ok {
+				ids = append(ids, int64(id))
+			}
+		}
+	}
+	names := make(map[string]string)
+	if len(ids) == 0 {
+		return names
+	}
+	var rows []struct {
+		ID   int64  `db:"id"`
+		Name string `db:"name"`
+	}
+	err := n.db.SelectContext(ctx, &rows, `
+		SELECT id, COALESCE(data->>'name', '') AS name FROM states WHERE id = ANY($1)`, pq.Int64Array(ids))
+	if err != nil {
+		n.log.Warn("Не удалось получить наименования состояний", zap.Error(err))
+		return names
+	}
+	for _, r := range rows {
+		names[strconv.FormatInt(r.ID, 10)] = r.Name
+	}
+	return names
+}
+
+// stateKey приводит ID состояния из JSON контракта к ключу справочника.
+func stateKey(v interface{}) string {
+	if id, ok := v.(float64); ok {
+		return strconv.FormatInt(int64(id), 10)
+	}
+	return fmt.Sprint(v)
+}
+
+// expiringContract – контракт, о скором окончании которого нужно напомнить по подписке.
+type expiringContract struct {
+	SubscriptionID int64     `db:"subscription_id"`
+	ChatID         int64     `db:"chat_id"`
+	ContractID     int64     `db:"contract_id"`
+	ContractNumber string    `db:"contract_number"`
+	Name           string    `db:"name"`
+	EndDate        time.Time `db:"end_date"`
+}
+
+// NotifyExpiring напоминает подписчикам expiring о контрактах, заканчивающихся в ближайшие
+// days дней. О каждом контракте по подписке напоминание отправляется один раз; если отправка
+// не удалась, напоминание повторится при следующем запуске.
+func (n *Notifier) NotifyExpiring(ctx context.Context) error {
+	var due []expiringContract
+	err := n.db.SelectContext(ctx, &due, `
+		SELECT s.id AS subscription_id, l.chat_id, c.id AS contract_id,
+		       COALESCE(c.data->>'contractNumber', '') AS contract_number,
+		       COALESCE(c.data->>'name', '') AS name, c.end_date
+		FROM telegram_subscriptions s
+		JOIN telegram_links l ON l.user_id = s.user_id
+		JOIN (`+activeContractsEndDate+`) c ON c.end_date BETWEEN CURRENT_DATE AND CURRENT_DATE + s.days
+		WHERE s.kind = $1
+		  AND NOT EXISTS (SELECT 1 FROM telegram_expiry_notices e WHERE e.subscription_id = s.id AND e.contract_id = c.id)
+		ORDER BY l.chat_id, c.end_date, c.id`, KindExpiring)
+	if err != nil {
+		return fmt.Errorf("ошибка выбора заканчивающихся контрактов: %w", err)
+	}
+
+	var errs []error
+	for start := 0; start < len(due); {
+		end := start
+		for end < len(due) && due[end].ChatID == due[start].ChatID {
+			end++
+		}
+		if err := n.sendExpiring(ctx, due[start:end]); err != nil {
+			errs = append(errs, err)
+		}
+		start = end
+	}
+	return errors.Join(errs...)
+}
+
+// sendExpiring отправляет напоминание в один чат и отмечает контракты как напомненные.
+func (n *Notifier) sendExpiring(ctx context.Context, due []expiringContract) error {
+	chatID := due[0].ChatID
+	seen := make(map[int64]bool)
+	var items []interface{}
+	subIDs := make([]int64, len(due))
+	contractIDs := make([]int64, len(due))
+	for i, c := range due {
+		subIDs[i], contractIDs[i] = c.SubscriptionID, c.ContractID
+		if seen[c.ContractID] {
+			continue
+		}
+		seen[c.ContractID] = true
+		items = append(items, ExpiringMessage{ID: c.ContractID, ContractNumber: c.ContractNumber, Name: c.Name, EndDate: c.EndDate})
+	}
+	if err := n.bot.SendTemplate(ctx, chatID, TemplateContractExpiring, items...); err != nil {
+		return fmt.Errorf("чат %d: %w", chatID, err)
+	}
+	_, err := n.db.ExecContext(ctx, `
+		INSERT INTO telegram_expiry_notices (subscription_id, contract_id)
+		SELECT unnest($1::bigint[]), unnest($2::bigint[])
+		ON CONFLICT DO NOTHING`, pq.Int64Array(subIDs), pq.Int64Array(contractIDs))
+	if err != nil {
+		return fmt.Errorf("чат %d: ошибка сохранения напоминаний: %w", chatID, err)
+	}
+	return nil
+}
+
+// contractTitle возвращает подпись контракта из его JSON.
+func contractTitle(contract map[string]interface{}) string {
+	id := contractID(contract)
+	number, _ := contract["contractNumber"].(string)
+	name, _ := contract["name"].(string)
+	return contractLabel(id, number, name)
+}
+
+// contractID возвращает ID контракта из его JSON или 0, если ID нет.
+func contractID(contract map[string]interface{}) int64 {
+	if v, ok := contract["id"].(float64); ok {
+		return int64(v)
+	}
+	return 0
+}
+
+// contractLabel формирует подпись вида "№ <номер> (<id>): <наименование>".
+func contractLabel(id int64, number, name string) string {
+	label := fmt.Sprintf("%d", id)
+	if number != "" {
+		label = fmt.Sprintf("№ %s (%d)", number, id)
+	}
+	if name != "" {
+		label += ": " + name
+	}
+	return label
+}
@@ -0,0 +1,181 @@
+package telegrambot
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+
+	"github.com/ryantrue/EaistSync/pkg/events"
+)
+
+// fakeSender запоминает отправленные сообщения по чатам.
+type fakeSender struct {
+	chatID    int64
+	messages  map[int64][]string
+	pages     []fakePage
+	documents []string
+}
+
+// fakePage – сообщение с inline-клавиатурой.
+type fakePage struct {
+	chatID    int64
+	messageID int
+	text      string
+	keyboard  [][]tgbotapi.InlineKeyboardButton
+}
+
+func (f *fakeSender) ChatID() int64 { return f.chatID }
+
+func (f *fakeSender) SendMessage(_ context.Context, chatID int64, text string) error {
+	if f.messages == nil {
+		f.messages = make(map[int64][]string)
+	}
+	f.messages[chatID] = append(f.messages[chatID], text)
+	return nil
+}
+
+func (f *fakeSender) SendFormatted(ctx context.Context, chatID int64, text, _ string) error {
+	return f.SendMessage(ctx, chatID, text)
+}
+
+func (f *fakeSender) SendDocument(_ context.Context, chatID int64, fileName string, _ []byte) error {
+	f.documents = append(f.documents, fileName)
+	return nil
+}
+
+func (f *fakeSender) SendPage(_ context.Context, chatID int64, messageID int, text string, keyboard [][]tgbotapi.InlineKeyboardButton) error {
+	f.pages = append(f.pages, fakePage{chatID: chatID, messageID: messageID, text: text, keyboard: keyboard})
+	return nil
+}
+
+func (f *fakeSender) AnswerCallback(context.Context, string, string) error { return nil }
+
+// newTestBot создаёт TelegramBot с шаблонами HTML по умолчанию поверх sender.
+func newTestBot(t *testing.T, sender BotSender) *TelegramBot {
+	t.Helper()
+	renderer, err := NewRenderer(ParseModeHTML, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &TelegramBot{sender: sender, renderer: renderer}
+}
+
+func newTestNotifier(t *testing.T) (*Notifier, *fakeSender, sqlmock.Sqlmock) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	sender := &fakeSender{chatID: 100}
+	return NewNotifier(newTestBot(t, sender), sqlx.NewDb(sqlDB, "sqlmock"), zap.NewNop()), sender, mock
+}
+
+func TestSubscriptionValidate(t *testing.T) {
+	id, days := int64(5), 400
+	cases := []struct {
+		sub Subscription
+		ok  bool
+	}{
+		{Subscription{Kind: KindNewContracts, ContractID: &id}, true},
+		{Subscription{Kind: KindStateChanges}, false},
+		{Subscription{Kind: KindStateChanges, ContractID: &id}, true},
+		{Subscription{Kind: KindExpiring, Days: &days}, false},
+		{Subscription{Kind: "digest"}, false},
+	}
+	for _, c := range cases {
+		err := c.sub.Validate()
+		if (err == nil) != c.ok {
+			t.Errorf("Validate(%s) = %v", c.sub.Kind, err)
+		}
+	}
+	sub := Subscription{Kind: KindNewContracts, ContractID: &id}
+	_ = sub.Validate()
+	if sub.ContractID != nil {
+		t.Fatal("contract_id должен сбрасываться для new_contracts")
+	}
+}
+
+func TestNotifyStateChanges(t *testing.T) {
+	n, sender, mock := newTestNotifier(t)
+	mock.ExpectQuery("SELECT DISTINCT l.chat_id, s.contract_id").
+		WithArgs(KindStateChanges, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"chat_id", "contract_id"}).
+			AddRow(1, 10).AddRow(1, 11).AddRow(2, 11))
+	mock.ExpectQuery(`SELECT id, COALESCE\(data->>'name', ''\) AS name FROM states`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(2, "Исполнение").AddRow(3, "Исполнен"))
+
+	n.NotifyStateChanges(context.Background(), []events.ContractStateChanged{
+		{ContractID: 10, PreviousStateID: float64(1), StateID: float64(2)},
+		{ContractID: 11, PreviousStateID: float64(2), StateID: float64(3)},
+		{ContractID: 12, PreviousStateID: float64(1), StateID: float64(4)},
+	})
+
+	if len(sender.messages[1]) != 1 || !strings.Contains(sender.messages[1][0], "контракта</b> 10\n1 → Исполнение") ||
+		!strings.Contains(sender.messages[1][0], "контракта</b> 11\nИсполнение → Исполнен") {
+		t.Fatalf("чат 1: %q", sender.messages[1])
+	}
+	if len(sender.messages[2]) != 1 || strings.Contains(sender.messages[2][0], "</b> 10") {
+		t.Fatalf("чат 2: %q", sender.messages[2])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNotifyNewContractsSkipsSharedChat(t *testing.T) {
+	n, sender, mock := newTestNotifier(t)
+	mock.ExpectQuery("SELECT DISTINCT l.chat_id FROM telegram_subscriptions").
+		WithArgs(KindNewContracts).
+		WillReturnRows(sqlmock.NewRows([]string{"chat_id"}).AddRow(100).AddRow(7))
+
+	n.NotifyNewContracts(context.Background(), []map[string]interface{}{
+		{"id": float64(42), "contractNumber": "0373-1", "name": "Поставка бумаги"},
+	})
+
+	if len(sender.messages[100]) != 0 {
+		t.Fatalf("общий чат получил повтор: %q", sender.messages[100])
+	}
+	if want := "№ 0373-1 (42): Поставка бумаги"; len(sender.messages[7]) != 1 || !strings.Contains(sender.messages[7][0], want) {
+		t.Fatalf("чат 7: %q", sender.messages[7])
+	}
+}
+
+func TestLinkChat(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+	db := sqlx.NewDb(sqlDB, "sqlmock")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("DELETE FROM telegram_link_codes").WithArgs("abc").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(3))
+	mock.ExpectExec("DELETE FROM telegram_links WHERE chat_id").WithArgs(int64(55), int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO telegram_links").WithArgs(int64(3), int64(55)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	userID, err := LinkChat(context.Background(), db, "abc", 55)
+	if err != nil || userID != 3 {
+		t.Fatalf("LinkChat = %d, %v", userID, err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("DELETE FROM telegram_link_codes").WithArgs("old").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+	mock.ExpectRollback()
+	if _, err := LinkChat(context.Background(), db, "old", 55); err != ErrLinkCodeInvalid {
+		t.Fatalf("LinkChat(old) = %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
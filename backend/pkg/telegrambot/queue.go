@@ -0,0 +1,281 @@
+package telegrambot
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// Статусы сообщений в очереди telegram_queue. Отправленные сообщения удаляются из очереди.
+const (
+	QueuePending = "pending"
+	QueueFailed  = "failed"
+)
+
+const (
+	defaultQueueInterval = 5 * time.Second
+	defaultQueueAttempts = 10
+	queueBatchSize       = 30
+	queueBaseDelay       = 5 * time.Second
+	queueMaxDelay        = 10 * time.Minute
+	queuePurgeInterval   = time.Hour // как часто удаляются неотправленные сообщения старше срока хранения
+	// queueLease – на сколько захваченное сообщение скрывается от других обработчиков;
+	// с запасом больше времени отправки целого пакета.
+	queueLease = 5 * time.Minute
+)
+
+// requestSender выполняет одну попытку запроса к Telegram без учёта лимитов.
+type requestSender interface {
+	request(chatID int64, c tgbotapi.Chattable) error
+}
+
+// queuedMessage – сообщение из очереди: текст или, если задано имя файла, документ.
+type queuedMessage struct {
+	ID        int64   `db:"id"`
+	ChatID    int64   `db:"chat_id"`
+	Text      string  `db:"text"`
+	ParseMode string  `db:"parse_mode"`
+	FileName  *string `db:"file_name"`
+	Content   []byte  `db:"content"`
+	Attempts  int     `db:"attempts"`
+}
+
+func (m queuedMessage) chattable() tgbotapi.Chattable {
+	if m.FileName != nil {
+		return newDocument(m.ChatID, *m.FileName, m.Content)
+	}
+	return newTextMessage(m.ChatID, m.Text, m.ParseMode)
+}
+
+// messageQueue реализует BotSender поверх постоянной очереди telegram_queue: сообщения и документы
+// записываются в очередь и отправляются фоновым обработчиком Run, поэтому переживают перезапуск
+// сервиса. Сообщения в один чат отправляются по порядку с соблюдением лимитов Telegram; ответ 429
+// откладывает отправку на retry_after, прочие ошибки – на экспоненциально растущую задержку.
+// Inline-клавиатуры и ответы на нажатия кнопок отправляются сразу через direct.
+// Сообщения, которые так и не удалось отправить, хранятся retention для разбора, затем удаляются.
+type messageQueue struct {
+	direct      BotSender
+	requests    requestSender
+	limiter     *sendLimiter
+	db          *sqlx.DB
+	log         *zap.Logger
+	interval    time.Duration
+	maxAttempts int
+	retention   time.Duration
+	lastPurge   time.Time
+	wake        chan struct{}
+}
+
+// newMessageQueue создаёт очередь, проверяющую отложенные сообщения каждые interval (по умолчанию 5 секунд).
+func newMessageQueue(direct BotSender, requests requestSender, limiter *sendLimiter, db *sqlx.DB, log *zap.Logger, interval time.Duration) *messageQueue {
+	if interval <= 0 {
+		interval = defaultQueueInterval
+	}
+	return &messageQueue{
+		direct:      direct,
+		requests:    requests,
+		limiter:     limiter,
+		db:          db,
+		log:         log,
+		interval:    interval,
+		maxAttempts: defaultQueueAttempts,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// ChatID возвращает идентификатор общего чата.
+func (q *messageQueue) ChatID() int64 {
+	return q.direct.ChatID()
+}
+
+// SendMessage ставит текстовое сообщение в очередь.
+func (q *messageQueue) SendMessage(ctx context.Context, chatID int64, text string) error {
+	return q.enqueue(ctx, chatID, text, "", nil, nil)
+}
+
+// SendFormatted ставит в очередь сообщение с разметкой parseMode.
+func (q *messageQueue) SendFormatted(ctx context.Context, chatID int64, text, parseMode string) error {
+	return q.enqueue(ctx, chatID, text, parseMode, nil, nil)
+}
+
+// SendDocument ставит документ в очередь.
+func (q *messageQueue) SendDocument(ctx context.Context, chatID int64, fileName string, content []byte) error {
+	return q.enqueue(ctx, chatID, "", "", &fileName, content)
+}
+
+// SendPage отправляет страницу сразу: её редактируют по нажатию кнопок, и ждать очереди она не должна.
+func (q *messageQueue) SendPage(ctx context.Context, chatID int64, messageID int, text string, keyboard [][]tgbotapi.InlineKeyboardButton) error {
+	return q.direct.SendPage(ctx, chatID, messageID, text, keyboard)
+}
+
+// AnswerCallback подтверждает нажатие кнопки сразу: Telegram ждёт ответа лишь несколько секунд.
+func (q *messageQueue) AnswerCallback(ctx context.Context, callbackID, text string) error {
+	return q.direct.AnswerCallback(ctx, callbackID, text)
+}
+
+func (q *messageQueue) enqueue(ctx context.Context, chatID int64, text, parseMode string, fileName *string, content []byte) error {
+	// У текстовых сообщений content – NULL, а не пустой bytea.
+	var data interface{}
+	if fileName != nil {
+		data = content
+	}
+	_, err := q.db.ExecContext(ctx,
+		`INSERT INTO telegram_queue (chat_id, text, parse_mode, file_name, content) VALUES ($1, $2, $3, $4, $5)`,
+		chatID, text, parseMode, fileName, data)
+	if err != nil {
+		return fmt.Errorf("ошибка постановки сообщения Telegram в очередь: %w", err)
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run отправляет сообщения из очереди до отмены контекста.
+func (q *messageQueue) Run(ctx context.Context) {
+	for {
+		q.purge(ctx)
+		processed, delay, err := q.Flush(ctx)
+		if err != nil {
+			q.log.Warn("Ошибка обработки очереди Telegram", zap.Error(err))
+			delay = q.interval
+		} else if processed > 0 {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		if delay <= 0 || delay > q.interval {
+			delay = q.interval
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Flush отправляет по одному первому сообщению из очереди каждого чата, если лимит чата это позволяет,
+// и возвращает число обработанных сообщений и время до освобождения лимита ближайшего из пропущенных чатов.
+// Сообщения захватываются коротким запросом, который откладывает их на queueLease, и отправляются
+// вне транзакции; результат каждой отправки записывается отдельно, поэтому ошибка записи не возвращает
+// в очередь уже принятые Telegram сообщения. Если процесс упадёт посреди пакета, неотправленные
+// сообщения вернутся в очередь по истечении аренды.
+func (q *messageQueue) Flush(ctx context.Context) (processed int, delay time.Duration, err error) {
+	// Берётся только первое ожидающее сообщение чата, даже отложенное: иначе более новые
+	// сообщения обогнали бы его.
+	var rows []queuedMessage
+	err = q.db.SelectContext(ctx, &rows, `
+		WITH claimed AS (
+			UPDATE telegram_queue
+			SET next_attempt_at = now() + $2 * interval '1 millisecond'
+			WHERE id IN (
+				SELECT q.id FROM telegram_queue q
+				WHERE q.id IN (SELECT min(id) FROM telegram_queue WHERE status = 'pending' GROUP BY chat_id)
+				  AND q.next_attempt_at <= now()
+				ORDER BY q.id
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED)
+			RETURNING id, chat_id, text, parse_mode, file_name, content, attempts)
+		SELECT id, chat_id, text, parse_mode, file_name, content, attempts
+		FROM claimed
+		ORDER BY id`, queueBatchSize, queueLease.Milliseconds())
+	if err != nil {
+		return 0, 0, fmt.Errorf("ошибка выбора сообщений Telegram из очереди: %w", err)
+	}
+
+	for _, row := range rows {
+		if d := q.limiter.reserve(row.ChatID); d > 0 {
+			// Аренда снимается: сообщение отправляется, как только лимит чата освободится.
+			if _, err = q.db.ExecContext(ctx,
+				`UPDATE telegram_queue SET next_attempt_at = now() + $2 * interval '1 millisecond' WHERE id = $1`,
+				row.ID, d.Milliseconds()); err != nil {
+				return processed, 0, fmt.Errorf("ошибка откладывания сообщения Telegram %d: %w", row.ID, err)
+			}
+			if delay == 0 || d < delay {
+				delay = d
+			}
+			continue
+		}
+		if err = q.limiter.global.Wait(ctx); err != nil {
+			return processed, 0, err
+		}
+		if err = q.deliver(ctx, row); err != nil {
+			return processed, 0, err
+		}
+		processed++
+	}
+	return processed, delay, nil
+}
+
+// purge не чаще раза в queuePurgeInterval удаляет неотправленные сообщения старше срока хранения.
+func (q *messageQueue) purge(ctx context.Context) {
+	if q.retention <= 0 || time.Since(q.lastPurge) < queuePurgeInterval {
+		return
+	}
+	q.lastPurge = time.Now()
+	res, err := q.db.ExecContext(ctx,
+		`DELETE FROM telegram_queue WHERE status = 'failed' AND created_at < now() - $1 * interval '1 millisecond'`,
+		q.retention.Milliseconds())
+	if err != nil {
+		q.log.Warn("Не удалось удалить старые сообщения из очереди Telegram", zap.Error(err))
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		q.log.Info("Удалены старые неотправленные сообщения Telegram", zap.Int64("count", n))
+	}
+}
+
+// deliver отправляет сообщение и удаляет его из очереди либо откладывает следующую попытку.
+func (q *messageQueue) deliver(ctx context.Context, row queuedMessage) error {
+	sendErr := q.requests.request(row.ChatID, row.chattable())
+	if sendErr == nil {
+		if _, err := q.db.ExecContext(ctx, `DELETE FROM telegram_queue WHERE id = $1`, row.ID); err != nil {
+			return fmt.Errorf("ошибка удаления отправленного сообщения Telegram %d: %w", row.ID, err)
+		}
+		return nil
+	}
+
+	// Ответ 429 – не ошибка сообщения: оно отправляется, как только Telegram разрешит.
+	if wait := retryAfter(sendErr); wait > 0 {
+		_, err := q.db.ExecContext(ctx,
+			`UPDATE telegram_queue SET last_error = $2, next_attempt_at = now() + $3 * interval '1 millisecond' WHERE id = $1`,
+			row.ID, sendErr.Error(), wait.Milliseconds())
+		if err != nil {
+			return fmt.Errorf("ошибка откладывания сообщения Telegram %d: %w", row.ID, err)
+		}
+		return nil
+	}
+
+	attempt := row.Attempts + 1
+	status := QueuePending
+	if attempt >= q.maxAttempts || permanent(sendErr) {
+		status = QueueFailed
+		q.log.Warn("Сообщение Telegram не отправлено", zap.Int64("message", row.ID), zap.Int64("chatId", row.ChatID),
+			zap.Int("attempts", attempt), zap.Error(sendErr))
+	}
+	_, err := q.db.ExecContext(ctx,
+		`UPDATE telegram_queue SET status = $2, attempts = attempts + 1, last_error = $3,
+			next_attempt_at = now() + $4 * interval '1 millisecond' WHERE id = $1`,
+		row.ID, status, sendErr.Error(), queueRetryDelay(attempt).Milliseconds())
+	if err != nil {
+		return fmt.Errorf("ошибка откладывания сообщения Telegram %d: %w", row.ID, err)
+	}
+	return nil
+}
+
+// queueRetryDelay возвращает задержку перед attempt-й повторной отправкой из очереди.
+func queueRetryDelay(attempt int) time.Duration {
+	delay := queueBaseDelay
+	for i := 1; i < attempt && delay < queueMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, queueMaxDelay)
+}
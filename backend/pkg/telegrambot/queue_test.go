@@ -0,0 +1,186 @@
+package telegrambot
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// fakeRequests отвечает на запросы заданными по чатам ошибками.
+type fakeRequests struct {
+	limiter *sendLimiter
+	errs    map[int64]error
+	sent    []int64
+}
+
+func (f *fakeRequests) request(chatID int64, _ tgbotapi.Chattable) error {
+	f.sent = append(f.sent, chatID)
+	err := f.errs[chatID]
+	if d := retryAfter(err); d > 0 {
+		f.limiter.pause(chatID, d)
+	}
+	return err
+}
+
+func TestSendLimiter(t *testing.T) {
+	l := newSendLimiter()
+	if d := l.reserve(1); d != 0 {
+		t.Fatalf("первое сообщение в чат задержано на %v", d)
+	}
+	if d := l.reserve(1); d <= 0 || d > privateChatInterval {
+		t.Fatalf("второе сообщение в личный чат: задержка %v", d)
+	}
+	l.reserve(-100)
+	if d := l.reserve(-100); d <= privateChatInterval || d > groupChatInterval {
+		t.Fatalf("второе сообщение в группу: задержка %v", d)
+	}
+	l.pause(2, time.Minute)
+	if d := l.reserve(2); d < 59*time.Second {
+		t.Fatalf("чат после 429: задержка %v", d)
+	}
+}
+
+func TestRetryOperation(t *testing.T) {
+	calls := 0
+	err := retryOperation(context.Background(), zap.NewNop(), func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("connection reset")
+		}
+		return nil
+	}, 3, time.Millisecond)
+	if err != nil || calls != 3 {
+		t.Fatalf("retryOperation = %v после %d попыток", err, calls)
+	}
+
+	calls = 0
+	err = retryOperation(context.Background(), zap.NewNop(), func() error {
+		calls++
+		return &tgbotapi.Error{Code: 400, Message: "Bad Request: can't parse entities"}
+	}, 3, time.Millisecond)
+	if err == nil || calls != 1 {
+		t.Fatalf("ошибка 400 не должна повторяться: %v, попыток %d", err, calls)
+	}
+
+	if d := retryAfter(&tgbotapi.Error{Code: 429, ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 7}}); d != 7*time.Second {
+		t.Fatalf("retryAfter = %v", d)
+	}
+	if permanent(&tgbotapi.Error{Code: 429}) || permanent(errors.New("timeout")) {
+		t.Fatal("429 и сетевые ошибки должны повторяться")
+	}
+}
+
+func newTestQueue(t *testing.T, errs map[int64]error) (*messageQueue, *fakeRequests, sqlmock.Sqlmock) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	limiter := newSendLimiter()
+	requests := &fakeRequests{limiter: limiter, errs: errs}
+	q := newMessageQueue(&fakeSender{chatID: 100}, requests, limiter, sqlx.NewDb(sqlDB, "sqlmock"), zap.NewNop(), 0)
+	return q, requests, mock
+}
+
+func TestQueueEnqueue(t *testing.T) {
+	q, _, mock := newTestQueue(t, nil)
+	mock.ExpectExec("INSERT INTO telegram_queue").
+		WithArgs(int64(7), "<b>Привет</b>", ParseModeHTML, nil, nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if err := q.SendFormatted(context.Background(), 7, "<b>Привет</b>", ParseModeHTML); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-q.wake:
+	default:
+		t.Fatal("обработчик очереди не разбужен")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQueueFlush(t *testing.T) {
+	tooMany := &tgbotapi.Error{Code: 429, Message: "Too Many Requests", ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 7}}
+	blocked := &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}
+	q, requests, mock := newTestQueue(t, map[int64]error{20: tooMany, 30: blocked, 40: errors.New("timeout")})
+
+	mock.ExpectQuery("WITH claimed AS").WithArgs(queueBatchSize, queueLease.Milliseconds()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "chat_id", "text", "parse_mode", "file_name", "content", "attempts"}).
+			AddRow(1, 10, "a", "", nil, nil, 0).
+			AddRow(2, 20, "b", "", nil, nil, 0).
+			AddRow(3, 30, "c", "", nil, nil, 0).
+			AddRow(4, 40, "", "", "contracts.csv", []byte("x"), 2))
+	mock.ExpectExec("DELETE FROM telegram_queue WHERE id").WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE telegram_queue SET last_error").WithArgs(int64(2), tooMany.Error(), int64(7000)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE telegram_queue SET status").WithArgs(int64(3), QueueFailed, blocked.Error(), int64(5000)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE telegram_queue SET status").WithArgs(int64(4), QueuePending, "timeout", int64(20000)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	processed, _, err := q.Flush(context.Background())
+	if err != nil || processed != 4 {
+		t.Fatalf("Flush = %d, %v", processed, err)
+	}
+	if len(requests.sent) != 4 {
+		t.Fatalf("отправлено %v", requests.sent)
+	}
+	if d := q.limiter.reserve(20); d < 6*time.Second {
+		t.Fatalf("чат 20 не приостановлен после 429: %v", d)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Чат 10 только что получил сообщение, поэтому следующее ждёт лимита и остаётся в очереди:
+	// аренда заменяется временем до освобождения лимита.
+	mock.ExpectQuery("WITH claimed AS").WithArgs(queueBatchSize, queueLease.Milliseconds()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "chat_id", "text", "parse_mode", "file_name", "content", "attempts"}).
+			AddRow(5, 10, "d", "", nil, nil, 0))
+	mock.ExpectExec("UPDATE telegram_queue SET next_attempt_at").WithArgs(int64(5), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	processed, delay, err := q.Flush(context.Background())
+	if err != nil || processed != 0 || delay <= 0 || delay > privateChatInterval {
+		t.Fatalf("Flush = %d, %v, %v", processed, delay, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestQueueFlushKeepsDelivered проверяет, что ошибка записи результата одной отправки не возвращает
+// в очередь сообщения, уже принятые Telegram: каждый результат записывается отдельно.
+func TestQueueFlushKeepsDelivered(t *testing.T) {
+	q, requests, mock := newTestQueue(t, nil)
+
+	mock.ExpectQuery("WITH claimed AS").WithArgs(queueBatchSize, queueLease.Milliseconds()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "chat_id", "text", "parse_mode", "file_name", "content", "attempts"}).
+			AddRow(1, 10, "a", "", nil, nil, 0).
+			AddRow(2, 20, "b", "", nil, nil, 0))
+	mock.ExpectExec("DELETE FROM telegram_queue WHERE id").WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM telegram_queue WHERE id").WithArgs(int64(2)).
+		WillReturnError(errors.New("connection reset"))
+
+	processed, _, err := q.Flush(context.Background())
+	if err == nil || processed != 1 {
+		t.Fatalf("Flush = %d, %v", processed, err)
+	}
+	if len(requests.sent) != 2 {
+		t.Fatalf("отправлено %v", requests.sent)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,114 @@
+package telegrambot
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Лимиты Telegram Bot API на отправку сообщений: около 30 сообщений в секунду во все чаты,
+// не больше одного сообщения в секунду в личный чат и 20 сообщений в минуту в группу.
+const (
+	globalSendRate      = 30
+	privateChatInterval = time.Second
+	groupChatInterval   = time.Minute / 20
+	chatLimiterIdle     = 10 * time.Minute // через сколько простоя лимит чата забывается
+)
+
+// chatLimit – лимит отправки в один чат.
+type chatLimit struct {
+	limiter     *rate.Limiter
+	pausedUntil time.Time // до какого времени Telegram попросил не писать в чат (ответ 429)
+	lastUsed    time.Time
+}
+
+// sendLimiter ограничивает частоту отправки сообщений общим лимитом бота и лимитом каждого чата.
+type sendLimiter struct {
+	global *rate.Limiter
+
+	mu        sync.Mutex
+	chats     map[int64]*chatLimit
+	lastSweep time.Time
+}
+
+// newSendLimiter создаёт ограничитель с лимитами Telegram.
+func newSendLimiter() *sendLimiter {
+	return &sendLimiter{
+		global:    rate.NewLimiter(globalSendRate, 1),
+		chats:     make(map[int64]*chatLimit),
+		lastSweep: time.Now(),
+	}
+}
+
+// wait блокируется, пока отправка в чат chatID не уложится в лимиты.
+func (l *sendLimiter) wait(ctx context.Context, chatID int64) error {
+	for {
+		delay := l.reserve(chatID)
+		if delay == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+	return l.global.Wait(ctx)
+}
+
+// reserve занимает место для отправки в чат chatID и возвращает 0 либо, если чат сейчас
+// недоступен, время до освобождения места. Общий лимит reserve не затрагивает.
+func (l *sendLimiter) reserve(chatID int64) time.Duration {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c := l.chat(chatID, now)
+	if now.Before(c.pausedUntil) {
+		return c.pausedUntil.Sub(now)
+	}
+	r := c.limiter.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return delay
+	}
+	return 0
+}
+
+// pause запрещает отправку в чат chatID на время d, о котором попросил Telegram.
+func (l *sendLimiter) pause(chatID int64, d time.Duration) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c := l.chat(chatID, now)
+	if until := now.Add(d); until.After(c.pausedUntil) {
+		c.pausedUntil = until
+	}
+}
+
+// chat возвращает лимит чата, заодно забывая лимиты давно неактивных чатов. Вызывающий удерживает l.mu.
+func (l *sendLimiter) chat(chatID int64, now time.Time) *chatLimit {
+	if now.Sub(l.lastSweep) > chatLimiterIdle {
+		for id, c := range l.chats {
+			if now.Sub(c.lastUsed) > chatLimiterIdle && !now.Before(c.pausedUntil) {
+				delete(l.chats, id)
+			}
+		}
+		l.lastSweep = now
+	}
+	c, ok := l.chats[chatID]
+	if !ok {
+		// Отрицательные ID у групп, супергрупп и каналов, положительные – у личных чатов.
+		interval := privateChatInterval
+		if chatID < 0 {
+			interval = groupChatInterval
+		}
+		c = &chatLimit{limiter: rate.NewLimiter(rate.Every(interval), 1)}
+		l.chats[chatID] = c
+	}
+	c.lastUsed = now
+	return c
+}
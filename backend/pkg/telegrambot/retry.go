@@ -3,14 +3,23 @@ package telegrambot
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"net/http"
 	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
 )
 
-// retryOperation выполняет указанную операцию с повторными попытками.
+// maxRetryDelay – предел экспоненциальной задержки между попытками.
+const maxRetryDelay = time.Minute
+
+// retryOperation выполняет указанную операцию с повторными попытками и экспоненциальной задержкой,
+// начиная с baseDelay. Если Telegram ответил 429, следующая попытка выполняется не раньше retry_after;
+// запросы, которые Telegram отклонил (400, 403 и т. п.), не повторяются.
 // Если операция завершается успешно, возвращается nil. В противном случае возвращается ошибка после исчерпания попыток.
-func retryOperation(ctx context.Context, operation func() error, maxRetries int, retryDelay time.Duration) error {
+func retryOperation(ctx context.Context, log *zap.Logger, operation func() error, maxRetries int, baseDelay time.Duration) error {
 	var lastErr error
 	for attempt := 0; attempt <= maxRetries; attempt++ {
 		select {
@@ -19,17 +28,54 @@ func retryOperation(ctx context.Context, operation func() error, maxRetries int,
 		default:
 		}
 
-		if err := operation(); err != nil {
-			lastErr = err
-			log.Printf("Attempt %d failed: %v", attempt+1, err)
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case <-time.After(retryDelay):
-			}
-		} else {
+		err := operation()
+		if err == nil {
 			return nil
 		}
+		lastErr = err
+		if permanent(err) || ctx.Err() != nil {
+			return err
+		}
+		if attempt == maxRetries {
+			break
+		}
+
+		delay := backoff(baseDelay, attempt)
+		if d := retryAfter(err); d > 0 {
+			delay = d
+		}
+		log.Warn("Повтор запроса к Telegram", zap.Int("attempt", attempt+1), zap.Duration("delay", delay), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
 	}
 	return fmt.Errorf("operation failed after %d attempts: %w", maxRetries+1, lastErr)
 }
+
+// backoff возвращает задержку перед повтором номер attempt (с нуля): baseDelay, удваиваемую
+// с каждой попыткой, но не больше maxRetryDelay.
+func backoff(baseDelay time.Duration, attempt int) time.Duration {
+	d := baseDelay << uint(attempt)
+	if d <= 0 || d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	return d
+}
+
+// retryAfter возвращает время, которое Telegram попросил выждать перед повтором (ответ 429), или 0.
+func retryAfter(err error) time.Duration {
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		return time.Duration(apiErr.RetryAfter) * time.Second
+	}
+	return 0
+}
+
+// permanent сообщает, что повтор бессмыслен: Telegram отклонил сам запрос (4xx, кроме 429) –
+// например, текст с ошибкой разметки или бот заблокирован пользователем.
+func permanent(err error) bool {
+	var apiErr *tgbotapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code >= 400 && apiErr.Code < 500 && apiErr.Code != http.StatusTooManyRequests
+}
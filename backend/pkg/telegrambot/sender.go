@@ -6,23 +6,28 @@ import (
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
 )
 
-// telegramSender реализует интерфейс BotSender.
+// telegramSender реализует интерфейс BotSender: отправляет запросы сразу, соблюдая лимиты Telegram.
 type telegramSender struct {
 	bot        *tgbotapi.BotAPI
 	chatID     int64
 	maxRetries int
 	retryDelay time.Duration
+	limiter    *sendLimiter
+	log        *zap.Logger
 }
 
 // newTelegramSender создаёт нового отправщика.
-func newTelegramSender(bot *tgbotapi.BotAPI, chatID int64, maxRetries int, retryDelay time.Duration) *telegramSender {
+func newTelegramSender(bot *tgbotapi.BotAPI, chatID int64, maxRetries int, retryDelay time.Duration, log *zap.Logger) *telegramSender {
 	return &telegramSender{
 		bot:        bot,
 		chatID:     chatID,
 		maxRetries: maxRetries,
 		retryDelay: retryDelay,
+		limiter:    newSendLimiter(),
+		log:        log,
 	}
 }
 
@@ -33,23 +38,85 @@ func (ts *telegramSender) ChatID() int64 {
 
 // SendMessage отправляет текстовое сообщение, используя механизм повторных попыток.
 func (ts *telegramSender) SendMessage(ctx context.Context, chatID int64, text string) error {
-	msg := tgbotapi.NewMessage(chatID, text)
+	return ts.do(ctx, chatID, newTextMessage(chatID, text, ""))
+}
+
+// SendFormatted отправляет сообщение с разметкой parseMode, используя механизм повторных попыток.
+func (ts *telegramSender) SendFormatted(ctx context.Context, chatID int64, text, parseMode string) error {
+	return ts.do(ctx, chatID, newTextMessage(chatID, text, parseMode))
+}
+
+// SendDocument отправляет документ, используя механизм повторных попыток.
+func (ts *telegramSender) SendDocument(ctx context.Context, chatID int64, fileName string, content []byte) error {
+	return ts.do(ctx, chatID, newDocument(chatID, fileName, content))
+}
+
+// SendPage отправляет сообщение с inline-клавиатурой keyboard. Если messageID задан, вместо отправки
+// редактируется существующее сообщение – так листаются страницы результатов.
+func (ts *telegramSender) SendPage(ctx context.Context, chatID int64, messageID int, text string, keyboard [][]tgbotapi.InlineKeyboardButton) error {
+	var msg tgbotapi.Chattable
+	if messageID != 0 {
+		msg = tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, text, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: nonNilKeyboard(keyboard)})
+	} else {
+		m := tgbotapi.NewMessage(chatID, text)
+		if len(keyboard) > 0 {
+			m.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+		}
+		msg = m
+	}
+	return ts.do(ctx, chatID, msg)
+}
+
+// AnswerCallback подтверждает нажатие inline-кнопки; text показывается пользователю всплывающим уведомлением.
+func (ts *telegramSender) AnswerCallback(ctx context.Context, callbackID, text string) error {
 	operation := func() error {
-		_, err := ts.bot.Send(msg)
+		_, err := ts.bot.Request(tgbotapi.NewCallback(callbackID, text))
 		return err
 	}
-	return retryOperation(ctx, operation, ts.maxRetries, ts.retryDelay)
+	return retryOperation(ctx, ts.log, operation, ts.maxRetries, ts.retryDelay)
 }
 
-// SendDocument отправляет документ, используя механизм повторных попыток.
-func (ts *telegramSender) SendDocument(ctx context.Context, chatID int64, fileName string, content []byte) error {
-	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{
+// do отправляет запрос в чат chatID, соблюдая лимиты и используя механизм повторных попыток.
+func (ts *telegramSender) do(ctx context.Context, chatID int64, c tgbotapi.Chattable) error {
+	operation := func() error {
+		if err := ts.limiter.wait(ctx, chatID); err != nil {
+			return err
+		}
+		return ts.request(chatID, c)
+	}
+	return retryOperation(ctx, ts.log, operation, ts.maxRetries, ts.retryDelay)
+}
+
+// request выполняет одну попытку запроса к Telegram без учёта лимитов. Если Telegram ответил 429,
+// отправка в чат chatID приостанавливается на указанное им время.
+func (ts *telegramSender) request(chatID int64, c tgbotapi.Chattable) error {
+	_, err := ts.bot.Request(c)
+	if d := retryAfter(err); d > 0 {
+		ts.limiter.pause(chatID, d)
+	}
+	return err
+}
+
+// newTextMessage создаёт текстовое сообщение; parseMode может быть пустым.
+func newTextMessage(chatID int64, text, parseMode string) tgbotapi.Chattable {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = parseMode
+	msg.DisableWebPagePreview = parseMode != ""
+	return msg
+}
+
+// newDocument создаёт сообщение с файлом fileName.
+func newDocument(chatID int64, fileName string, content []byte) tgbotapi.Chattable {
+	return tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{
 		Name:  fileName,
 		Bytes: content,
 	})
-	operation := func() error {
-		_, err := ts.bot.Send(doc)
-		return err
+}
+
+// nonNilKeyboard заменяет nil пустой клавиатурой: так Telegram убирает кнопки у редактируемого сообщения.
+func nonNilKeyboard(keyboard [][]tgbotapi.InlineKeyboardButton) [][]tgbotapi.InlineKeyboardButton {
+	if keyboard == nil {
+		return [][]tgbotapi.InlineKeyboardButton{}
 	}
-	return retryOperation(ctx, operation, ts.maxRetries, ts.retryDelay)
+	return keyboard
 }
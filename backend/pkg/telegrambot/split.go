@@ -0,0 +1,321 @@
+package telegrambot
+
+import (
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// maxMessageLen – предельная длина текста сообщения Telegram в единицах UTF-16.
+const maxMessageLen = 4096
+
+// splitMessage собирает блоки в сообщения не длиннее limit, разделяя блоки пустой строкой.
+// Блок, который не помещается в одно сообщение, делится по строкам, а строка – между символами
+// так, чтобы не разорвать тег, HTML-сущность или экранированный символ; разметка, открытая
+// в месте разреза, закрывается в конце части и открывается заново в начале следующей.
+func splitMessage(blocks []string, limit int, parseMode string) []string {
+	var parts []string
+	var cur strings.Builder
+	curLen := 0
+	flush := func() {
+		if curLen > 0 {
+			parts = append(parts, cur.String())
+			cur.Reset()
+			curLen = 0
+		}
+	}
+
+	for _, block := range blocks {
+		if block == "" {
+			continue
+		}
+		n := textLen(block)
+		if n > limit {
+			flush()
+			parts = append(parts, splitBlock(block, limit, parseMode)...)
+			continue
+		}
+		if curLen > 0 && curLen+2+n > limit {
+			flush()
+		}
+		if curLen > 0 {
+			cur.WriteString("\n\n")
+			curLen += 2
+		}
+		cur.WriteString(block)
+		curLen += n
+	}
+	flush()
+	return parts
+}
+
+// markupToken – неделимый фрагмент размеченного текста: символ, тег, сущность или маркер разметки.
+type markupToken struct {
+	text  string
+	open  *markupSpan // маркер открывает элемент
+	close string      // маркер закрывает элемент с этим ключом
+}
+
+// markupSpan – открытый элемент разметки и то, как его закрыть и открыть заново.
+type markupSpan struct {
+	key   string
+	open  string
+	close string
+}
+
+// splitBlock делит размеченный блок на части не длиннее limit, по возможности по строкам.
+func splitBlock(block string, limit int, parseMode string) []string {
+	var (
+		parts  []string
+		cur    strings.Builder
+		curLen int
+		stack  []markupSpan
+		// Состояние после последнего перевода строки в текущей части – предпочтительное место разреза.
+		nlPos   = -1
+		nlLen   int
+		nlStack []markupSpan
+		// Длина открывающих маркеров в начале части: часть без другого текста не режется.
+		prefixLen int
+	)
+	start := func(spans []markupSpan, rest string) {
+		// Элементы, которые закрываются в самом начале перенесённого текста, заново не открываются.
+		for len(spans) > 0 && strings.HasPrefix(rest, spans[len(spans)-1].close) {
+			rest = rest[len(spans[len(spans)-1].close):]
+			spans = spans[:len(spans)-1]
+		}
+		cur.Reset()
+		for _, s := range spans {
+			cur.WriteString(s.open)
+		}
+		prefixLen = textLen(cur.String())
+		cur.WriteString(rest)
+		curLen = textLen(cur.String())
+		nlPos = -1
+	}
+	cut := func() {
+		if nlPos >= 0 && nlLen > prefixLen {
+			text := cur.String()
+			parts = append(parts, text[:nlPos]+closers(nlStack))
+			start(nlStack, text[nlPos+1:])
+			return
+		}
+		parts = append(parts, cur.String()+closers(stack))
+		start(stack, "")
+	}
+
+	for _, tok := range tokenizeMarkup(block, parseMode) {
+		next := applyToken(stack, tok)
+		// Элемент, открытый заново в начале части и сразу закрытый, не оставляет пустой разметки.
+		if top := len(stack) - 1; tok.close != "" && curLen == prefixLen && top >= 0 && stack[top].key == tok.close {
+			start(next, "")
+			stack = next
+			continue
+		}
+		n := textLen(tok.text)
+		for curLen+n+textLen(closers(next)) > limit && curLen > prefixLen {
+			before := curLen
+			cut()
+			if curLen >= before {
+				break
+			}
+		}
+		if tok.text == "\n" {
+			nlPos, nlLen, nlStack = cur.Len(), curLen, append([]markupSpan(nil), stack...)
+		}
+		cur.WriteString(tok.text)
+		curLen += n
+		stack = next
+	}
+	if curLen > prefixLen {
+		parts = append(parts, cur.String()+closers(stack))
+	}
+	return parts
+}
+
+// applyToken возвращает открытые элементы после токена.
+func applyToken(stack []markupSpan, tok markupToken) []markupSpan {
+	switch {
+	case tok.open != nil:
+		return append(stack[:len(stack):len(stack)], *tok.open)
+	case tok.close != "":
+		for i := len(stack) - 1; i >= 0; i-- {
+			if stack[i].key == tok.close {
+				next := append([]markupSpan(nil), stack[:i]...)
+				return append(next, stack[i+1:]...)
+			}
+		}
+	}
+	return stack
+}
+
+// closers возвращает закрывающую разметку для открытых элементов.
+func closers(stack []markupSpan) string {
+	var b strings.Builder
+	for i := len(stack) - 1; i >= 0; i-- {
+		b.WriteString(stack[i].close)
+	}
+	return b.String()
+}
+
+// tokenizeMarkup делит текст на неделимые фрагменты с учётом режима разметки.
+func tokenizeMarkup(text, parseMode string) []markupToken {
+	switch parseMode {
+	case ParseModeHTML:
+		return tokenizeHTML(text)
+	case ParseModeMarkdownV2:
+		return tokenizeMarkdownV2(text)
+	}
+	var toks []markupToken
+	for len(text) > 0 {
+		_, size := utf8.DecodeRuneInString(text)
+		toks = append(toks, markupToken{text: text[:size]})
+		text = text[size:]
+	}
+	return toks
+}
+
+func tokenizeHTML(text string) []markupToken {
+	var toks []markupToken
+	for len(text) > 0 {
+		switch text[0] {
+		case '<':
+			if end := strings.IndexByte(text, '>'); end > 0 {
+				tag := text[:end+1]
+				text = text[end+1:]
+				if name, ok := strings.CutPrefix(tag, "</"); ok {
+					toks = append(toks, markupToken{text: tag, close: strings.TrimSuffix(name, ">")})
+					continue
+				}
+				name := strings.FieldsFunc(tag[1:end], func(r rune) bool { return r == ' ' || r == '\t' || r == '\n' })
+				if len(name) == 0 {
+					toks = append(toks, markupToken{text: tag})
+					continue
+				}
+				toks = append(toks, markupToken{text: tag, open: &markupSpan{key: name[0], open: tag, close: "</" + name[0] + ">"}})
+				continue
+			}
+		case '&':
+			if end := strings.IndexByte(text, ';'); end > 0 && end <= 10 && !strings.ContainsAny(text[1:end], " &<") {
+				toks = append(toks, markupToken{text: text[:end+1]})
+				text = text[end+1:]
+				continue
+			}
+		}
+		_, size := utf8.DecodeRuneInString(text)
+		toks = append(toks, markupToken{text: text[:size]})
+		text = text[size:]
+	}
+	return toks
+}
+
+// markdownV2Markers – маркеры MarkdownV2; более длинные проверяются раньше.
+var markdownV2Markers = []string{"```", "||", "__", "`", "*", "_", "~"}
+
+func tokenizeMarkdownV2(text string) []markupToken {
+	var toks []markupToken
+	var open []string // ключи открытых маркеров
+	inCode := func() bool {
+		return len(open) > 0 && (open[len(open)-1] == "`" || open[len(open)-1] == "```")
+	}
+	isOpen := func(key string) bool {
+		for _, k := range open {
+			if k == key {
+				return true
+			}
+		}
+		return false
+	}
+	for len(text) > 0 {
+		if text[0] == '\\' && len(text) > 1 {
+			_, size := utf8.DecodeRuneInString(text[1:])
+			esc := text[:1+size]
+			toks = append(toks, markupToken{text: esc})
+			text = text[len(esc):]
+			continue
+		}
+		if !inCode() && text[0] == '[' {
+			if link, ok := markdownV2Link(text); ok {
+				toks = append(toks, markupToken{text: link})
+				text = text[len(link):]
+				continue
+			}
+		}
+		matched := false
+		for _, m := range markdownV2Markers {
+			if !strings.HasPrefix(text, m) || (inCode() && m != open[len(open)-1]) {
+				continue
+			}
+			matched = true
+			text = text[len(m):]
+			if isOpen(m) {
+				for i := len(open) - 1; i >= 0; i-- {
+					if open[i] == m {
+						open = append(open[:i], open[i+1:]...)
+						break
+					}
+				}
+				toks = append(toks, markupToken{text: m, close: m})
+				break
+			}
+			span := markupSpan{key: m, open: m, close: m}
+			tokText := m
+			if m == "```" {
+				// Язык блока кода (до конца строки) повторяется при открытии блока в следующей части.
+				span.open += "\n"
+				if i := strings.IndexByte(text, '\n'); i >= 0 && !strings.Contains(text[:i], "`") {
+					tokText += text[:i+1]
+					span.open = tokText
+					text = text[i+1:]
+				}
+			}
+			open = append(open, m)
+			toks = append(toks, markupToken{text: tokText, open: &span})
+			break
+		}
+		if matched {
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(text)
+		toks = append(toks, markupToken{text: text[:size]})
+		text = text[size:]
+	}
+	return toks
+}
+
+// markdownV2Link возвращает ссылку [текст](адрес) в начале text: она не делится на части.
+func markdownV2Link(text string) (string, bool) {
+	escaped := false
+	for i := 1; i < len(text); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case text[i] == '\\':
+			escaped = true
+		case text[i] == ']':
+			if i+1 >= len(text) || text[i+1] != '(' {
+				return "", false
+			}
+			for j := i + 2; j < len(text); j++ {
+				switch {
+				case escaped:
+					escaped = false
+				case text[j] == '\\':
+					escaped = true
+				case text[j] == ')':
+					return text[:j+1], true
+				}
+			}
+			return "", false
+		}
+	}
+	return "", false
+}
+
+// textLen возвращает длину текста так, как её считает Telegram, – в единицах UTF-16.
+func textLen(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
@@ -0,0 +1,223 @@
+package telegrambot
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Виды подписок на уведомления.
+const (
+	KindNewContracts = "new_contracts" // новые контракты
+	KindStateChanges = "state_changes" // смена состояния контракта contract_id
+	KindExpiring     = "expiring"      // контракты, заканчивающиеся в ближайшие days дней
+	KindSyncFailures = "sync_failures" // ошибки синхронизации с EAIST
+)
+
+// Kinds – все виды подписок.
+var Kinds = []string{KindNewContracts, KindStateChanges, KindExpiring, KindSyncFailures}
+
+const (
+	// linkCodeTTL – время действия кода привязки.
+	linkCodeTTL = 15 * time.Minute
+	// linkCodeLen – длина кода привязки в байтах.
+	linkCodeLen = 8
+	// maxExpiringDays – наибольший горизонт подписки на окончание контрактов.
+	maxExpiringDays = 365
+)
+
+// ErrLinkCodeInvalid возвращается, если код привязки не найден или истёк.
+var ErrLinkCodeInvalid = errors.New("код привязки не найден или истёк")
+
+// Link – привязка пользователя к чату Telegram.
+type Link struct {
+	UserID   int64     `db:"user_id" json:"user_id"`
+	ChatID   int64     `db:"chat_id" json:"chat_id"`
+	LinkedAt time.Time `db:"linked_at" json:"linked_at"`
+}
+
+// Subscription – подписка пользователя на уведомления вида Kind. ContractID задаётся
+// для state_changes, Days – для expiring.
+type Subscription struct {
+	ID         int64     `db:"id" json:"id"`
+	UserID     int64     `db:"user_id" json:"user_id"`
+	Kind       string    `db:"kind" json:"kind"`
+	ContractID *int64    `db:"contract_id" json:"contract_id,omitempty"`
+	Days       *int      `db:"days" json:"days,omitempty"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
+
+// Validate проверяет вид подписки и обязательные для него параметры.
+func (s *Subscription) Validate() error {
+	switch s.Kind {
+	case KindNewContracts, KindSyncFailures:
+		s.ContractID, s.Days = nil, nil
+	case KindStateChanges:
+		if s.ContractID == nil || *s.ContractID <= 0 {
+			return fmt.Errorf("для подписки %s нужен contract_id", s.Kind)
+		}
+		s.Days = nil
+	case KindExpiring:
+		if s.Days == nil || *s.Days <= 0 || *s.Days > maxExpiringDays {
+			return fmt.Errorf("для подписки %s нужен days от 1 до %d", s.Kind, maxExpiringDays)
+		}
+		s.ContractID = nil
+	default:
+		return fmt.Errorf("неизвестный вид подписки %q", s.Kind)
+	}
+	return nil
+}
+
+// CreateLinkCode создаёт одноразовый код привязки чата к пользователю userID.
+// Прежние коды пользователя удаляются.
+func CreateLinkCode(ctx context.Context, db *sqlx.DB, userID int64) (string, time.Time, error) {
+	b := make([]byte, linkCodeLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, fmt.Errorf("генерация кода привязки: %w", err)
+	}
+	code := hex.EncodeToString(b)
+	expiresAt := time.Now().Add(linkCodeTTL)
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "DELETE FROM telegram_link_codes WHERE user_id=$1", userID); err != nil {
+		return "", time.Time{}, err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO telegram_link_codes (code, user_id, expires_at) VALUES ($1, $2, $3)", code, userID, expiresAt); err != nil {
+		return "", time.Time{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", time.Time{}, err
+	}
+	return code, expiresAt, nil
+}
+
+// LinkChat погашает код привязки и связывает чат chatID с его пользователем. Чат, ранее
+// привязанный к другому пользователю, перепривязывается. Возвращает ID пользователя.
+func LinkChat(ctx context.Context, db *sqlx.DB, code string, chatID int64) (int64, error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	err = tx.GetContext(ctx, &userID, "DELETE FROM telegram_link_codes WHERE code=$1 AND expires_at > now() RETURNING user_id", code)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrLinkCodeInvalid
+	}
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM telegram_links WHERE chat_id=$1 AND user_id<>$2", chatID, userID); err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO telegram_links (user_id, chat_id) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET chat_id = EXCLUDED.chat_id, linked_at = now()`, userID, chatID)
+	if err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
+
+// GetLink возвращает привязку пользователя или nil, если чат не привязан.
+func GetLink(ctx context.Context, db sqlx.QueryerContext, userID int64) (*Link, error) {
+	var link Link
+	err := sqlx.GetContext(ctx, db, &link, "SELECT user_id, chat_id, linked_at FROM telegram_links WHERE user_id=$1", userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// Unlink удаляет привязку пользователя. Подписки сохраняются и снова действуют после новой привязки.
+func Unlink(ctx context.Context, db sqlx.ExecerContext, userID int64) (bool, error) {
+	res, err := db.ExecContext(ctx, "DELETE FROM telegram_links WHERE user_id=$1", userID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ListSubscriptions возвращает подписки пользователя.
+func ListSubscriptions(ctx context.Context, db sqlx.QueryerContext, userID int64) ([]Subscription, error) {
+	subs := []Subscription{}
+	err := sqlx.SelectContext(ctx, db, &subs, "SELECT * FROM telegram_subscriptions WHERE user_id=$1 ORDER BY id", userID)
+	return subs, err
+}
+
+// Subscribe сохраняет подписку. Если такая подписка уже есть, возвращается существующая
+// и created == false.
+func Subscribe(ctx context.Context, db sqlx.QueryerContext, sub Subscription) (result Subscription, created bool, err error) {
+	if err := sub.Validate(); err != nil {
+		return Subscription{}, false, err
+	}
+	err = sqlx.GetContext(ctx, db, &result, `
+		INSERT INTO telegram_subscriptions (user_id, kind, contract_id, days) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, kind, COALESCE(contract_id, 0), COALESCE(days, 0)) DO NOTHING
+		RETURNING *`, sub.UserID, sub.Kind, sub.ContractID, sub.Days)
+	if err == nil {
+		return result, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return Subscription{}, false, err
+	}
+	err = sqlx.GetContext(ctx, db, &result, `
+		SELECT * FROM telegram_subscriptions
+		WHERE user_id=$1 AND kind=$2 AND contract_id IS NOT DISTINCT FROM $3 AND days IS NOT DISTINCT FROM $4`,
+		sub.UserID, sub.Kind, sub.ContractID, sub.Days)
+	return result, false, err
+}
+
+// Unsubscribe удаляет подписку id пользователя userID.
+func Unsubscribe(ctx context.Context, db sqlx.ExecerContext, userID, id int64) (bool, error) {
+	res, err := db.ExecContext(ctx, "DELETE FROM telegram_subscriptions WHERE id=$1 AND user_id=$2", id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// subscribedChats возвращает чаты привязанных пользователей с подпиской вида kind.
+func subscribedChats(ctx context.Context, db sqlx.QueryerContext, kind string) ([]int64, error) {
+	var chats []int64
+	err := sqlx.SelectContext(ctx, db, &chats, `
+		SELECT DISTINCT l.chat_id FROM telegram_subscriptions s
+		JOIN telegram_links l ON l.user_id = s.user_id
+		WHERE s.kind = $1
+		ORDER BY l.chat_id`, kind)
+	return chats, err
+}
+
+// stateSubscription – чат, подписанный на смену состояния контракта.
+type stateSubscription struct {
+	ChatID     int64 `db:"chat_id"`
+	ContractID int64 `db:"contract_id"`
+}
+
+// stateSubscribers возвращает чаты, подписанные на смену состояния контрактов ids.
+func stateSubscribers(ctx context.Context, db sqlx.QueryerContext, ids []int64) ([]stateSubscription, error) {
+	var subs []stateSubscription
+	err := sqlx.SelectContext(ctx, db, &subs, `
+		SELECT DISTINCT l.chat_id, s.contract_id FROM telegram_subscriptions s
+		JOIN telegram_links l ON l.user_id = s.user_id
+		WHERE s.kind = $1 AND s.contract_id = ANY($2)
+		ORDER BY l.chat_id, s.contract_id`, KindStateChanges, pq.Int64Array(ids))
+	return subs, err
+}
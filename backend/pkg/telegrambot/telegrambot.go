@@ -8,6 +8,8 @@ import (
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
 )
 
 // BotSender определяет интерфейс отправки сообщений и документов.
@@ -16,43 +18,185 @@ type BotSender interface {
 	ChatID() int64
 	// SendMessage отправляет текстовое сообщение.
 	SendMessage(ctx context.Context, chatID int64, text string) error
+	// SendFormatted отправляет сообщение с разметкой parseMode (HTML или MarkdownV2).
+	SendFormatted(ctx context.Context, chatID int64, text, parseMode string) error
 	// SendDocument отправляет документ с указанным именем и содержимым.
 	SendDocument(ctx context.Context, chatID int64, fileName string, content []byte) error
+	// SendPage отправляет сообщение с inline-клавиатурой или, если задан messageID, редактирует его.
+	SendPage(ctx context.Context, chatID int64, messageID int, text string, keyboard [][]tgbotapi.InlineKeyboardButton) error
+	// AnswerCallback подтверждает нажатие inline-кнопки.
+	AnswerCallback(ctx context.Context, callbackID, text string) error
 }
 
 // TelegramBot – обёртка для отправки уведомлений через Telegram, теперь также включает возможность обработки команд.
 type TelegramBot struct {
 	sender BotSender
 	botAPI *tgbotapi.BotAPI // для обработки входящих обновлений (команд)
+	direct *telegramSender  // непосредственная отправка с соблюдением лимитов Telegram
+	queue  *messageQueue    // постоянная очередь сообщений, если задана WithQueue
+
+	renderer        *Renderer
+	digestThreshold int    // начиная с какого числа контрактов вместо сообщений отправляется дайджест
+	digestFormat    string // формат вложения дайджеста: csv или xlsx
 }
 
+// Настройки дайджеста по умолчанию.
+const (
+	defaultDigestThreshold = 20
+	defaultDigestFormat    = DigestFormatXLSX
+)
+
 // NewTelegramBot создаёт экземпляр TelegramBot, инициализируя внутреннего отправщика.
-func NewTelegramBot(token string, chatID int64, maxRetries int, retryDelay time.Duration) (*TelegramBot, error) {
+// Повторы запросов начинаются с задержки retryDelay, которая удваивается с каждой попыткой.
+func NewTelegramBot(token string, chatID int64, maxRetries int, retryDelay time.Duration, log *zap.Logger) (*TelegramBot, error) {
 	bot, err := newBotAPI(token)
 	if err != nil {
 		return nil, fmt.Errorf("error initializing Telegram bot: %w", err)
 	}
-	sender := newTelegramSender(bot, chatID, maxRetries, retryDelay)
+	sender := newTelegramSender(bot, chatID, maxRetries, retryDelay, log)
+	renderer, err := NewRenderer(ParseModeHTML, "")
+	if err != nil {
+		return nil, err
+	}
 	return &TelegramBot{
-		sender: sender,
-		botAPI: bot,
+		sender:          sender,
+		botAPI:          bot,
+		direct:          sender,
+		renderer:        renderer,
+		digestThreshold: defaultDigestThreshold,
+		digestFormat:    defaultDigestFormat,
 	}, nil
 }
 
-// Notify отправляет текстовое сообщение для уведомлений или ошибок.
+// WithQueue направляет сообщения и документы через постоянную очередь telegram_queue: они переживают
+// перезапуск сервиса и отправляются обработчиком RunQueue. interval – период проверки отложенных сообщений,
+// retention – срок хранения сообщений, которые не удалось отправить (0 – бессрочно).
+func (tb *TelegramBot) WithQueue(db *sqlx.DB, interval, retention time.Duration) *TelegramBot {
+	tb.queue = newMessageQueue(tb.direct, tb.direct, tb.direct.limiter, db, tb.direct.log, interval)
+	tb.queue.retention = retention
+	tb.sender = tb.queue
+	return tb
+}
+
+// RunQueue отправляет сообщения из очереди до отмены контекста; без WithQueue сразу возвращается.
+func (tb *TelegramBot) RunQueue(ctx context.Context) {
+	if tb.queue != nil {
+		tb.queue.Run(ctx)
+	}
+}
+
+// WithRenderer задаёт шаблоны и режим разметки сообщений.
+func (tb *TelegramBot) WithRenderer(r *Renderer) *TelegramBot {
+	tb.renderer = r
+	return tb
+}
+
+// WithDigest задаёт, начиная с какого числа новых и изменённых контрактов вместо отдельных
+// сообщений отправляется дайджест, и формат его вложения. threshold <= 0 отключает дайджест.
+func (tb *TelegramBot) WithDigest(threshold int, format string) *TelegramBot {
+	tb.digestThreshold = threshold
+	tb.digestFormat = format
+	return tb
+}
+
+// Notify отправляет текстовое сообщение для уведомлений или ошибок в общий чат, если он задан.
 func (tb *TelegramBot) Notify(ctx context.Context, message string) error {
+	if tb.sender.ChatID() == 0 {
+		return nil
+	}
 	return tb.sender.SendMessage(ctx, tb.sender.ChatID(), message)
 }
 
+// ChatID возвращает идентификатор общего чата уведомлений; 0, если общий чат не задан.
+func (tb *TelegramBot) ChatID() int64 {
+	return tb.sender.ChatID()
+}
+
+// SendTo отправляет текстовое сообщение в чат chatID.
+func (tb *TelegramBot) SendTo(ctx context.Context, chatID int64, text string) error {
+	return tb.sender.SendMessage(ctx, chatID, text)
+}
+
+// SendTemplate формирует по шаблону name сообщение для каждого из items и отправляет их в чат chatID,
+// объединяя в сообщения не длиннее предела Telegram.
+func (tb *TelegramBot) SendTemplate(ctx context.Context, chatID int64, name string, items ...interface{}) error {
+	blocks := make([]string, 0, len(items))
+	for _, item := range items {
+		text, err := tb.renderer.Render(name, item)
+		if err != nil {
+			return err
+		}
+		blocks = append(blocks, text)
+	}
+	return tb.sendBlocks(ctx, chatID, blocks)
+}
+
+// SendContracts сообщает в чат chatID о новых и изменённых контрактах. Если их больше порога
+// дайджеста, вместо отдельных сообщений отправляется дайджест с таблицей контрактов во вложении.
+func (tb *TelegramBot) SendContracts(ctx context.Context, chatID int64, created []map[string]interface{}, updated []ContractMessage) error {
+	total := len(created) + len(updated)
+	if total == 0 {
+		return nil
+	}
+	if tb.digestThreshold > 0 && total > tb.digestThreshold {
+		return tb.sendDigest(ctx, chatID, created, updated)
+	}
+	items := make([]interface{}, 0, len(created))
+	for _, c := range created {
+		items = append(items, ContractMessage{ID: contractID(c), Contract: c})
+	}
+	if err := tb.SendTemplate(ctx, chatID, TemplateContractCreated, items...); err != nil {
+		return err
+	}
+	items = items[:0]
+	for _, u := range updated {
+		items = append(items, u)
+	}
+	return tb.SendTemplate(ctx, chatID, TemplateContractUpdated, items...)
+}
+
+// sendDigest отправляет дайджест и вложение contracts_<дата>.<формат>.
+func (tb *TelegramBot) sendDigest(ctx context.Context, chatID int64, created []map[string]interface{}, updated []ContractMessage) error {
+	now := time.Now()
+	fileName := fmt.Sprintf("contracts_%s.%s", now.Format("2006-01-02"), tb.digestFormat)
+	content, err := digestFile(tb.digestFormat, digestRows(created, updated))
+	if err != nil {
+		return err
+	}
+	err = tb.SendTemplate(ctx, chatID, TemplateDigest, DigestMessage{
+		Date:     now,
+		Created:  len(created),
+		Updated:  len(updated),
+		FileName: fileName,
+	})
+	if err != nil {
+		return err
+	}
+	return tb.sender.SendDocument(ctx, chatID, fileName, content)
+}
+
+// sendBlocks отправляет размеченные блоки, разбивая их на сообщения не длиннее maxMessageLen.
+func (tb *TelegramBot) sendBlocks(ctx context.Context, chatID int64, blocks []string) error {
+	for _, part := range splitMessage(blocks, maxMessageLen, tb.renderer.ParseMode()) {
+		if err := tb.sender.SendFormatted(ctx, chatID, part, tb.renderer.ParseMode()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // SendJSONDocument сериализует структуру в JSON и отправляет её как документ
 // с дефолтным именем файла "document.json".
 func (tb *TelegramBot) SendJSONDocument(ctx context.Context, document interface{}) error {
 	return tb.SendJSONDocumentWithName(ctx, document, "document.json")
 }
 
-// SendJSONDocumentWithName сериализует структуру в JSON и отправляет её как документ,
-// используя указанное имя файла.
+// SendJSONDocumentWithName сериализует структуру в JSON и отправляет её в общий чат как документ,
+// используя указанное имя файла. Без общего чата документ не отправляется.
 func (tb *TelegramBot) SendJSONDocumentWithName(ctx context.Context, document interface{}, fileName string) error {
+	if tb.sender.ChatID() == 0 {
+		return nil
+	}
 	jsonData, err := json.MarshalIndent(document, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal document into JSON: %w", err)
@@ -0,0 +1,318 @@
+package telegrambot
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/ryantrue/EaistSync/pkg/events"
+)
+
+// Режимы разметки сообщений Telegram.
+const (
+	ParseModeHTML       = tgbotapi.ModeHTML
+	ParseModeMarkdownV2 = tgbotapi.ModeMarkdownV2
+)
+
+// Шаблоны сообщений. Файл шаблона называется по виду сообщения: contract_created.tmpl и т. д.
+const (
+	TemplateContractCreated      = "contract_created"       // новый контракт; данные ContractMessage
+	TemplateContractUpdated      = "contract_updated"       // изменённый контракт; данные ContractMessage
+	TemplateContractStateChanged = "contract_state_changed" // смена состояния; данные StateChangeMessage
+	TemplateContractExpiring     = "contract_expiring"      // скорое окончание; данные ExpiringMessage
+	TemplateContractsRemoved     = "contracts_removed"      // контракты пропали из EAIST; данные RemovedMessage
+	TemplateSyncFailed           = "sync_failed"            // ошибка синхронизации; данные SyncFailedMessage
+	TemplateDigest               = "digest"                 // дайджест с вложением; данные DigestMessage
+)
+
+// TemplateNames – все шаблоны сообщений.
+var TemplateNames = []string{
+	TemplateContractCreated,
+	TemplateContractUpdated,
+	TemplateContractStateChanged,
+	TemplateContractExpiring,
+	TemplateContractsRemoved,
+	TemplateSyncFailed,
+	TemplateDigest,
+}
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// maxValueLen – длина, до которой сокращаются значения полей в сообщениях.
+const maxValueLen = 200
+
+// ContractMessage – данные шаблонов contract_created и contract_updated.
+type ContractMessage struct {
+	ID       int64
+	Contract map[string]interface{}
+	Changes  map[string]events.FieldChange // только для contract_updated
+}
+
+// StateChangeMessage – данные шаблона contract_state_changed.
+type StateChangeMessage struct {
+	ContractID      int64
+	PreviousStateID interface{}
+	StateID         interface{}
+	PreviousState   string // наименование прежнего состояния, если известно
+	State           string // наименование нового состояния, если известно
+}
+
+// ExpiringMessage – данные шаблона contract_expiring.
+type ExpiringMessage struct {
+	ID             int64
+	ContractNumber string
+	Name           string
+	EndDate        time.Time
+}
+
+// RemovedMessage – данные шаблона contracts_removed.
+type RemovedMessage struct {
+	IDs []int64
+}
+
+// SyncFailedMessage – данные шаблона sync_failed.
+type SyncFailedMessage struct {
+	Error    string
+	Trigger  string        // источник запуска: startup, schedule или telegram
+	Duration time.Duration // продолжительность неудачного запуска
+}
+
+// DigestMessage – данные шаблона digest.
+type DigestMessage struct {
+	Date     time.Time
+	Created  int
+	Updated  int
+	FileName string
+}
+
+// markup – уже размеченный и экранированный текст, который не экранируется повторно.
+type markup string
+
+// Renderer формирует сообщения по шаблонам text/template. Текст шаблонов и подставляемые значения
+// экранируются для режима разметки автоматически, поэтому шаблоны не зависят от режима;
+// оформление задаётся функциями bold, italic, code и link.
+type Renderer struct {
+	parseMode string
+	templates map[string]*template.Template
+}
+
+// NewRenderer загружает встроенные шаблоны и заменяет их файлами <вид>.tmpl из dir, если dir задан.
+func NewRenderer(parseMode, dir string) (*Renderer, error) {
+	if parseMode != ParseModeHTML && parseMode != ParseModeMarkdownV2 {
+		return nil, fmt.Errorf("неподдерживаемый режим разметки %q", parseMode)
+	}
+	r := &Renderer{parseMode: parseMode, templates: make(map[string]*template.Template, len(TemplateNames))}
+	for _, name := range TemplateNames {
+		text, err := fs.ReadFile(defaultTemplates, "templates/"+name+".tmpl")
+		if err != nil {
+			return nil, fmt.Errorf("встроенный шаблон %s: %w", name, err)
+		}
+		if dir != "" {
+			custom, err := os.ReadFile(filepath.Join(dir, name+".tmpl"))
+			switch {
+			case err == nil:
+				text = custom
+			case !errors.Is(err, fs.ErrNotExist):
+				return nil, fmt.Errorf("шаблон %s: %w", name, err)
+			}
+		}
+		tmpl, err := template.New(name).Funcs(r.funcs()).Parse(string(text))
+		if err != nil {
+			return nil, fmt.Errorf("шаблон %s: %w", name, err)
+		}
+		for _, t := range tmpl.Templates() {
+			if t.Tree != nil {
+				r.escapeList(t.Tree.Root)
+			}
+		}
+		r.templates[name] = tmpl
+	}
+	return r, nil
+}
+
+// ParseMode возвращает режим разметки сообщений.
+func (r *Renderer) ParseMode() string {
+	return r.parseMode
+}
+
+// Render формирует сообщение по шаблону name.
+func (r *Renderer) Render(name string, data interface{}) (string, error) {
+	tmpl, ok := r.templates[name]
+	if !ok {
+		return "", fmt.Errorf("неизвестный шаблон %q", name)
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("шаблон %s: %w", name, err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// escapeList экранирует текст шаблона и добавляет экранирование к выводу каждого действия –
+// так же, как html/template дополняет конвейеры своими функциями.
+func (r *Renderer) escapeList(list *parse.ListNode) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.TextNode:
+			n.Text = []byte(r.escape(string(n.Text)))
+		case *parse.ActionNode:
+			if len(n.Pipe.Decl) == 0 {
+				n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+					NodeType: parse.NodeCommand,
+					Pos:      n.Pos,
+					Args:     []parse.Node{parse.NewIdentifier("esc").SetPos(n.Pos)},
+				})
+			}
+		case *parse.IfNode:
+			r.escapeList(n.List)
+			r.escapeList(n.ElseList)
+		case *parse.RangeNode:
+			r.escapeList(n.List)
+			r.escapeList(n.ElseList)
+		case *parse.WithNode:
+			r.escapeList(n.List)
+			r.escapeList(n.ElseList)
+		}
+	}
+}
+
+// funcs возвращает функции шаблонов.
+func (r *Renderer) funcs() template.FuncMap {
+	return template.FuncMap{
+		"esc":    r.esc,
+		"raw":    func(s string) markup { return markup(s) },
+		"bold":   func(v interface{}) markup { return r.wrap("<b>", "</b>", "*", "*", v) },
+		"italic": func(v interface{}) markup { return r.wrap("<i>", "</i>", "_", "_", v) },
+		"code":   func(v interface{}) markup { return r.wrap("<code>", "</code>", "`", "`", v) },
+		"link":   r.link,
+		"value":  formatValue,
+		"date":   formatDateValue,
+		"money":  formatMoney,
+		"title":  contractTitle,
+		"label":  contractLabel,
+		"join":   joinIDs,
+	}
+}
+
+// esc экранирует значение для режима разметки; уже размеченный текст возвращается как есть.
+func (r *Renderer) esc(v interface{}) markup {
+	if m, ok := v.(markup); ok {
+		return m
+	}
+	return markup(r.escape(formatValue(v)))
+}
+
+// Экранирование для режимов разметки; в MarkdownV2 экранируется и сам обратный слеш.
+var (
+	htmlEscaper       = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	markdownV2Escaper = strings.NewReplacer(
+		`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`, "~", `\~`, "`", "\\`",
+		">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`, "|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`)
+)
+
+func (r *Renderer) escape(s string) string {
+	if r.parseMode == ParseModeHTML {
+		return htmlEscaper.Replace(s)
+	}
+	return markdownV2Escaper.Replace(s)
+}
+
+func (r *Renderer) wrap(htmlOpen, htmlClose, mdOpen, mdClose string, v interface{}) markup {
+	if r.parseMode == ParseModeHTML {
+		return markup(htmlOpen) + r.esc(v) + markup(htmlClose)
+	}
+	return markup(mdOpen) + r.esc(v) + markup(mdClose)
+}
+
+func (r *Renderer) link(url string, text interface{}) markup {
+	if r.parseMode == ParseModeHTML {
+		return markup(`<a href="`+strings.ReplaceAll(r.escape(url), `"`, "&quot;")+`">`) + r.esc(text) + "</a>"
+	}
+	return "[" + r.esc(text) + "](" + markup(strings.NewReplacer(`\`, `\\`, `)`, `\)`).Replace(url)) + ")"
+}
+
+// formatValue форматирует значение поля: числа без экспоненты, составные значения – в JSON;
+// длинные значения сокращаются.
+func formatValue(v interface{}) string {
+	var s string
+	switch x := v.(type) {
+	case nil:
+		return "—"
+	case markup:
+		return string(x)
+	case string:
+		s = x
+	case float64:
+		s = strconv.FormatFloat(x, 'f', -1, 64)
+	case time.Time:
+		s = x.Format("02.01.2006 15:04")
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(x)
+		s = string(b)
+	default:
+		s = fmt.Sprint(x)
+	}
+	if utf8.RuneCountInString(s) > maxValueLen {
+		s = string([]rune(s)[:maxValueLen]) + "…"
+	}
+	return s
+}
+
+// formatDateValue форматирует дату EAIST вида 2024-12-31T00:00:00 или time.Time как 31.12.2024.
+func formatDateValue(v interface{}) string {
+	switch x := v.(type) {
+	case time.Time:
+		return x.Format("02.01.2006")
+	case string:
+		return formatDate(x)
+	}
+	return formatValue(v)
+}
+
+// formatMoney форматирует сумму с разделением разрядов: 152340.5 → 152 340,50.
+func formatMoney(v interface{}) string {
+	f, ok := v.(float64)
+	if !ok {
+		return formatValue(v)
+	}
+	s := strconv.FormatFloat(f, 'f', 2, 64)
+	intPart, frac, _ := strings.Cut(s, ".")
+	sign := ""
+	if strings.HasPrefix(intPart, "-") {
+		sign, intPart = "-", intPart[1:]
+	}
+	var b strings.Builder
+	for i, d := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteRune(' ')
+		}
+		b.WriteRune(d)
+	}
+	return sign + b.String() + "," + frac
+}
+
+// joinIDs перечисляет идентификаторы через запятую.
+func joinIDs(ids []int64) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(parts, ", ")
+}
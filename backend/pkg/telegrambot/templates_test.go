@@ -0,0 +1,229 @@
+package telegrambot
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ryantrue/EaistSync/pkg/events"
+)
+
+var testContract = map[string]interface{}{
+	"id":             float64(42),
+	"contractNumber": "0373-1",
+	"name":           "Поставка <бумаги> & картриджей_A4",
+	"customerName":   "ГБУ «Школа»",
+	"price":          152340.5,
+	"endDate":        "2024-12-31T00:00:00",
+}
+
+func TestRenderContractCreated(t *testing.T) {
+	cases := []struct {
+		parseMode string
+		want      []string
+	}{
+		{ParseModeHTML, []string{
+			"<b>Новый контракт</b> № 0373-1 (42): Поставка &lt;бумаги&gt; &amp; картриджей_A4",
+			"Цена: 152 340,50",
+			"Окончание: 31.12.2024",
+		}},
+		{ParseModeMarkdownV2, []string{
+			`*Новый контракт* № 0373\-1 \(42\): Поставка <бумаги\> & картриджей\_A4`,
+			`Цена: 152 340,50`,
+			`Окончание: 31\.12\.2024`,
+		}},
+	}
+	for _, c := range cases {
+		r, err := NewRenderer(c.parseMode, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		text, err := r.Render(TemplateContractCreated, ContractMessage{ID: 42, Contract: testContract})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range c.want {
+			if !strings.Contains(text, want) {
+				t.Errorf("%s: %q не содержит %q", c.parseMode, text, want)
+			}
+		}
+		if strings.Contains(text, "Поставщик") {
+			t.Errorf("%s: пустое поле не должно выводиться: %q", c.parseMode, text)
+		}
+	}
+}
+
+func TestRenderContractUpdated(t *testing.T) {
+	r, err := NewRenderer(ParseModeHTML, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := r.Render(TemplateContractUpdated, ContractMessage{
+		ID:       42,
+		Contract: testContract,
+		Changes:  map[string]events.FieldChange{"price": {Old: 100.0, New: 152340.5}, "stateId": {Old: nil, New: 3.0}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<b>Изменён контракт</b> № 0373-1 (42): Поставка &lt;бумаги&gt; &amp; картриджей_A4\nprice: 100 → 152340.5\nstateId: — → 3"
+	if text != want {
+		t.Fatalf("Render = %q, want %q", text, want)
+	}
+}
+
+func TestRendererTemplatesDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "contracts_removed.tmpl"), []byte("Удалены: {{join .IDs}}. {{code \"v1.0\"}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewRenderer(ParseModeMarkdownV2, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := r.Render(TemplateContractsRemoved, RemovedMessage{IDs: []int64{1, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Удалены: 1, 2\\. `v1\\.0`"; text != want {
+		t.Fatalf("Render = %q, want %q", text, want)
+	}
+	// Остальные шаблоны остаются встроенными.
+	if _, err := r.Render(TemplateSyncFailed, SyncFailedMessage{Error: "timeout"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewRenderer("Markdown", ""); err == nil {
+		t.Fatal("устаревший режим Markdown должен отклоняться")
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	block := strings.Repeat("я", 3000)
+	parts := splitMessage([]string{block, block, "хвост"}, maxMessageLen, ParseModeHTML)
+	if len(parts) != 2 || parts[0] != block || parts[1] != block+"\n\nхвост" {
+		t.Fatalf("splitMessage: %d частей", len(parts))
+	}
+
+	long := strings.Repeat("строка\n", 1000) + strings.Repeat("😀", 3000)
+	parts = splitMessage([]string{long}, maxMessageLen, ParseModeHTML)
+	var total int
+	for _, p := range parts {
+		if n := textLen(p); n > maxMessageLen {
+			t.Fatalf("часть длиной %d превышает предел", n)
+		}
+		total += strings.Count(p, "😀")
+	}
+	if total != 3000 {
+		t.Fatalf("потеряны символы: %d", total)
+	}
+}
+
+func TestSplitMessageKeepsMarkup(t *testing.T) {
+	const limit = 60
+	htmlBlock := "<b>Изменения:\n" + strings.Repeat("цена &amp; срок &lt;важно&gt;\n", 10) + "</b>" +
+		"<pre>" + strings.Repeat("x", 150) + "</pre>"
+	parts := splitMessage([]string{htmlBlock}, limit, ParseModeHTML)
+	if len(parts) < 2 {
+		t.Fatalf("блок не разделён: %q", parts)
+	}
+	var text strings.Builder
+	for _, p := range parts {
+		if n := textLen(p); n > limit {
+			t.Fatalf("часть длиной %d превышает предел: %q", n, p)
+		}
+		for _, tag := range []string{"b", "pre"} {
+			if strings.Count(p, "<"+tag+">") != strings.Count(p, "</"+tag+">") {
+				t.Fatalf("несбалансированный тег %s в части %q", tag, p)
+			}
+		}
+		for _, piece := range strings.Split(p, "&")[1:] {
+			if !strings.HasPrefix(piece, "amp;") && !strings.HasPrefix(piece, "lt;") && !strings.HasPrefix(piece, "gt;") {
+				t.Fatalf("разорвана HTML-сущность в части %q", p)
+			}
+		}
+		text.WriteString(strings.NewReplacer("<b>", "", "</b>", "", "<pre>", "", "</pre>", "").Replace(p))
+	}
+	if got := strings.Count(text.String(), "x"); got != 150 {
+		t.Fatalf("потеряны символы блока кода: %d", got)
+	}
+
+	mdBlock := "*" + strings.Repeat(`сумма 1\.5 \* 2 `, 10) + "*\n```go\n" + strings.Repeat("fmt.Println()\n", 8) + "```"
+	for _, p := range splitMessage([]string{mdBlock}, limit, ParseModeMarkdownV2) {
+		if n := textLen(p); n > limit {
+			t.Fatalf("часть длиной %d превышает предел: %q", n, p)
+		}
+		if strings.HasSuffix(strings.TrimSuffix(strings.TrimSuffix(p, "```"), "*"), `\`) {
+			t.Fatalf("разорван экранированный символ в части %q", p)
+		}
+		unescaped := strings.ReplaceAll(p, `\*`, "")
+		if code := strings.Count(unescaped, "```"); code%2 != 0 {
+			t.Fatalf("незакрытый блок кода в части %q", p)
+		} else if code == 0 && strings.Count(unescaped, "*")%2 != 0 {
+			t.Fatalf("незакрытое выделение в части %q", p)
+		}
+	}
+}
+
+func TestSendContractsDigest(t *testing.T) {
+	sender := &fakeSender{chatID: 100}
+	bot := newTestBot(t, sender).WithDigest(1, DigestFormatCSV)
+	updated := []ContractMessage{{ID: 7, Changes: map[string]events.FieldChange{"price": {Old: 1.0, New: 2.0}}}}
+
+	if err := bot.SendContracts(context.Background(), 100, []map[string]interface{}{testContract}, updated); err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.messages[100]) != 1 || !strings.Contains(sender.messages[100][0], "Новых контрактов: 1\nИзменённых контрактов: 1") {
+		t.Fatalf("сообщения: %q", sender.messages[100])
+	}
+	if len(sender.documents) != 1 || !strings.HasSuffix(sender.documents[0], ".csv") {
+		t.Fatalf("вложения: %q", sender.documents)
+	}
+}
+
+func TestDigestFiles(t *testing.T) {
+	rows := digestRows([]map[string]interface{}{testContract}, nil)
+
+	csvData, err := digestFile(DigestFormatCSV, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimPrefix(string(csvData), "\uFEFF"), "\r\n")
+	if want := `Новый;42;0373-1;;Поставка <бумаги> & картриджей_A4;ГБУ «Школа»;;;152340,5;31.12.2024;`; lines[1] != want {
+		t.Fatalf("CSV: %q, want %q", lines[1], want)
+	}
+
+	xlsxData, err := digestFile(DigestFormatXLSX, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(xlsxData), int64(len(xlsxData)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sheet string
+	for _, f := range zr.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := io.ReadAll(rc)
+			rc.Close()
+			sheet = string(b)
+		}
+	}
+	for _, want := range []string{`<c r="B2"><v>42</v></c>`, "Поставка &lt;бумаги&gt; &amp; картриджей_A4", `<c r="I2"><v>152340.5</v></c>`} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("лист не содержит %q", want)
+		}
+	}
+	if _, err := digestFile("pdf", rows); err == nil {
+		t.Fatal("неизвестный формат должен отклоняться")
+	}
+}
@@ -10,9 +10,14 @@ import (
 // Поддерживаются типы: int, int64, float64, string (строка парсится как десятичное число).
 // При отсутствии поля "id" или неподдерживаемом типе возвращается ошибка.
 func ExtractID(item map[string]interface{}) (int64, error) {
-	raw, ok := item["id"]
+	return ExtractIDField(item, "id")
+}
+
+// ExtractIDField извлекает числовой идентификатор из поля field элемента по тем же правилам, что и ExtractID.
+func ExtractIDField(item map[string]interface{}, field string) (int64, error) {
+	raw, ok := item[field]
 	if !ok {
-		return 0, fmt.Errorf("ключ 'id' не найден")
+		return 0, fmt.Errorf("ключ '%s' не найден", field)
 	}
 
 	// Преобразование значения в int64 с использованием пакета cast
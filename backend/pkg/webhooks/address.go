@@ -0,0 +1,98 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// errForbiddenAddress возвращается для адресов webhook во внутренних сетях: иначе подпиской
+// можно было бы обращаться от имени сервиса к его окружению (SSRF).
+var errForbiddenAddress = errors.New("адрес webhook указывает на внутреннюю сеть")
+
+// reservedNets – диапазоны, не покрытые методами net.IP, но недоступные из интернета.
+var reservedNets = mustParseCIDRs("0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "198.18.0.0/15")
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// forbiddenIP сообщает, что адрес относится к loopback, частной, link-local или иной внутренней сети.
+func forbiddenIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	for _, n := range reservedNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkHost разрешает имя хоста и отклоняет его, если хотя бы один из адресов внутренний.
+func checkHost(ctx context.Context, host string) error {
+	if ip := net.ParseIP(host); ip != nil {
+		if forbiddenIP(ip) {
+			return errForbiddenAddress
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("не удалось разрешить адрес webhook %q: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if forbiddenIP(addr.IP) {
+			return errForbiddenAddress
+		}
+	}
+	return nil
+}
+
+// newDeliveryClient создаёт HTTP-клиент доставок. Перенаправления не выполняются, а если
+// allowPrivate не задан, соединения с внутренними адресами отклоняются в момент подключения:
+// проверка при создании подписки не спасает от DNS, который позже начнёт отвечать другим адресом.
+func newDeliveryClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || forbiddenIP(ip) {
+				return errForbiddenAddress
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Timeout: defaultDeliveryTimeout,
+		Transport: &http.Transport{
+			// Прокси из окружения не используется: через него адрес получателя не проверить.
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
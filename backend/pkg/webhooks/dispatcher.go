@@ -0,0 +1,252 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultDispatchInterval = 5 * time.Second
+	defaultDeliveryTimeout  = 10 * time.Second
+	defaultMaxAttempts      = 10
+	dispatchBatchSize       = 50
+	deliveryBaseDelay       = 10 * time.Second
+	deliveryMaxDelay        = time.Hour
+	// deliveryLease – на сколько захваченная доставка скрывается от других обработчиков;
+	// больше времени отправки целого пакета (dispatchBatchSize × defaultDeliveryTimeout).
+	deliveryLease = 10 * time.Minute
+	// purgeInterval – как часто удаляются завершённые доставки старше срока хранения.
+	purgeInterval = time.Hour
+)
+
+// pendingDelivery – доставка, готовая к отправке, с адресом и секретом подписки.
+type pendingDelivery struct {
+	ID        int64  `db:"id"`
+	EventType string `db:"event_type"`
+	Payload   []byte `db:"payload"`
+	Attempts  int    `db:"attempts"`
+	URL       string `db:"url"`
+	Secret    string `db:"secret"`
+}
+
+// Dispatcher отправляет доставки из очереди. Неуспешная доставка повторяется с экспоненциальной
+// задержкой; после maxAttempts попыток она помечается failed и может быть отправлена вручную.
+// Адреса во внутренних сетях отклоняются при подключении, перенаправления не выполняются.
+type Dispatcher struct {
+	db          *sqlx.DB
+	client      *http.Client
+	logger      *zap.Logger
+	interval    time.Duration
+	maxAttempts int
+	retention   time.Duration
+	lastPurge   time.Time
+}
+
+// NewDispatcher создаёт Dispatcher, проверяющий очередь каждые interval (по умолчанию 5 секунд).
+func NewDispatcher(db *sqlx.DB, logger *zap.Logger, interval time.Duration) *Dispatcher {
+	if interval <= 0 {
+		interval = defaultDispatchInterval
+	}
+	return &Dispatcher{
+		db:          db,
+		client:      newDeliveryClient(false),
+		logger:      logger,
+		interval:    interval,
+		maxAttempts: defaultMaxAttempts,
+	}
+}
+
+// WithPrivateNetworks разрешает доставку на адреса во внутренних сетях (для разработки и тестов).
+func (d *Dispatcher) WithPrivateNetworks(allow bool) *Dispatcher {
+	d.client = newDeliveryClient(allow)
+	return d
+}
+
+// WithRetention задаёт, сколько хранятся доставленные и окончательно неудавшиеся доставки
+// вместе с журналом попыток; 0 – хранить бессрочно.
+func (d *Dispatcher) WithRetention(retention time.Duration) *Dispatcher {
+	d.retention = retention
+	return d
+}
+
+// Run отправляет доставки до отмены контекста.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		d.purge(ctx)
+		for {
+			processed, err := d.Flush(ctx)
+			if err != nil {
+				d.logger.Warn("Ошибка обработки очереди webhook", zap.Error(err))
+			}
+			if err != nil || processed < dispatchBatchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush отправляет один пакет готовых доставок и возвращает число обработанных.
+// Доставки захватываются коротким запросом, который откладывает их на deliveryLease, и
+// отправляются вне транзакции; результат каждой попытки записывается отдельно. Если процесс
+// упадёт посреди пакета, незавершённые доставки вернутся в очередь по истечении аренды.
+// Ошибки отдельных доставок не прерывают пакет: они записываются в журнал и откладываются.
+func (d *Dispatcher) Flush(ctx context.Context) (processed int, err error) {
+	var rows []pendingDelivery
+	err = d.db.SelectContext(ctx, &rows, `
+		WITH claimed AS (
+			UPDATE webhook_deliveries
+			SET next_attempt_at = now() + $2 * interval '1 millisecond'
+			WHERE id IN (
+				SELECT id FROM webhook_deliveries
+				WHERE status = 'pending' AND next_attempt_at <= now()
+				ORDER BY id
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED)
+			RETURNING id, subscription_id, event_type, payload, attempts)
+		SELECT c.id, c.event_type, c.payload, c.attempts, s.url, s.secret
+		FROM claimed c
+		JOIN webhook_subscriptions s ON s.id = c.subscription_id
+		ORDER BY c.id`, dispatchBatchSize, deliveryLease.Milliseconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+
+	for _, row := range rows {
+		if err = d.deliver(ctx, row); err != nil {
+			return processed, err
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// deliver отправляет доставку и в одной транзакции записывает попытку и новое состояние доставки.
+func (d *Dispatcher) deliver(ctx context.Context, row pendingDelivery) (err error) {
+	start := time.Now()
+	code, sendErr := d.send(ctx, row)
+	duration := time.Since(start).Milliseconds()
+
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				err = errors.Join(err, rbErr)
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	var statusCode *int
+	if code != 0 {
+		statusCode = &code
+	}
+	var errText *string
+	if sendErr != nil {
+		msg := sendErr.Error()
+		errText = &msg
+	}
+	if _, err = tx.ExecContext(ctx,
+		`INSERT INTO webhook_delivery_attempts (delivery_id, status_code, error, duration_ms) VALUES ($1, $2, $3, $4)`,
+		row.ID, statusCode, errText, duration); err != nil {
+		return fmt.Errorf("failed to log webhook delivery %d: %w", row.ID, err)
+	}
+
+	if sendErr == nil {
+		_, err = tx.ExecContext(ctx,
+			`UPDATE webhook_deliveries SET status = 'delivered', attempts = attempts + 1, last_status_code = $2, last_error = NULL, delivered_at = now() WHERE id = $1`,
+			row.ID, statusCode)
+		if err != nil {
+			return fmt.Errorf("failed to mark webhook delivery %d as delivered: %w", row.ID, err)
+		}
+		return nil
+	}
+
+	attempt := row.Attempts + 1
+	status := StatusPending
+	if attempt >= d.maxAttempts {
+		status = StatusFailed
+		d.logger.Warn("Доставка webhook не удалась", zap.Int64("delivery", row.ID), zap.String("url", row.URL),
+			zap.Int("attempts", attempt), zap.Error(sendErr))
+	}
+	_, err = tx.ExecContext(ctx,
+		`UPDATE webhook_deliveries SET status = $2, attempts = attempts + 1, last_status_code = $3, last_error = $4,
+			next_attempt_at = now() + $5 * interval '1 millisecond' WHERE id = $1`,
+		row.ID, status, statusCode, errText, retryDelay(attempt).Milliseconds())
+	if err != nil {
+		return fmt.Errorf("failed to postpone webhook delivery %d: %w", row.ID, err)
+	}
+	return nil
+}
+
+// purge не чаще раза в purgeInterval удаляет завершённые доставки, созданные раньше срока хранения.
+func (d *Dispatcher) purge(ctx context.Context) {
+	if d.retention <= 0 || time.Since(d.lastPurge) < purgeInterval {
+		return
+	}
+	d.lastPurge = time.Now()
+	res, err := d.db.ExecContext(ctx,
+		`DELETE FROM webhook_deliveries WHERE status <> 'pending' AND created_at < now() - $1 * interval '1 millisecond'`,
+		d.retention.Milliseconds())
+	if err != nil {
+		d.logger.Warn("Не удалось удалить старые доставки webhook", zap.Error(err))
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		d.logger.Info("Удалены старые доставки webhook", zap.Int64("count", n))
+	}
+}
+
+// send выполняет подписанный POST-запрос и возвращает код ответа.
+func (d *Dispatcher) send(ctx context.Context, row pendingDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, row.URL, bytes.NewReader(row.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "EaistSync-Webhook/1")
+	req.Header.Set(HeaderEvent, row.EventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(row.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(row.Secret, timestamp, row.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("ответ %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// retryDelay возвращает задержку перед attempt-й повторной доставкой.
+func retryDelay(attempt int) time.Duration {
+	delay := deliveryBaseDelay
+	for i := 1; i < attempt && delay < deliveryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, deliveryMaxDelay)
+}
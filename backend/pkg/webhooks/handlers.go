@@ -0,0 +1,308 @@
+package webhooks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+
+	"github.com/ryantrue/EaistSync/pkg/api/rest"
+)
+
+const (
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 500
+)
+
+// SubscriptionInput – данные для создания и изменения подписки. Active и Secret при изменении
+// необязательны: не переданное значение сохраняется.
+type SubscriptionInput struct {
+	URL         string   `json:"url"`
+	EventTypes  []string `json:"event_types"`
+	CustomerIDs []int64  `json:"customer_ids"`
+	StateIDs    []int64  `json:"state_ids"`
+	Secret      string   `json:"secret"`
+	Active      *bool    `json:"active"`
+}
+
+// CreateSubscriptionResponse возвращается при создании подписки; секрет больше не отдаётся.
+type CreateSubscriptionResponse struct {
+	Secret       string       `json:"secret"`
+	Subscription Subscription `json:"subscription"`
+}
+
+// DeliveryDetails – доставка с журналом попыток.
+type DeliveryDetails struct {
+	Delivery
+	AttemptLog []Attempt `json:"attempt_log"`
+}
+
+// validate проверяет адрес и типы событий подписки. Если allowPrivate не задан, адрес,
+// разрешающийся во внутреннюю сеть, отклоняется.
+func (in *SubscriptionInput) validate(ctx context.Context, allowPrivate bool) error {
+	u, err := url.Parse(strings.TrimSpace(in.URL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("url должен быть абсолютным http(s)-адресом")
+	}
+	if u.User != nil {
+		return fmt.Errorf("url не должен содержать учётные данные")
+	}
+	if !allowPrivate {
+		if err := checkHost(ctx, u.Hostname()); err != nil {
+			return err
+		}
+	}
+	in.URL = u.String()
+	for _, t := range in.EventTypes {
+		if !slices.Contains(EventTypes, t) {
+			return fmt.Errorf("неизвестный тип события %q", t)
+		}
+	}
+	return nil
+}
+
+// ListSubscriptionsHandler возвращает подписки текущего пользователя.
+func ListSubscriptionsHandler(db *sqlx.DB, log *zap.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := rest.UserIDFromContext(c)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Неавторизованный доступ"})
+		}
+		subs := []Subscription{}
+		if err := db.SelectContext(c.Request().Context(), &subs, "SELECT * FROM webhook_subscriptions WHERE user_id=$1 ORDER BY id", userID); err != nil {
+			log.Error("Ошибка получения подписок webhook", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Ошибка БД"})
+		}
+		return c.JSON(http.StatusOK, subs)
+	}
+}
+
+// GetSubscriptionHandler возвращает подписку текущего пользователя.
+func GetSubscriptionHandler(db *sqlx.DB, log *zap.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		sub, status, err := loadSubscription(c, db, log)
+		if err != nil {
+			return c.JSON(status, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, sub)
+	}
+}
+
+// CreateSubscriptionHandler создаёт подписку. Если секрет не передан, он генерируется.
+// Адреса во внутренних сетях допускаются только при allowPrivate.
+func CreateSubscriptionHandler(db *sqlx.DB, log *zap.Logger, allowPrivate bool) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := rest.UserIDFromContext(c)
+		if !ok {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Неавторизованный доступ"})
+		}
+		var input SubscriptionInput
+		if err := c.Bind(&input); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Неверные входные данные"})
+		}
+		if err := input.validate(c.Request().Context(), allowPrivate); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		if input.Secret == "" {
+			secret, err := generateSecret()
+			if err != nil {
+				log.Error("Ошибка генерации секрета webhook", zap.Error(err))
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Ошибка создания подписки"})
+			}
+			input.Secret = secret
+		}
+		active := input.Active == nil || *input.Active
+
+		var sub Subscription
+		err := db.GetContext(c.Request().Context(), &sub, `
+			INSERT INTO webhook_subscriptions (user_id, url, event_types, customer_ids, state_ids, secret, active)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING *`,
+			userID, input.URL, pq.StringArray(nonNil(input.EventTypes)), pq.Int64Array(nonNil(input.CustomerIDs)),
+			pq.Int64Array(nonNil(input.StateIDs)), input.Secret, active)
+		if err != nil {
+			log.Error("Ошибка сохранения подписки webhook", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Ошибка БД"})
+		}
+		return c.JSON(http.StatusCreated, CreateSubscriptionResponse{Secret: sub.Secret, Subscription: sub})
+	}
+}
+
+// UpdateSubscriptionHandler изменяет подписку текущего пользователя.
+func UpdateSubscriptionHandler(db *sqlx.DB, log *zap.Logger, allowPrivate bool) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		sub, status, err := loadSubscription(c, db, log)
+		if err != nil {
+			return c.JSON(status, map[string]string{"error": err.Error()})
+		}
+		var input SubscriptionInput
+		if err := c.Bind(&input); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Неверные входные данные"})
+		}
+		if err := input.validate(c.Request().Context(), allowPrivate); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		if input.Secret == "" {
+			input.Secret = sub.Secret
+		}
+		active := sub.Active
+		if input.Active != nil {
+			active = *input.Active
+		}
+
+		err = db.GetContext(c.Request().Context(), sub, `
+			UPDATE webhook_subscriptions
+			SET url = $2, event_types = $3, customer_ids = $4, state_ids = $5, secret = $6, active = $7, updated_at = now()
+			WHERE id = $1
+			RETURNING *`,
+			sub.ID, input.URL, pq.StringArray(nonNil(input.EventTypes)), pq.Int64Array(nonNil(input.CustomerIDs)),
+			pq.Int64Array(nonNil(input.StateIDs)), input.Secret, active)
+		if err != nil {
+			log.Error("Ошибка изменения подписки webhook", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Ошибка БД"})
+		}
+		return c.JSON(http.StatusOK, sub)
+	}
+}
+
+// DeleteSubscriptionHandler удаляет подписку текущего пользователя вместе с журналом доставок.
+func DeleteSubscriptionHandler(db *sqlx.DB, log *zap.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		sub, status, err := loadSubscription(c, db, log)
+		if err != nil {
+			return c.JSON(status, map[string]string{"error": err.Error()})
+		}
+		if _, err := db.ExecContext(c.Request().Context(), "DELETE FROM webhook_subscriptions WHERE id=$1", sub.ID); err != nil {
+			log.Error("Ошибка удаления подписки webhook", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Ошибка БД"})
+		}
+		return c.JSON(http.StatusOK, map[string]string{"message": "Подписка удалена"})
+	}
+}
+
+// ListDeliveriesHandler возвращает последние доставки подписки (параметры status и limit).
+func ListDeliveriesHandler(db *sqlx.DB, log *zap.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		sub, status, err := loadSubscription(c, db, log)
+		if err != nil {
+			return c.JSON(status, map[string]string{"error": err.Error()})
+		}
+		limit := defaultDeliveriesLimit
+		if v := c.QueryParam("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Неверный параметр limit"})
+			}
+			limit = min(n, maxDeliveriesLimit)
+		}
+		deliveries := []Delivery{}
+		err = db.SelectContext(c.Request().Context(), &deliveries, `
+			SELECT * FROM webhook_deliveries
+			WHERE subscription_id = $1 AND ($2 = '' OR status = $2)
+			ORDER BY id DESC
+			LIMIT $3`, sub.ID, c.QueryParam("status"), limit)
+		if err != nil {
+			log.Error("Ошибка получения доставок webhook", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Ошибка БД"})
+		}
+		return c.JSON(http.StatusOK, deliveries)
+	}
+}
+
+// GetDeliveryHandler возвращает доставку с журналом попыток.
+func GetDeliveryHandler(db *sqlx.DB, log *zap.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		delivery, status, err := loadDelivery(c, db, log)
+		if err != nil {
+			return c.JSON(status, map[string]string{"error": err.Error()})
+		}
+		details := DeliveryDetails{Delivery: *delivery, AttemptLog: []Attempt{}}
+		if err := db.SelectContext(c.Request().Context(), &details.AttemptLog,
+			"SELECT * FROM webhook_delivery_attempts WHERE delivery_id=$1 ORDER BY id", delivery.ID); err != nil {
+			log.Error("Ошибка получения журнала доставки webhook", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Ошибка БД"})
+		}
+		return c.JSON(http.StatusOK, details)
+	}
+}
+
+// RedeliverHandler ставит доставку в очередь повторно, в том числе уже доставленную или
+// исчерпавшую попытки.
+func RedeliverHandler(db *sqlx.DB, log *zap.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		delivery, status, err := loadDelivery(c, db, log)
+		if err != nil {
+			return c.JSON(status, map[string]string{"error": err.Error()})
+		}
+		if _, err := db.ExecContext(c.Request().Context(),
+			`UPDATE webhook_deliveries SET status = 'pending', attempts = 0, next_attempt_at = now() WHERE id = $1`,
+			delivery.ID); err != nil {
+			log.Error("Ошибка повторной постановки доставки webhook", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Ошибка БД"})
+		}
+		return c.JSON(http.StatusAccepted, map[string]string{"message": "Доставка поставлена в очередь"})
+	}
+}
+
+// loadSubscription загружает подписку из параметра :id, принадлежащую текущему пользователю,
+// и при ошибке возвращает HTTP-статус ответа.
+func loadSubscription(c echo.Context, db *sqlx.DB, log *zap.Logger) (*Subscription, int, error) {
+	userID, ok := rest.UserIDFromContext(c)
+	if !ok {
+		return nil, http.StatusUnauthorized, errors.New("Неавторизованный доступ")
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, http.StatusBadRequest, errors.New("Неверный идентификатор подписки")
+	}
+	var sub Subscription
+	err = db.GetContext(c.Request().Context(), &sub, "SELECT * FROM webhook_subscriptions WHERE id=$1 AND user_id=$2", id, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, http.StatusNotFound, errors.New("Подписка не найдена")
+	}
+	if err != nil {
+		log.Error("Ошибка получения подписки webhook", zap.Error(err))
+		return nil, http.StatusInternalServerError, errors.New("Ошибка БД")
+	}
+	return &sub, 0, nil
+}
+
+// loadDelivery загружает доставку из параметра :delivery подписки :id текущего пользователя.
+func loadDelivery(c echo.Context, db *sqlx.DB, log *zap.Logger) (*Delivery, int, error) {
+	sub, status, err := loadSubscription(c, db, log)
+	if err != nil {
+		return nil, status, err
+	}
+	id, err := strconv.ParseInt(c.Param("delivery"), 10, 64)
+	if err != nil {
+		return nil, http.StatusBadRequest, errors.New("Неверный идентификатор доставки")
+	}
+	var delivery Delivery
+	err = db.GetContext(c.Request().Context(), &delivery, "SELECT * FROM webhook_deliveries WHERE id=$1 AND subscription_id=$2", id, sub.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, http.StatusNotFound, errors.New("Доставка не найдена")
+	}
+	if err != nil {
+		log.Error("Ошибка получения доставки webhook", zap.Error(err))
+		return nil, http.StatusInternalServerError, errors.New("Ошибка БД")
+	}
+	return &delivery, 0, nil
+}
+
+// nonNil заменяет nil пустым срезом: столбцы фильтров объявлены NOT NULL.
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
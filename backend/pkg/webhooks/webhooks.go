@@ -0,0 +1,137 @@
+// Package webhooks доставляет события о контрактах партнёрским системам HTTP-запросами:
+// подписки с фильтрами, подпись HMAC-SHA256, очередь повторов и журнал доставок.
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/ryantrue/EaistSync/pkg/events"
+)
+
+// Статусы доставки.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Заголовки запроса доставки.
+const (
+	HeaderSignature = "X-EaistSync-Signature"
+	HeaderTimestamp = "X-EaistSync-Timestamp"
+	HeaderEvent     = "X-EaistSync-Event"
+	HeaderDelivery  = "X-EaistSync-Delivery"
+)
+
+// secretLen – длина генерируемого секрета подписки в байтах.
+const secretLen = 32
+
+// Subscription – подписка на события. Пустой фильтр (event_types, customer_ids, state_ids)
+// не ограничивает события.
+type Subscription struct {
+	ID          int64          `db:"id" json:"id"`
+	UserID      int64          `db:"user_id" json:"user_id"`
+	URL         string         `db:"url" json:"url"`
+	EventTypes  pq.StringArray `db:"event_types" json:"event_types"`
+	CustomerIDs pq.Int64Array  `db:"customer_ids" json:"customer_ids"`
+	StateIDs    pq.Int64Array  `db:"state_ids" json:"state_ids"`
+	Secret      string         `db:"secret" json:"-"`
+	Active      bool           `db:"active" json:"active"`
+	CreatedAt   time.Time      `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time      `db:"updated_at" json:"updated_at"`
+}
+
+// Delivery – доставка события по подписке.
+type Delivery struct {
+	ID             int64           `db:"id" json:"id"`
+	SubscriptionID int64           `db:"subscription_id" json:"subscription_id"`
+	EventID        string          `db:"event_id" json:"event_id"`
+	EventType      string          `db:"event_type" json:"event_type"`
+	Payload        json.RawMessage `db:"payload" json:"payload"`
+	Status         string          `db:"status" json:"status"`
+	Attempts       int             `db:"attempts" json:"attempts"`
+	NextAttemptAt  time.Time       `db:"next_attempt_at" json:"next_attempt_at"`
+	LastStatusCode *int            `db:"last_status_code" json:"last_status_code"`
+	LastError      *string         `db:"last_error" json:"last_error"`
+	CreatedAt      time.Time       `db:"created_at" json:"created_at"`
+	DeliveredAt    *time.Time      `db:"delivered_at" json:"delivered_at"`
+}
+
+// Attempt – запись журнала попыток доставки.
+type Attempt struct {
+	ID          int64     `db:"id" json:"id"`
+	DeliveryID  int64     `db:"delivery_id" json:"delivery_id"`
+	StatusCode  *int      `db:"status_code" json:"status_code"`
+	Error       *string   `db:"error" json:"error"`
+	DurationMS  int       `db:"duration_ms" json:"duration_ms"`
+	AttemptedAt time.Time `db:"attempted_at" json:"attempted_at"`
+}
+
+// EventTypes – типы событий, на которые можно подписаться.
+var EventTypes = []string{
+	events.TypeContractCreated,
+	events.TypeContractUpdated,
+	events.TypeContractStateChanged,
+	events.TypeContractRemoved,
+	events.TypeContractRestored,
+}
+
+// Enqueue ставит события о контрактах в очередь доставки для подходящих активных подписок.
+// Вызывается в транзакции сохранения контрактов, после записи события в outbox; заказчик и состояние
+// контракта для фильтров берутся из таблицы contracts.
+func Enqueue(ctx context.Context, exec sqlx.ExecerContext, evs ...events.Event) error {
+	for _, e := range evs {
+		contractID, err := strconv.ParseInt(e.Subject, 10, 64)
+		if err != nil {
+			return fmt.Errorf("event %s: invalid contract id %q", e.ID, e.Subject)
+		}
+		payload, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("failed to marshal event %s: %w", e.ID, err)
+		}
+		_, err = exec.ExecContext(ctx, `
+			INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload)
+			SELECT s.id, $1, $2, $3
+			FROM webhook_subscriptions s
+			LEFT JOIN contracts c ON c.id = $4
+			WHERE s.active
+			  AND (cardinality(s.event_types) = 0 OR $2 = ANY(s.event_types))
+			  AND (cardinality(s.customer_ids) = 0 OR (c.data->>'customerId')::bigint = ANY(s.customer_ids))
+			  AND (cardinality(s.state_ids) = 0 OR (c.data->>'stateId')::bigint = ANY(s.state_ids))`,
+			e.ID, e.Type, payload, contractID)
+		if err != nil {
+			return fmt.Errorf("failed to enqueue webhook deliveries for event %s: %w", e.ID, err)
+		}
+	}
+	return nil
+}
+
+// Sign возвращает подпись тела запроса: "sha256=" и HMAC-SHA256 от "<timestamp>.<body>" в hex.
+// Получатель проверяет подпись и отклоняет запросы со старой меткой времени.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// generateSecret создаёт случайный секрет подписки.
+func generateSecret() (string, error) {
+	b := make([]byte, secretLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("генерация секрета: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}